@@ -10,20 +10,27 @@ import (
 	liberator_scheme "github.com/nais/liberator/pkg/scheme"
 	"github.com/nais/pgrator/internal/config"
 	"github.com/nais/pgrator/internal/controller"
+	"github.com/nais/pgrator/internal/health"
+	"github.com/nais/pgrator/internal/prometheus"
 	"github.com/nais/pgrator/internal/synchronizer"
 	"github.com/nais/pgrator/internal/synchronizer/events"
+	"github.com/nais/pgrator/internal/tracing"
+	webhookv1 "github.com/nais/pgrator/internal/webhook/v1"
 	pov1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	"github.com/sethvargo/go-envconfig"
 	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 var (
@@ -66,6 +73,17 @@ func main() {
 	cfg.Log(setupLog)
 	setupLog.Info("---------------------")
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			setupLog.Error(err, "unable to shut down tracing")
+		}
+	}()
+
 	metricsServerOptions := metricsserver.Options{
 		SecureServing: true,
 		BindAddress:   ":8443",
@@ -81,14 +99,46 @@ func main() {
 		metricsServerOptions.KeyName = "tls.key"
 	}
 
+	webhookServerOptions := webhook.Options{
+		TLSOpts: []func(*tls.Config){},
+	}
+
+	if len(cfg.WebhookCertPath) > 0 {
+		setupLog.Info("Initializing webhook certificate watcher using provided certificates",
+			"webhook-cert-path", cfg.WebhookCertPath, "webhook-cert-name", "tls.crt", "webhook-cert-key", "tls.key")
+
+		webhookServerOptions.CertDir = cfg.WebhookCertPath
+		webhookServerOptions.CertName = "tls.crt"
+		webhookServerOptions.KeyName = "tls.key"
+	}
+
+	cacheByObject, err := controller.CacheByObject()
+	if err != nil {
+		setupLog.Error(err, "unable to restrict the cache")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
+		WebhookServer:          webhook.NewServer(webhookServerOptions),
 		HealthProbeBindAddress: ":8081",
-		LeaderElection:         false,
+		LeaderElection:         cfg.LeaderElection,
+		LeaderElectionID:       cfg.LeaderElectionID,
+		// The namespace is required by the configuration, since the readiness check of standbys needs it
+		LeaderElectionNamespace: cfg.LeaderElectionNamespace,
+		LeaseDuration:           &cfg.LeaderElectionLeaseDuration,
+		RenewDeadline:           &cfg.LeaderElectionRenewDeadline,
+		RetryPeriod:             &cfg.LeaderElectionRetryPeriod,
+		// Hand over to a standby right away on shutdown, instead of letting it wait for the lease to expire.
+		// This is safe since the process exits as soon as the manager has stopped.
+		LeaderElectionReleaseOnCancel: true,
 		Client: client.Options{
 			DryRun: &cfg.DryRun,
 		},
+		Cache: cache.Options{
+			ByObject: cacheByObject,
+		},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -97,22 +147,44 @@ func main() {
 
 	recorder := events.NewRecorder(mgr.GetEventRecorderFor("pgrator"))
 	reconciler := &controller.PostgresReconciler{
-		Config:   cfg,
-		Recorder: recorder,
+		Config:    cfg,
+		Recorder:  recorder,
+		APIReader: mgr.GetAPIReader(),
+	}
+	if len(cfg.PrometheusURL) > 0 {
+		metrics, err := prometheus.NewClient(cfg.PrometheusURL)
+		if err != nil {
+			setupLog.Error(err, "unable to create Prometheus client")
+			os.Exit(1)
+		}
+		reconciler.Metrics = metrics
 	}
 
-	postgresController := synchronizer.NewSynchronizer(mgr.GetClient(), mgr.GetScheme(), reconciler, recorder)
+	postgresController := synchronizer.NewSynchronizer(mgr.GetClient(), mgr.GetScheme(), reconciler, recorder,
+		synchronizer.WithPlanMode(cfg.PlanMode),
+		synchronizer.WithMaxParallelActions(cfg.MaxParallelActions),
+	)
 	if err := postgresController.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "postgresController", "Postgres")
 		os.Exit(1)
 	}
+	if !cfg.WebhooksDisabled {
+		if err := webhookv1.SetupPostgresWebhookWithManager(mgr, cfg); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Postgres")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	readiness := health.NewReadiness(mgr.Elected(), mgr.GetCache(), mgr.GetAPIReader(), types.NamespacedName{
+		Namespace: cfg.LeaderElectionNamespace,
+		Name:      cfg.LeaderElectionID,
+	})
+	if err := mgr.AddReadyzCheck("readyz", readiness.Check); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
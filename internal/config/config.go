@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/sethvargo/go-envconfig"
@@ -17,8 +21,66 @@ type Config struct {
 	PostgresStorageClass string `env:"POSTGRES_STORAGE_CLASS"`
 	PostgresImage        string `env:"POSTGRES_IMAGE"`
 
+	// PsqlImage is the image with psql used to grant privileges to additional users
+	PsqlImage string `env:"PSQL_IMAGE, default=postgres:17-alpine"`
+
+	// LogicalBackupSchedule is the default cron schedule for logical backups, which are disabled when empty
+	LogicalBackupSchedule string `env:"LOGICAL_BACKUP_SCHEDULE"`
+	// LogicalBackupRetention is the default time to keep logical backups, e.g. "14 days". Kept forever when empty.
+	LogicalBackupRetention string `env:"LOGICAL_BACKUP_RETENTION"`
+
+	// SupportedMajorVersions lists the major versions new and updated resources are allowed to ask for
+	SupportedMajorVersions []string `env:"SUPPORTED_MAJOR_VERSIONS, default=16,17"`
+
+	// MajorUpgradeBackup takes a logical backup before handing a major version upgrade over to Zalando
+	MajorUpgradeBackup bool `env:"MAJOR_UPGRADE_BACKUP"`
+
+	// ExtensionCatalog lists the extensions that can be enabled, and the major versions they are available in.
+	// The extensions in the Spilo image are used when empty.
+	ExtensionCatalog ExtensionCatalog `env:"EXTENSION_CATALOG"`
+
+	// PasswordRotationIntervalDays must match password_rotation_interval in the configuration of Zalando, which rotates
+	// passwords at least this often once rotation is enabled. Postgres resources can ask for shorter intervals.
+	PasswordRotationIntervalDays int `env:"PASSWORD_ROTATION_INTERVAL_DAYS, default=90"`
+
 	DryRun                  bool `env:"DRY_RUN"`
+	PlanMode                bool `env:"PLAN_MODE"`
 	PrometheusRulesDisabled bool `env:"PROMETHEUS_RULES_DISABLED"`
+
+	// PrometheusURL is the Prometheus queried for disk usage when growing disks automatically, which is unavailable when empty
+	PrometheusURL string `env:"PROMETHEUS_URL"`
+
+	// WalArchivingDisabled turns off continuous WAL archiving to a GCS bucket per cluster
+	WalArchivingDisabled  bool   `env:"WAL_ARCHIVING_DISABLED"`
+	GoogleBucketLocation  string `env:"GOOGLE_BUCKET_LOCATION, default=europe-north1"`
+	WalRetentionDays      int    `env:"WAL_RETENTION_DAYS, default=7"`
+	WalBaseBackupSchedule string `env:"WAL_BASE_BACKUP_SCHEDULE, default=0 1 * * *"`
+
+	// MaxParallelActions limits how many actions are performed concurrently for each reconcile
+	MaxParallelActions int `env:"MAX_PARALLEL_ACTIONS, default=4"`
+
+	// ServerSideApplyKinds lists the kinds that are written using server-side apply instead of update
+	ServerSideApplyKinds []string `env:"SERVER_SIDE_APPLY_KINDS"`
+	// ServerSideApplyForceKinds lists the kinds where fields owned by other managers are taken over instead of failing with a conflict
+	ServerSideApplyForceKinds []string `env:"SERVER_SIDE_APPLY_FORCE_KINDS"`
+
+	// OtelExporterEndpoint is the OTLP gRPC endpoint traces are exported to, tracing is disabled when empty
+	OtelExporterEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OtelServiceName      string `env:"OTEL_SERVICE_NAME, default=pgrator"`
+
+	// WebhooksDisabled turns off serving the admission webhooks, e.g. when running outside the cluster
+	WebhooksDisabled bool `env:"WEBHOOKS_DISABLED"`
+	// WebhookCertPath is the directory holding the serving certificate for the webhooks, tls.crt and tls.key
+	WebhookCertPath string `env:"WEBHOOK_CERT_PATH"`
+
+	// LeaderElection lets several replicas run, with only the elected leader reconciling.
+	// It requires LeaderElectionNamespace, where the lease is kept
+	LeaderElection              bool          `env:"LEADER_ELECTION"`
+	LeaderElectionID            string        `env:"LEADER_ELECTION_ID, default=pgrator.nais.io"`
+	LeaderElectionNamespace     string        `env:"LEADER_ELECTION_NAMESPACE"`
+	LeaderElectionLeaseDuration time.Duration `env:"LEADER_ELECTION_LEASE_DURATION, default=15s"`
+	LeaderElectionRenewDeadline time.Duration `env:"LEADER_ELECTION_RENEW_DEADLINE, default=10s"`
+	LeaderElectionRetryPeriod   time.Duration `env:"LEADER_ELECTION_RETRY_PERIOD, default=2s"`
 }
 
 func NewConfig(ctx context.Context, lookuper envconfig.Lookuper) (*Config, error) {
@@ -31,9 +93,28 @@ func NewConfig(ctx context.Context, lookuper envconfig.Lookuper) (*Config, error
 		return nil, err
 	}
 
+	// Standbys tell whether the leader is alive from the lease, which they can only find when its namespace is known
+	if cfg.LeaderElection && len(cfg.LeaderElectionNamespace) == 0 {
+		return nil, errors.New("LEADER_ELECTION_NAMESPACE must be set when LEADER_ELECTION is enabled")
+	}
+
 	return cfg, nil
 }
 
+// UseServerSideApply returns true if resources of the given kind should be written using server-side apply
+func (f *Config) UseServerSideApply(kind string) bool {
+	return slices.ContainsFunc(f.ServerSideApplyKinds, func(k string) bool {
+		return strings.EqualFold(k, kind)
+	})
+}
+
+// ForceServerSideApply returns true if server-side apply should take ownership of conflicting fields for the given kind
+func (f *Config) ForceServerSideApply(kind string) bool {
+	return slices.ContainsFunc(f.ServerSideApplyForceKinds, func(k string) bool {
+		return strings.EqualFold(k, kind)
+	})
+}
+
 func (f *Config) Log(logger logr.Logger) {
 	val := reflect.ValueOf(*f)
 	typeOfStruct := val.Type()
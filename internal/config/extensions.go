@@ -0,0 +1,36 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ExtensionCatalog lists the extensions that can be enabled in the database, by name
+type ExtensionCatalog map[string]Extension
+
+// Extension describes where an extension in the catalog is available
+type Extension struct {
+	// MinMajorVersion and MaxMajorVersion are the first and last major versions the extension is available in,
+	// unlimited when zero
+	MinMajorVersion int `json:"minMajorVersion,omitempty"`
+	MaxMajorVersion int `json:"maxMajorVersion,omitempty"`
+	// Schema is the schema the extension is created in, unless pinned by the resource. Defaults to public.
+	Schema string `json:"schema,omitempty"`
+}
+
+// EnvDecode reads the catalog as a JSON object, e.g. {"postgis": {}, "plv8": {"maxMajorVersion": 16}}
+func (c *ExtensionCatalog) EnvDecode(value string) error {
+	if len(value) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(value), c); err != nil {
+		return fmt.Errorf("parsing extension catalog: %w", err)
+	}
+	return nil
+}
+
+// AvailableIn returns true if the extension is available in the given major version
+func (e Extension) AvailableIn(majorVersion int) bool {
+	return (e.MinMajorVersion == 0 || majorVersion >= e.MinMajorVersion) &&
+		(e.MaxMajorVersion == 0 || majorVersion <= e.MaxMajorVersion)
+}
@@ -4,10 +4,11 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
 	iam_cnrm_cloud_google_com_v1beta1 "github.com/nais/liberator/pkg/apis/iam.cnrm.cloud.google.com/v1beta1"
-	"github.com/nais/liberator/pkg/namegen"
+	storage_cnrm_cloud_google_com_v1beta1 "github.com/nais/liberator/pkg/apis/storage.cnrm.cloud.google.com/v1beta1"
 	liberator_strings "github.com/nais/liberator/pkg/strings"
 	"github.com/nais/pgrator/internal/config"
 	"github.com/nais/pgrator/internal/controller/resourcecreator"
@@ -16,26 +17,68 @@ import (
 	"github.com/nais/pgrator/internal/synchronizer/reconciler"
 	monitoring_v1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	batch_v1 "k8s.io/api/batch/v1"
+	core_v1 "k8s.io/api/core/v1"
 	networking_v1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 const (
-	// Max length is 63, but we need to save space for suffixes added by Zalando operator or StatefulSets
-	maxClusterNameLength = 50
+	// diskResizeRequeueInterval is how often volumes being resized are checked, as they are not watched
+	diskResizeRequeueInterval = time.Minute
+	// diskUsageRequeueInterval is how often disk usage is checked for clusters growing their disk automatically
+	diskUsageRequeueInterval = 5 * time.Minute
+	// passwordRotationRequeueInterval is how often password rotations are checked while Zalando is rotating, as the
+	// secrets are not watched
+	passwordRotationRequeueInterval = time.Minute
+	// connectionRequeueInterval is how often the credentials for the connection secret are looked for until Zalando has
+	// created them, as its secrets are not watched
+	connectionRequeueInterval = time.Minute
+	// connectionRefreshInterval is how often the connection secret is brought up to date with the credentials once
+	// created, for changes to them other than the rotations we follow
+	connectionRefreshInterval = 10 * time.Minute
 )
 
+// MetricsQuerier runs queries against the Prometheus holding the metrics of the clusters
+type MetricsQuerier interface {
+	HasResults(ctx context.Context, query string) (bool, error)
+}
+
 // PostgresReconciler reconciles a Postgres object
 type PostgresReconciler struct {
 	Config   *config.Config
 	Recorder events.Recorder
+	// Metrics is used to grow disks automatically, and is nil when no Prometheus is configured
+	Metrics MetricsQuerier
+	// APIReader reads objects left out of the cache, like the secrets Zalando keeps credentials in
+	APIReader client.Reader
 }
 
 var _ reconciler.Reconciler[*data_nais_io_v1.Postgres, PreparedData] = &PostgresReconciler{}
 
 type PreparedData struct {
+	// Clone is the source the cluster is bootstrapped from, if a clone or restore is requested
+	Clone resourcecreator.Clone
+	// Upgrade is the major version upgrade in progress, if any
+	Upgrade resourcecreator.MajorVersionUpgrade
+	// Disk is the size of the volumes, compared to the existing ones
+	Disk resourcecreator.DiskResize
+	// Databases are the databases requested in the cluster, the app database first
+	Databases []resourcecreator.Database
+	// DatabaseRemoval is the databases of the existing cluster that are no longer requested
+	DatabaseRemoval resourcecreator.DatabaseRemoval
+	// UserGrants is the additional users, and the job granting them their privileges
+	UserGrants resourcecreator.UserGrants
+	// PasswordRotation is when the passwords of the users were last rotated, and when they are due
+	PasswordRotation resourcecreator.PasswordRotation
+	// Connection is the credentials the connection secret is made from
+	Connection resourcecreator.Connection
 }
 
 func (r *PostgresReconciler) Name() string {
@@ -46,8 +89,222 @@ func (r *PostgresReconciler) New() *data_nais_io_v1.Postgres {
 	return &data_nais_io_v1.Postgres{}
 }
 
-func (r *PostgresReconciler) Prepare(_ctx context.Context, _reader client.Reader, _obj *data_nais_io_v1.Postgres) (PreparedData, ctrl.Result, error) {
-	return PreparedData{}, ctrl.Result{}, nil
+func (r *PostgresReconciler) Prepare(ctx context.Context, reader client.Reader, obj *data_nais_io_v1.Postgres) (PreparedData, ctrl.Result, error) {
+	// Nothing prepared is needed to delete, and a missing clone source must not keep the resource from being deleted
+	if obj.GetDeletionTimestamp() != nil {
+		return PreparedData{}, ctrl.Result{}, nil
+	}
+
+	pgClusterName, pgNamespace, err := getClusterNameAndNamespace(obj)
+	if err != nil {
+		return PreparedData{}, ctrl.Result{}, err
+	}
+
+	existing := &acid_zalan_do_v1.Postgresql{}
+	err = reader.Get(ctx, client.ObjectKey{Namespace: pgNamespace, Name: pgClusterName}, existing)
+	if apierrors.IsNotFound(err) {
+		existing = nil
+	} else if err != nil {
+		return PreparedData{}, ctrl.Result{}, fmt.Errorf("getting existing cluster: %w", err)
+	}
+
+	clone, err := r.prepareClone(ctx, reader, obj, existing)
+	if err != nil {
+		return PreparedData{}, ctrl.Result{}, err
+	}
+
+	upgrade, err := r.prepareMajorVersionUpgrade(ctx, reader, obj, existing, pgClusterName, pgNamespace)
+	if err != nil {
+		return PreparedData{}, ctrl.Result{}, err
+	}
+
+	disk, err := r.prepareDiskResize(ctx, reader, obj, existing, pgClusterName, pgNamespace)
+	if err != nil {
+		return PreparedData{}, ctrl.Result{}, err
+	}
+
+	databases, err := resourcecreator.GetDatabases(obj, r.Config)
+	if err != nil {
+		return PreparedData{}, ctrl.Result{}, err
+	}
+
+	removal, err := resourcecreator.GetDatabaseRemoval(obj, existing, r.Config)
+	if err != nil {
+		return PreparedData{}, ctrl.Result{}, err
+	}
+
+	grants, err := r.prepareUserGrants(ctx, reader, obj, existing, databases, pgClusterName, pgNamespace)
+	if err != nil {
+		return PreparedData{}, ctrl.Result{}, err
+	}
+
+	rotation, err := r.preparePasswordRotation(ctx, obj, databases, grants.Users, pgClusterName)
+	if err != nil {
+		return PreparedData{}, ctrl.Result{}, err
+	}
+
+	connection, err := r.prepareConnection(ctx, obj, pgClusterName)
+	if err != nil {
+		return PreparedData{}, ctrl.Result{}, err
+	}
+
+	return PreparedData{Clone: clone, Upgrade: upgrade, Disk: disk, Databases: databases, DatabaseRemoval: removal, UserGrants: grants, PasswordRotation: rotation, Connection: connection}, ctrl.Result{}, nil
+}
+
+// prepareClone resolves the source of a requested clone or point-in-time restore. Zalando only clones when creating
+// the cluster, so the source is only resolved until then, and the clone of an existing cluster is kept as it is.
+func (r *PostgresReconciler) prepareClone(ctx context.Context, reader client.Reader, obj *data_nais_io_v1.Postgres, existing *acid_zalan_do_v1.Postgresql) (resourcecreator.Clone, error) {
+	if existing != nil {
+		return resourcecreator.ExistingClone(obj, existing), nil
+	}
+
+	sourceKey, ok, err := resourcecreator.CloneSource(obj)
+	if err != nil {
+		return resourcecreator.Clone{}, err
+	}
+	if !ok {
+		return resourcecreator.GetRestore(obj, r.Config)
+	}
+
+	source := &data_nais_io_v1.Postgres{}
+	if err := reader.Get(ctx, sourceKey, source); err != nil {
+		return resourcecreator.Clone{}, fmt.Errorf("getting clone source %s: %w", sourceKey, err)
+	}
+	return resourcecreator.GetClone(obj, source, r.Config)
+}
+
+// prepareMajorVersionUpgrade compares the requested major version with the existing cluster, and looks up the backup
+// to take before upgrading
+func (r *PostgresReconciler) prepareMajorVersionUpgrade(ctx context.Context, reader client.Reader, obj *data_nais_io_v1.Postgres, existing *acid_zalan_do_v1.Postgresql, pgClusterName, pgNamespace string) (resourcecreator.MajorVersionUpgrade, error) {
+	upgrade, err := resourcecreator.GetMajorVersionUpgrade(obj, existing, r.Config)
+	if err != nil || !upgrade.BackupRequested {
+		return upgrade, err
+	}
+
+	job := resourcecreator.MinimalUpgradeBackupJob(obj, upgrade, pgClusterName, pgNamespace)
+	err = reader.Get(ctx, client.ObjectKeyFromObject(job), job)
+	if err == nil {
+		upgrade.Backup = job
+		return upgrade, nil
+	} else if !apierrors.IsNotFound(err) {
+		return resourcecreator.MajorVersionUpgrade{}, fmt.Errorf("getting backup job: %w", err)
+	}
+
+	cronJob := resourcecreator.MinimalLogicalBackupCronJob(pgClusterName, pgNamespace)
+	if err := reader.Get(ctx, client.ObjectKeyFromObject(cronJob), cronJob); err != nil {
+		return resourcecreator.MajorVersionUpgrade{}, fmt.Errorf("getting logical backup job to back up before upgrading: %w", err)
+	}
+	upgrade.Backup = resourcecreator.CreateUpgradeBackupJobSpec(obj, upgrade, cronJob, pgClusterName, pgNamespace)
+	return upgrade, nil
+}
+
+// prepareDiskResize compares the requested disk size with the volumes of the existing cluster, and checks disk usage
+// when growing the disk automatically
+func (r *PostgresReconciler) prepareDiskResize(ctx context.Context, reader client.Reader, obj *data_nais_io_v1.Postgres, existing *acid_zalan_do_v1.Postgresql, pgClusterName, pgNamespace string) (resourcecreator.DiskResize, error) {
+	pvcs := &core_v1.PersistentVolumeClaimList{}
+	if existing != nil {
+		err := reader.List(ctx, pvcs, client.InNamespace(pgNamespace), client.MatchingLabels{
+			"application":  "spilo",
+			"cluster-name": pgClusterName,
+		})
+		if err != nil {
+			return resourcecreator.DiskResize{}, fmt.Errorf("listing volumes of existing cluster: %w", err)
+		}
+	}
+
+	disk, err := resourcecreator.GetDiskResize(obj, existing, pvcs.Items, r.Config)
+	if err != nil || !disk.AutoGrowEnabled() || r.Metrics == nil {
+		return disk, err
+	}
+
+	// The disk is kept as it is while usage is unknown, which must not hold back other changes
+	disk.UsageHigh, err = r.Metrics.HasResults(ctx, resourcecreator.DiskUsageHighQuery(pgClusterName, pgNamespace))
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "unable to check disk usage")
+	}
+	return disk, nil
+}
+
+// prepareUserGrants looks up the job granting the additional users their privileges. The job is kept for as long as
+// the users are requested, but only created once the cluster is running, as it connects to it.
+func (r *PostgresReconciler) prepareUserGrants(ctx context.Context, reader client.Reader, obj *data_nais_io_v1.Postgres, existing *acid_zalan_do_v1.Postgresql, databases []resourcecreator.Database, pgClusterName, pgNamespace string) (resourcecreator.UserGrants, error) {
+	users, err := resourcecreator.GetUsers(obj, databases)
+	if err != nil {
+		return resourcecreator.UserGrants{}, err
+	}
+	grants := resourcecreator.UserGrants{Users: users}
+	if !grants.Requested() || existing == nil {
+		return grants, nil
+	}
+
+	job := resourcecreator.MinimalUserGrantsJob(obj, users, pgClusterName, pgNamespace)
+	err = reader.Get(ctx, client.ObjectKeyFromObject(job), job)
+	if err == nil {
+		grants.Job = job
+		return grants, nil
+	} else if !apierrors.IsNotFound(err) {
+		return resourcecreator.UserGrants{}, fmt.Errorf("getting user grants job: %w", err)
+	}
+
+	if existing.Status.Running() {
+		grants.Job = resourcecreator.CreateUserGrantsJobSpec(obj, users, r.Config, pgClusterName, pgNamespace)
+	}
+	return grants, nil
+}
+
+// preparePasswordRotation looks up the secrets of the users having their passwords rotated, which Zalando keeps the
+// time of the next rotation in. They are not cached, see CacheByObject.
+func (r *PostgresReconciler) preparePasswordRotation(ctx context.Context, obj *data_nais_io_v1.Postgres, databases []resourcecreator.Database, users []resourcecreator.User, pgClusterName string) (resourcecreator.PasswordRotation, error) {
+	policy, err := resourcecreator.GetPasswordRotationPolicy(obj, databases, users, r.Config)
+	if err != nil {
+		return resourcecreator.PasswordRotation{}, err
+	}
+
+	secrets := map[string]*core_v1.Secret{}
+	for _, user := range policy.Users {
+		secret := resourcecreator.MinimalPasswordRotationSecret(obj, user, pgClusterName)
+		err := r.APIReader.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+		if err == nil {
+			secrets[user.RoleName] = secret
+		} else if !apierrors.IsNotFound(err) {
+			return resourcecreator.PasswordRotation{}, fmt.Errorf("getting secret of user %s: %w", user.RoleName, err)
+		}
+	}
+	return resourcecreator.GetPasswordRotation(policy, secrets, r.Config, time.Now()), nil
+}
+
+// prepareConnection looks up the credentials of the owner of the app database, which the connection secret is made from.
+// They are not cached, see CacheByObject.
+func (r *PostgresReconciler) prepareConnection(ctx context.Context, obj *data_nais_io_v1.Postgres, pgClusterName string) (resourcecreator.Connection, error) {
+	readReplicas, err := resourcecreator.ReadReplicasRequested(obj)
+	if err != nil {
+		return resourcecreator.Connection{}, err
+	}
+	connection := resourcecreator.Connection{
+		SecretName:   resourcecreator.ConnectionSecretName(obj.GetName()),
+		ReadReplicas: readReplicas,
+	}
+	secret := resourcecreator.MinimalConnectionUserSecret(obj, pgClusterName)
+	err = r.APIReader.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+	if err == nil {
+		connection.UserSecret = secret
+	} else if !apierrors.IsNotFound(err) {
+		return resourcecreator.Connection{}, fmt.Errorf("getting credentials for the connection secret: %w", err)
+	}
+	return connection, nil
+}
+
+// CacheByObject restricts the cache of jobs and secrets to those created by us, instead of every one in the cluster.
+// Other secrets, like those Zalando keeps credentials in, are read through the APIReader.
+func CacheByObject() (map[client.Object]cache.ByObject, error) {
+	created, err := labels.Parse(resourcecreator.NameLabel)
+	if err != nil {
+		return nil, err
+	}
+	return map[client.Object]cache.ByObject{
+		&batch_v1.Job{}:   {Label: created},
+		&core_v1.Secret{}: {Label: created},
+	}, nil
 }
 
 func (r *PostgresReconciler) OwnedTypes() []client.Object {
@@ -59,6 +316,11 @@ func (r *PostgresReconciler) AdditionalTypes() []client.Object {
 		&acid_zalan_do_v1.Postgresql{},
 		&networking_v1.NetworkPolicy{},
 		&iam_cnrm_cloud_google_com_v1beta1.IAMPolicyMember{},
+		&batch_v1.Job{},
+		&core_v1.Secret{},
+	}
+	if !r.Config.WalArchivingDisabled {
+		objects = append(objects, &storage_cnrm_cloud_google_com_v1beta1.StorageBucket{})
 	}
 	if !r.Config.PrometheusRulesDisabled {
 		objects = append(objects, &monitoring_v1.PrometheusRule{})
@@ -66,41 +328,140 @@ func (r *PostgresReconciler) AdditionalTypes() []client.Object {
 	return objects
 }
 
-func (r *PostgresReconciler) Update(obj *data_nais_io_v1.Postgres, _preparedData PreparedData) ([]action.Action, ctrl.Result, error) {
+func (r *PostgresReconciler) Update(obj *data_nais_io_v1.Postgres, preparedData PreparedData) ([]action.Action, ctrl.Result, error) {
 	var err error
 	pgClusterName, pgNamespace, err := getClusterNameAndNamespace(obj)
 	if err != nil {
 		return nil, ctrl.Result{}, err
 	}
 
-	ownerAnnotationKey := fmt.Sprintf("%s/owner", r.Name())
+	var actions []action.Action
+	netpol := resourcecreator.CreatePostgresNetworkPolicySpec(obj, pgClusterName, pgNamespace)
+	netpolAction := r.createOrUpdate(netpol, obj, existsConditionGetter)
+	actions = append(actions, netpolAction)
 
-	ns := obj.GetNamespace()
-	// cluster-scoped resources cannot have an empty namespace in the owner annotation
-	if ns == "" {
-		ns = "_"
+	// The cluster pods need the network policy in place to be able to talk to each other
+	cluster, err := resourcecreator.CreateClusterSpec(obj, r.Config, preparedData.Clone, pgClusterName, pgNamespace)
+	if err != nil {
+		return nil, ctrl.Result{}, err
+	}
+	preparedData.Upgrade.Apply(cluster, time.Now())
+	preparedData.Disk.Apply(cluster)
+	if preparedData.Disk.AutoGrowing() {
+		r.recordChange(obj, "GrowingDisk", "Disk usage is high, growing disk to %s", cluster.Spec.Volume.Size)
+	}
+	preparedData.DatabaseRemoval.Apply(cluster)
+	for _, name := range preparedData.DatabaseRemoval.Removed {
+		r.recordChange(obj, "RemovedDatabase", "Database %s is removed from the cluster, its data is left in Postgres", name)
+	}
+	preparedData.PasswordRotation.Apply(cluster)
+	clusterAction := r.createOrUpdate(cluster, obj, clusterConditionGetter(preparedData))
+	clusterAction.DependsOn(netpolAction)
+	actions = append(actions, clusterAction)
+
+	// Passwords due are marked for Zalando to rotate before the cluster is annotated, which has Zalando sync the secrets
+	for _, user := range preparedData.PasswordRotation.Due() {
+		secret := resourcecreator.CreateRotationSecretPatch(obj, user, pgClusterName)
+		rotationAction := action.Patch(secret, obj, noConditionGetter, r.Recorder)
+		clusterAction.DependsOn(rotationAction)
+		actions = append(actions, rotationAction)
+		r.recordChange(obj, "RotatingPassword", "Rotating password of user %s, last rotated at %s", user.RoleName, user.LastRotated.UTC().Format(time.RFC3339))
 	}
-	ownerAnnotationValue := fmt.Sprintf("%s/%s", ns, obj.GetName())
 
-	var actions []action.Action
-	cluster := resourcecreator.CreateClusterSpec(obj, r.Config, pgClusterName, pgNamespace)
-	meta_v1.SetMetaDataAnnotation(&cluster.ObjectMeta, ownerAnnotationKey, ownerAnnotationValue)
-	actions = append(actions, action.CreateOrUpdate(cluster, obj, postgresqlConditionGetter, r.Recorder))
+	// The new major version is held back until the backup has succeeded
+	if preparedData.Upgrade.Backup != nil {
+		actions = append(actions, action.CreateIfNotExists(preparedData.Upgrade.Backup, obj, existsConditionGetter, r.Recorder))
+	}
 
-	netpol := resourcecreator.CreatePostgresNetworkPolicySpec(obj, pgClusterName, pgNamespace)
-	meta_v1.SetMetaDataAnnotation(&netpol.ObjectMeta, ownerAnnotationKey, ownerAnnotationValue)
-	actions = append(actions, action.CreateOrUpdate(netpol, obj, existsConditionGetter, r.Recorder))
+	// The users are granted their privileges once Zalando has created them
+	if preparedData.UserGrants.Job != nil {
+		grantsAction := action.CreateIfNotExists(preparedData.UserGrants.Job, obj, existsConditionGetter, r.Recorder)
+		grantsAction.DependsOn(clusterAction)
+		actions = append(actions, grantsAction)
+	}
+
+	// WAL is archived from the first start of the cluster, so the bucket and access to it must be in place
+	if !r.Config.WalArchivingDisabled {
+		bucket := resourcecreator.CreateWalBucketSpec(obj, r.Config, pgClusterName, pgNamespace)
+		bucketAction := r.createOrUpdate(bucket, obj, existsConditionGetter)
+		actions = append(actions, bucketAction)
+
+		bucketIAM := resourcecreator.CreateWalBucketIAMPolicyMemberSpec(obj, r.Config, pgClusterName, pgNamespace)
+		bucketIAMAction := r.createOrUpdate(bucketIAM, obj, iamPolicyMemberConditionGetter)
+		bucketIAMAction.DependsOn(bucketAction)
+		actions = append(actions, bucketIAMAction)
+
+		clusterAction.DependsOn(bucketIAMAction)
+	}
+
+	// Zalando creates the CronJob for logical backups, we only report how it is doing
+	backupCronJob := resourcecreator.MinimalLogicalBackupCronJob(pgClusterName, pgNamespace)
+	backupAction := action.Observe(backupCronJob, obj, logicalBackupConditionGetter(cluster.Spec.EnableLogicalBackup), r.Recorder)
+	backupAction.DependsOn(clusterAction)
+	actions = append(actions, backupAction)
+
+	// The connection secret is kept as it is until Zalando has created the credentials it is made from
+	if preparedData.Connection.Ready() {
+		connectionSecret := resourcecreator.CreateConnectionSecretSpec(obj, preparedData.Connection, pgClusterName, pgNamespace)
+		actions = append(actions, r.createOrUpdate(connectionSecret, obj, noConditionGetter))
+	} else {
+		actions = append(actions, action.NoOp(resourcecreator.MinimalConnectionSecret(obj), obj, noConditionGetter, r.Recorder))
+	}
 
 	iam := resourcecreator.CreateIAMPolicyMemberSpec(obj, r.Config, pgNamespace)
 	actions = append(actions, action.CreateIfNotExists(iam, obj, iamPolicyMemberConditionGetter, r.Recorder))
 
 	if !r.Config.PrometheusRulesDisabled {
-		prometheusRule := resourcecreator.CreatePrometheusRuleSpec(obj, pgClusterName, pgNamespace)
-		meta_v1.SetMetaDataAnnotation(&prometheusRule.ObjectMeta, ownerAnnotationKey, ownerAnnotationValue)
-		actions = append(actions, action.CreateOrUpdate(prometheusRule, obj, existsConditionGetter, r.Recorder))
+		prometheusRule := resourcecreator.CreatePrometheusRuleSpec(obj, r.Config, pgClusterName, pgNamespace)
+		actions = append(actions, r.createOrUpdate(prometheusRule, obj, existsConditionGetter))
 	}
 
-	return actions, ctrl.Result{}, nil
+	// Volumes are not watched, so resizing and disk usage are followed by checking regularly
+	result := ctrl.Result{}
+	if preparedData.Disk.Resizing() {
+		result.RequeueAfter = diskResizeRequeueInterval
+	} else if preparedData.Disk.AutoGrowEnabled() {
+		result.RequeueAfter = diskUsageRequeueInterval
+	}
+
+	// Secrets are not watched either, so rotations are followed until done, and otherwise checked when next due
+	rotation := preparedData.PasswordRotation
+	if rotation.InProgress() {
+		requeueWithin(&result, passwordRotationRequeueInterval)
+	} else if next := rotation.NextDue(); !next.IsZero() {
+		requeueWithin(&result, next.Sub(rotation.Now))
+	}
+	if !preparedData.Connection.Ready() {
+		requeueWithin(&result, connectionRequeueInterval)
+	} else {
+		requeueWithin(&result, connectionRefreshInterval)
+	}
+
+	return actions, result, nil
+}
+
+// recordChange records an event about a change Update is about to make, unless changes are only planned
+func (r *PostgresReconciler) recordChange(obj *data_nais_io_v1.Postgres, reason string, messageFmt string, args ...any) {
+	if r.Config.PlanMode {
+		return
+	}
+	r.Recorder.RecordEvent(obj, core_v1.EventTypeNormal, reason, messageFmt, args...)
+}
+
+// requeueWithin makes result requeue after at most d, keeping any earlier requeue
+func requeueWithin(result *ctrl.Result, d time.Duration) {
+	if d > 0 && (result.RequeueAfter == 0 || d < result.RequeueAfter) {
+		result.RequeueAfter = d
+	}
+}
+
+// createOrUpdate picks server-side apply or a plain update for obj, depending on configuration for its kind
+func (r *PostgresReconciler) createOrUpdate(obj client.Object, owner *data_nais_io_v1.Postgres, conditionGetter action.ConditionGetter) action.Action {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if r.Config.UseServerSideApply(kind) {
+		return action.Apply(obj, owner, r.Name(), r.Config.ForceServerSideApply(kind), conditionGetter, r.Recorder)
+	}
+	return action.CreateOrUpdate(obj, owner, conditionGetter, r.Recorder)
 }
 
 func iamPolicyMemberConditionGetter(obj client.Object) []meta_v1.Condition {
@@ -146,6 +507,11 @@ func iamPolicyMemberConditionGetter(obj client.Object) []meta_v1.Condition {
 	return result
 }
 
+// noConditionGetter is for actions whose outcome is reported by the conditions of other actions
+func noConditionGetter(client.Object) []meta_v1.Condition {
+	return nil
+}
+
 func makeCondition(value bool) meta_v1.ConditionStatus {
 	if value {
 		return meta_v1.ConditionTrue
@@ -203,6 +569,325 @@ func postgresqlConditionGetter(obj client.Object) []meta_v1.Condition {
 	return result
 }
 
+// clusterConditionGetter adds conditions tracking a clone or point-in-time restore, major version upgrades, disk resizing,
+// extensions left out of the cluster, databases no longer requested, additional users, password rotation and the
+// connection secret
+func clusterConditionGetter(preparedData PreparedData) action.ConditionGetter {
+	return func(obj client.Object) []meta_v1.Condition {
+		pg := obj.(*acid_zalan_do_v1.Postgresql)
+		return append(postgresqlConditionGetter(obj),
+			cloneCondition(pg, preparedData.Clone),
+			majorVersionUpgradeCondition(pg, preparedData.Upgrade),
+			diskSizeCondition(pg, preparedData.Disk),
+			extensionsCondition(pg, preparedData.Databases),
+			databasesCondition(pg, preparedData.Databases, preparedData.DatabaseRemoval),
+			userGrantsCondition(pg, preparedData.UserGrants),
+			passwordRotationCondition(pg, preparedData.PasswordRotation),
+			connectionCondition(pg, preparedData.Connection),
+		)
+	}
+}
+
+// cloneCondition reports on a clone or point-in-time restore, which is done once the new cluster has been created
+func cloneCondition(pg *acid_zalan_do_v1.Postgresql, clone resourcecreator.Clone) meta_v1.Condition {
+	typePrefix := strings.ToLower(pg.GetObjectKind().GroupVersionKind().GroupKind().String())
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/Restored", typePrefix),
+		Status:             meta_v1.ConditionFalse,
+		ObservedGeneration: pg.GetGeneration(),
+	}
+
+	switch {
+	case !clone.Requested():
+		condition.Status = meta_v1.ConditionUnknown
+		condition.Reason = "NotRequested"
+		condition.Message = "No clone or point-in-time restore requested"
+	case len(pg.GetResourceVersion()) == 0,
+		pg.Status.PostgresClusterStatus == acid_zalan_do_v1.ClusterStatusUnknown,
+		pg.Status.PostgresClusterStatus == acid_zalan_do_v1.ClusterStatusCreating:
+		condition.Reason = "Restoring"
+		condition.Message = fmt.Sprintf("Restoring from %s", clone)
+	case pg.Status.PostgresClusterStatus == acid_zalan_do_v1.ClusterStatusAddFailed,
+		pg.Status.PostgresClusterStatus == acid_zalan_do_v1.ClusterStatusInvalid:
+		condition.Reason = "Failed"
+		condition.Message = fmt.Sprintf("Restore from %s failed: %s", clone, pg.Status.String())
+	case pg.Status.Running():
+		condition.Status = meta_v1.ConditionTrue
+		condition.Reason = "Restored"
+		condition.Message = fmt.Sprintf("Restored from %s", clone)
+	default:
+		// Zalando only reports a running cluster once it is up, and the restored data is available
+		condition.Reason = "NotRunning"
+		condition.Message = fmt.Sprintf("Cluster restored from %s is not running: %s", clone, pg.Status.String())
+	}
+	return condition
+}
+
+// majorVersionUpgradeCondition reports on the last major version upgrade, from the backup taken first until Zalando
+// reports the outcome
+func majorVersionUpgradeCondition(pg *acid_zalan_do_v1.Postgresql, upgrade resourcecreator.MajorVersionUpgrade) meta_v1.Condition {
+	typePrefix := strings.ToLower(pg.GetObjectKind().GroupVersionKind().GroupKind().String())
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/MajorVersionUpgraded", typePrefix),
+		Status:             meta_v1.ConditionFalse,
+		ObservedGeneration: pg.GetGeneration(),
+	}
+
+	// Zalando annotates the time of the last attempt, which may be from an earlier upgrade
+	annotatedSinceStarted := func(key string) bool {
+		t, err := time.Parse(time.RFC3339, pg.GetAnnotations()[key])
+		return err == nil && !upgrade.Started.IsZero() && !t.Before(upgrade.Started)
+	}
+
+	switch {
+	case !upgrade.Requested():
+		condition.Status = meta_v1.ConditionTrue
+		condition.Reason = "UpToDate"
+		condition.Message = fmt.Sprintf("Running major version %s", pg.Spec.PgVersion)
+	case pg.Spec.PgVersion != upgrade.To && upgrade.BackupFailed():
+		condition.Reason = "BackupFailed"
+		condition.Message = fmt.Sprintf("Backup before upgrading from %s to %s failed, see job %s/%s", upgrade.From, upgrade.To, upgrade.Backup.GetNamespace(), upgrade.Backup.GetName())
+	case pg.Spec.PgVersion != upgrade.To:
+		condition.Reason = "BackingUp"
+		condition.Message = fmt.Sprintf("Taking a backup before upgrading from %s to %s", upgrade.From, upgrade.To)
+	case annotatedSinceStarted(resourcecreator.MajorUpgradeFailureAnnotation):
+		condition.Reason = "Failed"
+		condition.Message = fmt.Sprintf("Upgrade from %s to %s failed at %s, remove the annotation %s from the cluster to retry", upgrade.From, upgrade.To, pg.GetAnnotations()[resourcecreator.MajorUpgradeFailureAnnotation], resourcecreator.MajorUpgradeFailureAnnotation)
+	case annotatedSinceStarted(resourcecreator.MajorUpgradeSuccessAnnotation):
+		condition.Status = meta_v1.ConditionTrue
+		condition.Reason = "Succeeded"
+		condition.Message = fmt.Sprintf("Upgraded from %s to %s at %s", upgrade.From, upgrade.To, pg.GetAnnotations()[resourcecreator.MajorUpgradeSuccessAnnotation])
+	default:
+		condition.Reason = "Upgrading"
+		condition.Message = fmt.Sprintf("Upgrading from %s to %s in the next maintenance window", upgrade.From, upgrade.To)
+	}
+	return condition
+}
+
+// diskSizeCondition reports on resizing the volumes, and requests to shrink them which are not possible
+func diskSizeCondition(pg *acid_zalan_do_v1.Postgresql, disk resourcecreator.DiskResize) meta_v1.Condition {
+	typePrefix := strings.ToLower(pg.GetObjectKind().GroupVersionKind().GroupKind().String())
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/DiskSize", typePrefix),
+		Status:             meta_v1.ConditionFalse,
+		ObservedGeneration: pg.GetGeneration(),
+	}
+
+	size := disk.Size()
+	switch {
+	case disk.ShrinkRejected():
+		condition.Reason = "ShrinkRejected"
+		condition.Message = fmt.Sprintf("Disk cannot be shrunk from %s to %s, keeping %s", disk.Current, &disk.Requested, &size)
+	case disk.Resizing():
+		condition.Reason = "Resizing"
+		condition.Message = fmt.Sprintf("Resizing disk from %s to %s", disk.Capacity, &size)
+	case disk.AutoGrowLimitReached():
+		condition.Reason = "AutoGrowLimitReached"
+		condition.Message = fmt.Sprintf("Disk usage is high, and the disk is already grown to the limit of %s set by %s", disk.AutoGrowMax, resourcecreator.DiskAutoGrowMaxAnnotation)
+	case size.Cmp(disk.Requested) > 0:
+		condition.Status = meta_v1.ConditionTrue
+		condition.Reason = "AutoGrown"
+		condition.Message = fmt.Sprintf("Disk is %s, grown automatically from the requested %s", &size, &disk.Requested)
+	default:
+		condition.Status = meta_v1.ConditionTrue
+		condition.Reason = "UpToDate"
+		condition.Message = fmt.Sprintf("Disk is %s", &size)
+	}
+	return condition
+}
+
+// userGrantsCondition reports on granting the additional users their privileges, telling where their secrets are
+func userGrantsCondition(pg *acid_zalan_do_v1.Postgresql, grants resourcecreator.UserGrants) meta_v1.Condition {
+	typePrefix := strings.ToLower(pg.GetObjectKind().GroupVersionKind().GroupKind().String())
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/UsersGranted", typePrefix),
+		Status:             meta_v1.ConditionFalse,
+		ObservedGeneration: pg.GetGeneration(),
+	}
+
+	secrets := make([]string, 0, len(grants.Users))
+	for _, user := range grants.Users {
+		secrets = append(secrets, resourcecreator.UserSecretName(user, pg.GetName()))
+	}
+
+	switch {
+	case !grants.Requested():
+		condition.Status = meta_v1.ConditionUnknown
+		condition.Reason = "NotRequested"
+		condition.Message = "No additional users requested"
+	case grants.Job == nil:
+		condition.Reason = "WaitingForCluster"
+		condition.Message = "Waiting for the cluster to be running to grant privileges to the users"
+	case grants.Failed():
+		condition.Reason = "Failed"
+		condition.Message = fmt.Sprintf("Granting privileges to the users failed, see job %s/%s", grants.Job.GetNamespace(), grants.Job.GetName())
+	case grants.Done():
+		condition.Status = meta_v1.ConditionTrue
+		condition.Reason = "Granted"
+		condition.Message = fmt.Sprintf("Users are granted their privileges, with credentials in secrets %s", strings.Join(secrets, ", "))
+	default:
+		condition.Reason = "Granting"
+		condition.Message = "Granting privileges to the users"
+	}
+	return condition
+}
+
+// passwordRotationCondition reports on rotating the passwords of the users, telling when each was last rotated
+func passwordRotationCondition(pg *acid_zalan_do_v1.Postgresql, rotation resourcecreator.PasswordRotation) meta_v1.Condition {
+	typePrefix := strings.ToLower(pg.GetObjectKind().GroupVersionKind().GroupKind().String())
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/PasswordsRotated", typePrefix),
+		Status:             meta_v1.ConditionFalse,
+		ObservedGeneration: pg.GetGeneration(),
+	}
+
+	var rotating, waiting, rotated []string
+	for _, user := range rotation.Users {
+		switch {
+		case user.Secret == nil:
+			waiting = append(waiting, user.RoleName)
+		case user.Pending || !user.Due.After(rotation.Now):
+			rotating = append(rotating, user.RoleName)
+		default:
+			description := fmt.Sprintf("%s at %s", user.RoleName, user.LastRotated.UTC().Format(time.RFC3339))
+			if user.InPlace {
+				description += " in place"
+			}
+			rotated = append(rotated, description)
+		}
+	}
+
+	switch {
+	case !rotation.Policy.Enabled():
+		condition.Status = meta_v1.ConditionUnknown
+		condition.Reason = "NotEnabled"
+		condition.Message = fmt.Sprintf("Password rotation is not enabled, see the annotations %s and %s", resourcecreator.PasswordRotationIntervalAnnotation, resourcecreator.RotatePasswordsAnnotation)
+	case len(rotating) > 0:
+		condition.Reason = "Rotating"
+		condition.Message = fmt.Sprintf("Rotating passwords of users %s", strings.Join(rotating, ", "))
+	case len(waiting) > 0:
+		condition.Reason = "WaitingForSecrets"
+		condition.Message = fmt.Sprintf("Waiting for the secrets of users %s to be created", strings.Join(waiting, ", "))
+		if len(rotated) > 0 {
+			condition.Message += fmt.Sprintf(". Passwords last rotated: %s", strings.Join(rotated, ", "))
+		}
+	default:
+		condition.Status = meta_v1.ConditionTrue
+		condition.Reason = "Rotated"
+		condition.Message = fmt.Sprintf("Passwords last rotated: %s. Next rotation at %s", strings.Join(rotated, ", "), rotation.NextDue().UTC().Format(time.RFC3339))
+	}
+	return condition
+}
+
+// connectionCondition tells where applications find the connection details, once Zalando has created the credentials
+func connectionCondition(pg *acid_zalan_do_v1.Postgresql, connection resourcecreator.Connection) meta_v1.Condition {
+	typePrefix := strings.ToLower(pg.GetObjectKind().GroupVersionKind().GroupKind().String())
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/ConnectionSecretReady", typePrefix),
+		Status:             meta_v1.ConditionTrue,
+		Reason:             "Ready",
+		Message:            fmt.Sprintf("Connection details are in secret %s", connection.SecretName),
+		ObservedGeneration: pg.GetGeneration(),
+	}
+	if !connection.Ready() {
+		condition.Status = meta_v1.ConditionFalse
+		condition.Reason = "WaitingForCredentials"
+		condition.Message = fmt.Sprintf("Waiting for the credentials of the owner of the app database, to create secret %s", connection.SecretName)
+	}
+	return condition
+}
+
+// extensionsCondition reports on requested extensions that are not available in the major version, and are left out
+func extensionsCondition(pg *acid_zalan_do_v1.Postgresql, databases []resourcecreator.Database) meta_v1.Condition {
+	typePrefix := strings.ToLower(pg.GetObjectKind().GroupVersionKind().GroupKind().String())
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/ExtensionsEnabled", typePrefix),
+		Status:             meta_v1.ConditionTrue,
+		Reason:             "Enabled",
+		Message:            "All requested extensions are enabled",
+		ObservedGeneration: pg.GetGeneration(),
+	}
+
+	var rejected []string
+	for _, database := range databases {
+		if len(database.Extensions.Rejected) > 0 {
+			rejected = append(rejected, fmt.Sprintf("%s in database %s", strings.Join(database.Extensions.Rejected, ", "), database.Name))
+		}
+	}
+	if len(rejected) > 0 {
+		condition.Status = meta_v1.ConditionFalse
+		condition.Reason = "Rejected"
+		condition.Message = fmt.Sprintf("Extensions %s are not available in major version %s", strings.Join(rejected, "; "), databases[0].Extensions.MajorVersion)
+	}
+	return condition
+}
+
+// databasesCondition reports on databases no longer requested, which are kept until their removal is confirmed
+func databasesCondition(pg *acid_zalan_do_v1.Postgresql, databases []resourcecreator.Database, removal resourcecreator.DatabaseRemoval) meta_v1.Condition {
+	typePrefix := strings.ToLower(pg.GetObjectKind().GroupVersionKind().GroupKind().String())
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/DatabasesPrepared", typePrefix),
+		Status:             meta_v1.ConditionTrue,
+		Reason:             "UpToDate",
+		ObservedGeneration: pg.GetGeneration(),
+	}
+
+	names := make([]string, 0, len(databases))
+	for _, database := range databases {
+		names = append(names, database.Name)
+	}
+	condition.Message = fmt.Sprintf("Databases %s are prepared", strings.Join(names, ", "))
+
+	if retained := removal.RetainedNames(); len(retained) > 0 {
+		condition.Status = meta_v1.ConditionFalse
+		condition.Reason = "RemovalNotConfirmed"
+		condition.Message = fmt.Sprintf("Databases %s are no longer requested, and are kept until their removal is confirmed in the annotation %s", strings.Join(retained, ", "), resourcecreator.RemoveDatabasesAnnotation)
+	}
+	return condition
+}
+
+// logicalBackupConditionGetter reports whether the latest scheduled logical backup succeeded
+func logicalBackupConditionGetter(enabled bool) action.ConditionGetter {
+	return func(obj client.Object) []meta_v1.Condition {
+		typePrefix := strings.ToLower(obj.GetObjectKind().GroupVersionKind().GroupKind().String())
+		condition := meta_v1.Condition{
+			Type:               fmt.Sprintf("%s/LogicalBackupHealthy", typePrefix),
+			Status:             meta_v1.ConditionTrue,
+			ObservedGeneration: obj.GetGeneration(),
+		}
+
+		cronJob := obj.(*batch_v1.CronJob)
+		status := cronJob.Status
+		switch {
+		case !enabled:
+			condition.Status = meta_v1.ConditionUnknown
+			condition.Reason = "Disabled"
+			condition.Message = "Logical backups are disabled"
+		case len(cronJob.GetResourceVersion()) == 0:
+			condition.Status = meta_v1.ConditionUnknown
+			condition.Reason = "Pending"
+			condition.Message = "Waiting for the logical backup job to be created"
+		case status.LastScheduleTime == nil:
+			condition.Reason = "NotYetScheduled"
+			condition.Message = fmt.Sprintf("First logical backup is scheduled for %q", cronJob.Spec.Schedule)
+		case status.LastSuccessfulTime != nil && !status.LastSuccessfulTime.Before(status.LastScheduleTime):
+			condition.Reason = "Succeeded"
+			condition.Message = fmt.Sprintf("Last logical backup succeeded at %s", status.LastSuccessfulTime.UTC().Format(time.RFC3339))
+		case len(status.Active) > 0:
+			condition.Reason = "Running"
+			condition.Message = fmt.Sprintf("Logical backup scheduled at %s is running", status.LastScheduleTime.UTC().Format(time.RFC3339))
+		default:
+			condition.Status = meta_v1.ConditionFalse
+			condition.Reason = "Failed"
+			condition.Message = fmt.Sprintf("Logical backup scheduled at %s did not succeed", status.LastScheduleTime.UTC().Format(time.RFC3339))
+			if status.LastSuccessfulTime != nil {
+				condition.Message += fmt.Sprintf(", last successful backup at %s", status.LastSuccessfulTime.UTC().Format(time.RFC3339))
+			}
+		}
+		return []meta_v1.Condition{condition}
+	}
+}
+
 func (r *PostgresReconciler) Delete(obj *data_nais_io_v1.Postgres) ([]action.Action, ctrl.Result, error) {
 	actionFunc := action.DeleteIfExists
 	if !obj.Spec.Cluster.AllowDeletion {
@@ -218,10 +903,38 @@ func (r *PostgresReconciler) Delete(obj *data_nais_io_v1.Postgres) ([]action.Act
 	var actions []action.Action
 
 	cluster := resourcecreator.MinimalCluster(obj, pgClusterName, pgNamespace)
-	actions = append(actions, actionFunc(cluster, obj, postgresqlConditionGetter, r.Recorder))
+	clusterAction := actionFunc(cluster, obj, postgresqlConditionGetter, r.Recorder)
+	actions = append(actions, clusterAction)
 
+	// Delete the network policy after the cluster. This only waits for the deletion of the cluster to be accepted, not
+	// for Zalando to stop its pods, which may run for a little while without the network policy
 	netpol := resourcecreator.MinimalNetpol(obj, pgClusterName, pgNamespace)
-	actions = append(actions, actionFunc(netpol, obj, existsConditionGetter, r.Recorder))
+	netpolAction := actionFunc(netpol, obj, existsConditionGetter, r.Recorder)
+	netpolAction.DependsOn(clusterAction)
+	actions = append(actions, netpolAction)
+
+	// Backups are only deleted once the deletion of the cluster is accepted
+	if !r.Config.WalArchivingDisabled {
+		bucket := resourcecreator.MinimalWalBucket(obj, pgClusterName, pgNamespace)
+		bucketAction := actionFunc(bucket, obj, existsConditionGetter, r.Recorder)
+		bucketAction.DependsOn(clusterAction)
+		actions = append(actions, bucketAction)
+
+		bucketIAM := resourcecreator.MinimalWalBucketIAMPolicyMember(obj, pgClusterName, pgNamespace)
+		bucketIAMAction := actionFunc(bucketIAM, obj, iamPolicyMemberConditionGetter, r.Recorder)
+		bucketIAMAction.DependsOn(clusterAction)
+		actions = append(actions, bucketIAMAction)
+	}
+
+	// The connection secret is only useful as long as the cluster is kept
+	connectionSecret := resourcecreator.MinimalConnectionSecret(obj)
+	connectionAction := actionFunc(connectionSecret, obj, noConditionGetter, r.Recorder)
+	connectionAction.DependsOn(clusterAction)
+	actions = append(actions, connectionAction)
+
+	// The IAMPolicyMember is shared by all clusters in the namespace, and must never be deleted along with one of them
+	iam := resourcecreator.CreateMinimalIAMPolicyMember(obj, pgNamespace)
+	actions = append(actions, action.NoOp(iam, obj, iamPolicyMemberConditionGetter, r.Recorder))
 
 	if !r.Config.PrometheusRulesDisabled {
 		prometheusRule := resourcecreator.MinimalPrometheusRule(obj, pgClusterName)
@@ -232,14 +945,9 @@ func (r *PostgresReconciler) Delete(obj *data_nais_io_v1.Postgres) ([]action.Act
 }
 
 func getClusterNameAndNamespace(obj *data_nais_io_v1.Postgres) (string, string, error) {
-	var err error
-	pgClusterName := obj.GetName()
-	if len(pgClusterName) > maxClusterNameLength {
-		pgClusterName, err = namegen.ShortName(pgClusterName, maxClusterNameLength)
-		if err != nil {
-			return "", "", fmt.Errorf("failed to shorten PostgreSQL cluster name: %w", err)
-		}
+	pgClusterName, err := resourcecreator.ClusterName(obj.GetName())
+	if err != nil {
+		return "", "", err
 	}
-	pgNamespace := fmt.Sprintf("pg-%s", obj.GetNamespace())
-	return pgClusterName, pgNamespace, nil
+	return pgClusterName, resourcecreator.ClusterNamespace(obj.GetNamespace()), nil
 }
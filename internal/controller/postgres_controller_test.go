@@ -2,20 +2,24 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
 	iam_google_v1beta1 "github.com/nais/liberator/pkg/apis/iam.cnrm.cloud.google.com/v1beta1"
+	storage_cnrm_cloud_google_com_v1beta1 "github.com/nais/liberator/pkg/apis/storage.cnrm.cloud.google.com/v1beta1"
 	"github.com/nais/pgrator/internal/config"
 	"github.com/nais/pgrator/internal/synchronizer"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	batch_v1 "k8s.io/api/batch/v1"
 	core_v1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -61,7 +65,7 @@ var _ = Describe("Postgres Controller", func() {
 
 		BeforeEach(func() {
 			By("creating the synchronizer for postgres")
-			controllerReconciler = synchronizer.NewSynchronizer(k8sClient, k8sClient.Scheme(), &PostgresReconciler{Config: &reconcilerConfig, Recorder: recorder}, recorder)
+			controllerReconciler = synchronizer.NewSynchronizer(k8sClient, k8sClient.Scheme(), &PostgresReconciler{Config: &reconcilerConfig, Recorder: recorder, APIReader: k8sClient}, recorder)
 
 			By("creating the postgres namespace")
 			ensureNamespaceExists(postgresNamespace)
@@ -84,10 +88,7 @@ var _ = Describe("Postgres Controller", func() {
 
 				By("Cleanup the specific resource instance Postgres")
 				Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
-				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
-					NamespacedName: deletableResourceKey,
-				})
-				Expect(err).NotTo(HaveOccurred())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
 			})
 
 			It("should successfully reconcile the resource", func() {
@@ -111,6 +112,698 @@ var _ = Describe("Postgres Controller", func() {
 				// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
 				// Example: If you expect a certain status condition after reconciliation, verify it here.
 			})
+
+			It("should set the owner annotation on all generated resources", func() {
+				By("Reconciling the created resource")
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+
+				ownerAnnotation := HaveKeyWithValue("postgres.data.nais.io/owner", deletableResourceKey.String())
+
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.GetAnnotations()).To(ownerAnnotation)
+
+				netpol := &v1.NetworkPolicy{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, netpol)).To(Succeed())
+				Expect(netpol.GetAnnotations()).To(ownerAnnotation)
+
+				iamList := &iam_google_v1beta1.IAMPolicyMemberList{}
+				Expect(k8sClient.List(ctx, iamList, client.InNamespace(serviceAccountsNamespace))).To(Succeed())
+				Expect(iamList.Items).To(ContainElement(HaveField("ObjectMeta.Annotations", HaveKey("postgres.data.nais.io/owner"))))
+			})
+
+			It("should use server-side apply for configured kinds", func() {
+				By("Reconciling with server-side apply enabled for postgresql")
+				ssaConfig := config.Config{
+					PrometheusRulesDisabled: true,
+					ServerSideApplyKinds:    []string{"postgresql"},
+				}
+				ssaReconciler := synchronizer.NewSynchronizer(k8sClient, k8sClient.Scheme(), &PostgresReconciler{Config: &ssaConfig, Recorder: recorder, APIReader: k8sClient}, recorder)
+				ensureReconciled(deletableResourceKey, ssaReconciler)
+
+				By("Checking that the cluster is managed by the reconciler field manager")
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				err := k8sClient.Get(ctx, deletableClusterKey, cluster)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cluster.GetManagedFields()).To(ContainElement(And(
+					HaveField("Manager", "postgres.data.nais.io"),
+					HaveField("Operation", metav1.ManagedFieldsOperationApply),
+				)))
+			})
+
+			It("should create a bucket for WAL archiving", func() {
+				By("Reconciling the created resource")
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+
+				bucket := &storage_cnrm_cloud_google_com_v1beta1.StorageBucket{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: postgresNamespace, Name: deletableName + "-wal"}, bucket)).To(Succeed())
+
+				bucketIAM := &iam_google_v1beta1.IAMPolicyMember{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: postgresNamespace, Name: deletableName + "-wal"}, bucketIAM)).To(Succeed())
+				Expect(bucketIAM.Spec.ResourceRef.Kind).To(Equal("StorageBucket"))
+
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.Env).To(ContainElement(HaveField("Name", "WAL_GS_BUCKET")))
+			})
+
+			It("should configure logical backups and report their health", func() {
+				By("Reconciling with logical backups enabled by default")
+				backupConfig := config.Config{
+					PrometheusRulesDisabled: true,
+					LogicalBackupSchedule:   "30 0 * * *",
+				}
+				backupReconciler := synchronizer.NewSynchronizer(k8sClient, k8sClient.Scheme(), &PostgresReconciler{Config: &backupConfig, Recorder: recorder, APIReader: k8sClient}, recorder)
+				ensureReconciled(deletableResourceKey, backupReconciler)
+
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.EnableLogicalBackup).To(BeTrue())
+				Expect(cluster.Spec.LogicalBackupSchedule).To(Equal("30 0 * * *"))
+
+				By("Checking that health is pending until the backup job exists")
+				resource := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "cronjob.batch/LogicalBackupHealthy"),
+					HaveField("Reason", "Pending"),
+				)))
+
+				By("Creating a backup job whose last run failed")
+				cronJob := &batch_v1.CronJob{
+					ObjectMeta: metav1.ObjectMeta{Name: "logical-backup-" + deletableName, Namespace: postgresNamespace},
+					Spec: batch_v1.CronJobSpec{
+						Schedule: "30 0 * * *",
+						JobTemplate: batch_v1.JobTemplateSpec{
+							Spec: batch_v1.JobSpec{
+								Template: core_v1.PodTemplateSpec{
+									Spec: core_v1.PodSpec{
+										RestartPolicy: core_v1.RestartPolicyNever,
+										Containers:    []core_v1.Container{{Name: "backup", Image: "backup"}},
+									},
+								},
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, cronJob)).To(Succeed())
+				cronJob.Status.LastScheduleTime = ptr.To(metav1.Now())
+				Expect(k8sClient.Status().Update(ctx, cronJob)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, cronJob)).To(Succeed())
+				})
+
+				ensureReconciled(deletableResourceKey, backupReconciler)
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "cronjob.batch/LogicalBackupHealthy"),
+					HaveField("Status", metav1.ConditionFalse),
+					HaveField("Reason", "Failed"),
+				)))
+			})
+
+			It("should restore to a point in time and track the restore", func() {
+				By("Requesting a restore from another cluster")
+				resource := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				metav1.SetMetaDataAnnotation(&resource.ObjectMeta, "postgres.data.nais.io/restore-from", undeletableName)
+				metav1.SetMetaDataAnnotation(&resource.ObjectMeta, "postgres.data.nais.io/restore-timestamp", "2025-03-01T12:00:00Z")
+				Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.Clone).NotTo(BeNil())
+				Expect(cluster.Spec.Clone.ClusterName).To(Equal(undeletableName))
+				Expect(cluster.Spec.Clone.EndTimestamp).To(Equal("2025-03-01T12:00:00+00:00"))
+				Expect(cluster.Spec.Env).To(ContainElement(HaveField("Name", "CLONE_WAL_GS_BUCKET")))
+
+				By("Checking that the restore is in progress until the cluster is running")
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/Restored"),
+					HaveField("Status", metav1.ConditionFalse),
+					HaveField("Reason", "Restoring"),
+				)))
+
+				cluster.Status.PostgresClusterStatus = acid_zalan_do_v1.ClusterStatusSyncFailed
+				Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/Restored"),
+					HaveField("Status", metav1.ConditionFalse),
+					HaveField("Reason", "NotRunning"),
+				)))
+
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				cluster.Status.PostgresClusterStatus = acid_zalan_do_v1.ClusterStatusRunning
+				Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/Restored"),
+					HaveField("Status", metav1.ConditionTrue),
+				)))
+			})
+
+			It("should only clone from other namespaces when allowed by the source", func() {
+				By("Creating a source in another namespace")
+				sourceKey := types.NamespacedName{Namespace: "source-team", Name: "source"}
+				ensureNamespaceExists(sourceKey.Namespace)
+				ensurePostgresExists(sourceKey, true)
+				source := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, sourceKey, source)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, source)).To(Succeed())
+				})
+
+				By("Requesting a clone without permission from the source")
+				resource := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				metav1.SetMetaDataAnnotation(&resource.ObjectMeta, "postgres.data.nais.io/clone-from", sourceKey.String())
+				Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: deletableResourceKey})
+				Expect(err).To(MatchError(reconcile.TerminalError(nil)))
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgres.data.nais.io/Degraded"),
+					HaveField("Status", metav1.ConditionTrue),
+					HaveField("Message", ContainSubstring("does not allow cloning")),
+				)))
+
+				By("Allowing the clone in the source")
+				metav1.SetMetaDataAnnotation(&source.ObjectMeta, "postgres.data.nais.io/allow-clone-to", resourceNamespace)
+				Expect(k8sClient.Update(ctx, source)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.Clone).NotTo(BeNil())
+				Expect(cluster.Spec.Clone.ClusterName).To(Equal(sourceKey.Name))
+				Expect(cluster.Spec.Env).To(ContainElement(And(
+					HaveField("Name", "CLONE_WAL_GS_BUCKET"),
+					HaveField("Value", ContainSubstring("pg-source-team-source")),
+				)))
+
+				By("Keeping the clone once the cluster exists, without checking the source again")
+				delete(source.Annotations, "postgres.data.nais.io/allow-clone-to")
+				Expect(k8sClient.Update(ctx, source)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.Clone).NotTo(BeNil())
+				Expect(cluster.Spec.Clone.ClusterName).To(Equal(sourceKey.Name))
+			})
+
+			It("should guard and track major version upgrades", func() {
+				By("Reconciling the created resource")
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+
+				By("Rejecting a downgrade")
+				resource := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				resource.Spec.Cluster.MajorVersion = "16"
+				Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: deletableResourceKey})
+				Expect(err).To(MatchError(reconcile.TerminalError(nil)))
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.PgVersion).To(Equal("17"))
+
+				By("Handing an upgrade over to Zalando")
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				resource.Spec.Cluster.MajorVersion = "17"
+				Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+				// The CRD only allows the supported versions, so the existing cluster stands in for one on an older version
+				cluster.Spec.PgVersion = "16"
+				Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.PgVersion).To(Equal("17"))
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/MajorVersionUpgraded"),
+					HaveField("Status", metav1.ConditionFalse),
+					HaveField("Reason", "Upgrading"),
+				)))
+
+				By("Reporting the outcome from Zalando")
+				metav1.SetMetaDataAnnotation(&cluster.ObjectMeta, "last-major-upgrade-success", time.Now().Add(time.Minute).UTC().Format(time.RFC3339))
+				Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/MajorVersionUpgraded"),
+					HaveField("Status", metav1.ConditionTrue),
+					HaveField("Reason", "Succeeded"),
+				)))
+			})
+
+			It("should take a backup before upgrading when requested", func() {
+				By("Reconciling with logical backups enabled")
+				backupConfig := config.Config{
+					PrometheusRulesDisabled: true,
+					LogicalBackupSchedule:   "30 0 * * *",
+					MajorUpgradeBackup:      true,
+				}
+				backupReconciler := synchronizer.NewSynchronizer(k8sClient, k8sClient.Scheme(), &PostgresReconciler{Config: &backupConfig, Recorder: recorder, APIReader: k8sClient}, recorder)
+				ensureReconciled(deletableResourceKey, backupReconciler)
+
+				cronJob := &batch_v1.CronJob{
+					ObjectMeta: metav1.ObjectMeta{Name: "logical-backup-" + deletableName, Namespace: postgresNamespace},
+					Spec: batch_v1.CronJobSpec{
+						Schedule: "30 0 * * *",
+						JobTemplate: batch_v1.JobTemplateSpec{
+							Spec: batch_v1.JobSpec{
+								Template: core_v1.PodTemplateSpec{
+									Spec: core_v1.PodSpec{
+										RestartPolicy: core_v1.RestartPolicyNever,
+										Containers:    []core_v1.Container{{Name: "backup", Image: "backup"}},
+									},
+								},
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, cronJob)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, cronJob)).To(Succeed())
+				})
+
+				By("Requesting an upgrade from an existing cluster on an older version")
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				cluster.Spec.PgVersion = "16"
+				Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
+				ensureReconciled(deletableResourceKey, backupReconciler)
+
+				By("Checking that the backup runs before the version is changed")
+				job := &batch_v1.Job{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: postgresNamespace, Name: deletableName + "-upgrade-17"}, job)).To(Succeed())
+				Expect(job.Spec.Template.Spec.Containers).To(ContainElement(HaveField("Name", "backup")))
+
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.PgVersion).To(Equal("16"))
+				resource := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, resource)).To(Succeed())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/MajorVersionUpgraded"),
+					HaveField("Reason", "BackingUp"),
+				)))
+			})
+
+			It("should never shrink the disk and track resizing", func() {
+				By("Reconciling the created resource")
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+
+				By("Creating a volume larger than requested")
+				pvc := &core_v1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "pgdata-" + deletableName + "-0",
+						Namespace: postgresNamespace,
+						Labels:    map[string]string{"application": "spilo", "cluster-name": deletableName},
+					},
+					Spec: core_v1.PersistentVolumeClaimSpec{
+						AccessModes: []core_v1.PersistentVolumeAccessMode{core_v1.ReadWriteOnce},
+						Resources: core_v1.VolumeResourceRequirements{
+							Requests: core_v1.ResourceList{core_v1.ResourceStorage: resource.MustParse("5Gi")},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, pvc)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, pvc)).To(Succeed())
+				})
+				pvc.Status.Capacity = core_v1.ResourceList{core_v1.ResourceStorage: resource.MustParse("5Gi")}
+				Expect(k8sClient.Status().Update(ctx, pvc)).To(Succeed())
+
+				By("Keeping the size of the volume")
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.Volume.Size).To(Equal("5Gi"))
+				postgres := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/DiskSize"),
+					HaveField("Status", metav1.ConditionFalse),
+					HaveField("Reason", "ShrinkRejected"),
+				)))
+
+				By("Growing the disk")
+				postgres.Spec.Cluster.Resources.DiskSize = resource.MustParse("10Gi")
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: deletableResourceKey})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(Equal(diskResizeRequeueInterval))
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.Volume.Size).To(Equal("10Gi"))
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/DiskSize"),
+					HaveField("Reason", "Resizing"),
+				)))
+
+				By("Reporting the resize as done when the volume has the new capacity")
+				pvc.Status.Capacity = core_v1.ResourceList{core_v1.ResourceStorage: resource.MustParse("10Gi")}
+				Expect(k8sClient.Status().Update(ctx, pvc)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/DiskSize"),
+					HaveField("Status", metav1.ConditionTrue),
+					HaveField("Reason", "UpToDate"),
+				)))
+			})
+
+			It("should leave out extensions not available in the major version", func() {
+				By("Requesting an extension only available in older major versions")
+				postgres := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				postgres.Spec.Database = &data_nais_io_v1.PostgresDatabase{
+					Extensions: []data_nais_io_v1.PostgresExtension{{Name: "plv8"}, {Name: "pg_trgm"}},
+				}
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+
+				By("Creating the cluster with the available extensions")
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.PreparedDatabases["app"].Extensions).To(HaveKey("pg_trgm"))
+				Expect(cluster.Spec.PreparedDatabases["app"].Extensions).NotTo(HaveKey("plv8"))
+
+				By("Reporting the rejected extension")
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/ExtensionsEnabled"),
+					HaveField("Status", metav1.ConditionFalse),
+					HaveField("Reason", "Rejected"),
+					HaveField("Message", ContainSubstring("plv8")),
+				)))
+			})
+
+			It("should keep removed databases until their removal is confirmed", func() {
+				By("Requesting an additional database")
+				postgres := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/databases", `[{"name": "reporting", "schemas": [{"name": "sales", "defaultRoles": true}]}]`)
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.PreparedDatabases).To(HaveKey("app"))
+				Expect(cluster.Spec.PreparedDatabases).To(HaveKey("reporting"))
+				Expect(cluster.Spec.PreparedDatabases["reporting"].SecretNamespace).To(Equal(deletableResourceKey.Namespace))
+
+				By("Keeping the database when it is no longer requested")
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				delete(postgres.Annotations, "postgres.data.nais.io/databases")
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.PreparedDatabases).To(HaveKey("reporting"))
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/DatabasesPrepared"),
+					HaveField("Status", metav1.ConditionFalse),
+					HaveField("Reason", "RemovalNotConfirmed"),
+				)))
+
+				By("Removing the database when confirmed")
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/remove-databases", "reporting")
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.PreparedDatabases).NotTo(HaveKey("reporting"))
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/DatabasesPrepared"),
+					HaveField("Status", metav1.ConditionTrue),
+				)))
+			})
+
+			It("should remove a confirmed database from the stored cluster", func() {
+				By("Requesting two additional databases")
+				postgres := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/databases", `[{"name": "reporting"}, {"name": "archive"}]`)
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.PreparedDatabases).To(HaveKey("archive"))
+
+				By("Dropping one of them, and confirming its removal at once")
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/databases", `[{"name": "reporting"}]`)
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/remove-databases", "archive")
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.PreparedDatabases).To(HaveKey("app"))
+				Expect(cluster.Spec.PreparedDatabases).To(HaveKey("reporting"))
+				Expect(cluster.Spec.PreparedDatabases).NotTo(HaveKey("archive"))
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/Drifted"),
+					HaveField("Message", ContainSubstring("spec.preparedDatabases.archive")),
+				)))
+			})
+
+			It("should create additional users and grant them privileges", func() {
+				usersConfig := config.Config{
+					PrometheusRulesDisabled: true,
+					PsqlImage:               "postgres:17-alpine",
+				}
+				usersReconciler := synchronizer.NewSynchronizer(k8sClient, k8sClient.Scheme(), &PostgresReconciler{Config: &usersConfig, Recorder: recorder, APIReader: k8sClient}, recorder)
+
+				By("Requesting a read-only user")
+				postgres := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/users", `[{"name": "reporting", "privileges": "read-only"}]`)
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, usersReconciler)
+
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.Users).To(HaveKey(resourceNamespace + ".reporting"))
+
+				By("Waiting for the cluster to be running before granting privileges")
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/UsersGranted"),
+					HaveField("Reason", "WaitingForCluster"),
+				)))
+
+				By("Granting privileges in a job once the cluster is running")
+				cluster.Status.PostgresClusterStatus = acid_zalan_do_v1.ClusterStatusRunning
+				Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+				ensureReconciled(deletableResourceKey, usersReconciler)
+
+				jobs := &batch_v1.JobList{}
+				Expect(k8sClient.List(ctx, jobs, client.InNamespace(postgresNamespace))).To(Succeed())
+				Expect(jobs.Items).To(ContainElement(HaveField("ObjectMeta.Name", HavePrefix(deletableName+"-grants-"))))
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/UsersGranted"),
+					HaveField("Status", metav1.ConditionFalse),
+					HaveField("Reason", "Granting"),
+				)))
+
+				By("Keeping the job while the cluster is updating")
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				cluster.Status.PostgresClusterStatus = acid_zalan_do_v1.ClusterStatusUpdating
+				Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+				ensureReconciled(deletableResourceKey, usersReconciler)
+				Expect(k8sClient.List(ctx, jobs, client.InNamespace(postgresNamespace))).To(Succeed())
+				Expect(jobs.Items).To(ContainElement(And(
+					HaveField("ObjectMeta.Name", HavePrefix(deletableName+"-grants-")),
+					HaveField("ObjectMeta.DeletionTimestamp", BeNil()),
+				)))
+
+				By("Removing the user from the cluster when no longer requested")
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				delete(postgres.Annotations, "postgres.data.nais.io/users")
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, usersReconciler)
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.Users).NotTo(HaveKey(resourceNamespace + ".reporting"))
+			})
+
+			It("should have Zalando rotate passwords when requested", func() {
+				rotationConfig := config.Config{
+					PrometheusRulesDisabled:      true,
+					PasswordRotationIntervalDays: 90,
+				}
+				rotationReconciler := synchronizer.NewSynchronizer(k8sClient, k8sClient.Scheme(), &PostgresReconciler{Config: &rotationConfig, Recorder: recorder, APIReader: k8sClient}, recorder)
+
+				By("Having Zalando's secret for the reader user, last rotated a day ago")
+				now := time.Now()
+				secret := &core_v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "app-reader-user." + deletableName + ".credentials.postgresql.acid.zalan.do",
+						Namespace: resourceNamespace,
+					},
+					Data: map[string][]byte{
+						"username":     []byte("app_reader_user"),
+						"password":     []byte("secret"),
+						"nextRotation": []byte(now.Add(89 * 24 * time.Hour).UTC().Format(time.RFC3339)),
+					},
+				}
+				Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+				})
+
+				By("Requesting rotation of all passwords")
+				postgres := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				requestedAt := now.UTC().Format(time.RFC3339)
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/rotate-passwords", requestedAt)
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, rotationReconciler)
+
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.UsersWithSecretRotation).To(ConsistOf("app_writer_user", "app_reader_user"))
+				Expect(cluster.Spec.UsersWithInPlaceSecretRotation).To(ConsistOf("app_owner_user"))
+				Expect(cluster.GetAnnotations()).To(HaveKeyWithValue("postgres.data.nais.io/password-rotation-requested", requestedAt))
+
+				By("Marking the password as due in the secret, for Zalando to rotate it")
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+				Expect(string(secret.Data["nextRotation"])).To(Equal(requestedAt))
+				Expect(string(secret.Data["username"])).To(Equal("app_reader_user"))
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/PasswordsRotated"),
+					HaveField("Status", metav1.ConditionFalse),
+					HaveField("Reason", "Rotating"),
+					HaveField("Message", ContainSubstring("app_reader_user")),
+				)))
+
+				By("Reporting when the password was rotated, once Zalando has rotated it")
+				secret.Data["username"] = []byte("app_reader_user" + now.UTC().Format("060102"))
+				secret.Data["nextRotation"] = []byte(now.Add(90 * 24 * time.Hour).UTC().Format(time.RFC3339))
+				Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+				ensureReconciled(deletableResourceKey, rotationReconciler)
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/PasswordsRotated"),
+					HaveField("Message", ContainSubstring("app_reader_user at "+requestedAt)),
+				)))
+			})
+
+			It("should remove pooler settings no longer asked for", func() {
+				By("Asking for pooler resources and read replicas")
+				postgres := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				postgres.Spec.Cluster.HighAvailability = true
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/connection-pooler", `{"cpu": "500m", "memory": "200Mi"}`)
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/read-replicas", "true")
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				cluster := &acid_zalan_do_v1.Postgresql{}
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.EnableReplicaConnectionPooler).To(HaveValue(BeTrue()))
+				Expect(cluster.Spec.ConnectionPooler.Resources.ResourceLimits.CPU).To(HaveValue(Equal("2")))
+				Expect(cluster.Spec.ConnectionPooler.Resources.ResourceLimits.Memory).To(HaveValue(Equal("200Mi")))
+
+				By("Removing the limits and the replica pooler once no longer asked for")
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				delete(postgres.Annotations, "postgres.data.nais.io/connection-pooler")
+				delete(postgres.Annotations, "postgres.data.nais.io/read-replicas")
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, deletableClusterKey, cluster)).To(Succeed())
+				Expect(cluster.Spec.EnableReplicaConnectionPooler).To(HaveValue(BeFalse()))
+				Expect(cluster.Spec.ConnectionPooler.Resources.ResourceLimits.CPU).To(BeNil())
+				Expect(cluster.Spec.ConnectionPooler.Resources.ResourceLimits.Memory).To(BeNil())
+			})
+
+			It("should keep the connection secret up to date with the credentials", func() {
+				connectionKey := client.ObjectKey{Namespace: resourceNamespace, Name: "postgres-" + deletableResourceKey.Name}
+
+				By("Waiting for Zalando to create the credentials")
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				postgres := &data_nais_io_v1.Postgres{}
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgresql.acid.zalan.do/ConnectionSecretReady"),
+					HaveField("Status", metav1.ConditionFalse),
+				)))
+				Expect(apierrors.IsNotFound(k8sClient.Get(ctx, connectionKey, &core_v1.Secret{}))).To(BeTrue())
+
+				By("Creating the connection secret from Zalando's secret")
+				credentials := &core_v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "app-owner-user." + deletableName + ".credentials.postgresql.acid.zalan.do",
+						Namespace: resourceNamespace,
+					},
+					Data: map[string][]byte{
+						"username": []byte("app_owner_user"),
+						"password": []byte("secret"),
+					},
+				}
+				Expect(k8sClient.Create(ctx, credentials)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, credentials)).To(Succeed())
+				})
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+
+				connection := &core_v1.Secret{}
+				Expect(k8sClient.Get(ctx, connectionKey, connection)).To(Succeed())
+				Expect(connection.GetAnnotations()).To(HaveKeyWithValue("postgres.data.nais.io/owner", deletableResourceKey.String()))
+				Expect(string(connection.Data["PGHOST"])).To(Equal(deletableName + "-pooler." + postgresNamespace))
+				Expect(string(connection.Data["PGPASSWORD"])).To(Equal("secret"))
+
+				By("Updating the connection secret when the password changes")
+				credentials.Data["password"] = []byte("rotated")
+				Expect(k8sClient.Update(ctx, credentials)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, connectionKey, connection)).To(Succeed())
+				Expect(string(connection.Data["PGPASSWORD"])).To(Equal("rotated"))
+				Expect(string(connection.Data["PGURL"])).To(ContainSubstring("app_owner_user:rotated@"))
+
+				By("Removing the replica connection details when read replicas are turned off")
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				postgres.Spec.Cluster.HighAvailability = true
+				metav1.SetMetaDataAnnotation(&postgres.ObjectMeta, "postgres.data.nais.io/read-replicas", "true")
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, connectionKey, connection)).To(Succeed())
+				Expect(connection.Data).To(HaveKey("PGHOST_REPLICA"))
+
+				Expect(k8sClient.Get(ctx, deletableResourceKey, postgres)).To(Succeed())
+				delete(postgres.Annotations, "postgres.data.nais.io/read-replicas")
+				Expect(k8sClient.Update(ctx, postgres)).To(Succeed())
+				ensureReconciled(deletableResourceKey, controllerReconciler)
+				Expect(k8sClient.Get(ctx, connectionKey, connection)).To(Succeed())
+				Expect(connection.Data).NotTo(HaveKey("PGHOST_REPLICA"))
+				Expect(connection.Data).NotTo(HaveKey("PGURL_REPLICA"))
+				Expect(connection.Data).NotTo(HaveKey("PGJDBCURL_REPLICA"))
+
+				By("Leaving Zalando's secret to Zalando")
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(credentials), credentials)).To(Succeed())
+				Expect(credentials.GetAnnotations()).NotTo(HaveKey("postgres.data.nais.io/owner"))
+			})
+
+			It("should only report planned actions in plan mode", func() {
+				By("Reconciling with plan mode enabled")
+				planReconciler := synchronizer.NewSynchronizer(k8sClient, k8sClient.Scheme(), &PostgresReconciler{Config: &reconcilerConfig, Recorder: recorder, APIReader: k8sClient}, recorder, synchronizer.WithPlanMode(true))
+				ensureReconciled(deletableResourceKey, planReconciler)
+
+				By("Checking that the plan is reported in the status")
+				resource := &data_nais_io_v1.Postgres{}
+				err := k8sClient.Get(ctx, deletableResourceKey, resource)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resource.GetStatus().ReconcilePhase).To(Equal("Planned"))
+				Expect(resource.GetStatus().Conditions).NotTo(BeNil())
+				Expect(*resource.GetStatus().Conditions).To(ContainElement(And(
+					HaveField("Type", "postgres.data.nais.io/Planned"),
+					HaveField("Message", ContainSubstring("postgresql pg-default/deletable-resource")),
+				)))
+			})
 		})
 
 		When("the resource is deleted", func() {
@@ -194,6 +887,19 @@ func ensureReconciled(key types.NamespacedName, controllerReconciler *synchroniz
 		NamespacedName: key,
 	})
 	Expect(err).NotTo(HaveOccurred())
+
+	// Successful reconciles may be requeued to follow what is not watched, so the outcome is told by the status
+	postgres := &data_nais_io_v1.Postgres{}
+	err = k8sClient.Get(ctx, key, postgres)
+	if apierrors.IsNotFound(err) {
+		// Nothing is left to tell once the deletion is done
+		return
+	}
+	Expect(err).NotTo(HaveOccurred())
+	Expect(*postgres.GetStatus().Conditions).To(ContainElement(And(
+		HaveField("Type", "postgres.data.nais.io/Reconciled"),
+		HaveField("Status", metav1.ConditionTrue),
+	)))
 }
 
 func ensurePostgresExists(key types.NamespacedName, allowDeletion bool) {
@@ -0,0 +1,168 @@
+package resourcecreator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// CloneFromAnnotation names a Postgres resource as "<namespace>/<name>" to copy when the new cluster is created
+	CloneFromAnnotation = "postgres.data.nais.io/clone-from"
+	// CloneTimestampAnnotation is the point in time to copy the source at, in RFC 3339 format.
+	// Defaults to a while before the clone was created.
+	CloneTimestampAnnotation = "postgres.data.nais.io/clone-timestamp"
+	// AllowCloneToAnnotation is set on a source Postgres resource to list the namespaces that may clone it, separated
+	// by commas. Clones within the same namespace are always allowed.
+	// This guards against cloning the wrong source by mistake, and is no access boundary: the pods of every cluster run
+	// as the same Google service account, which can read the WAL archives of all clusters.
+	AllowCloneToAnnotation = "postgres.data.nais.io/allow-clone-to"
+
+	// cloneTimestampFormat is RFC 3339 with a numeric offset, since Zalando does not accept "Z" for UTC
+	cloneTimestampFormat = "2006-01-02T15:04:05-07:00"
+
+	// archiveTimeout is how long Spilo may wait before archiving a WAL segment. Clones default to a point in time at
+	// least this far back, since replaying to a target that is not archived yet fails.
+	archiveTimeout = 30 * time.Minute
+)
+
+// Clone describes a new cluster bootstrapped from the WAL archive of another cluster, up to a point in time
+type Clone struct {
+	// SourceNamespace and SourceName identify the Postgres resource to copy
+	SourceNamespace string
+	SourceName      string
+	// SourceClusterName is the name of the Zalando cluster of the source
+	SourceClusterName string
+	Timestamp         time.Time
+
+	// existing is the clone of an existing cluster, kept as it was created
+	existing *acid_zalan_do_v1.CloneDescription
+	// existingEnv is the environment pointing Spilo at the source of an existing clone
+	existingEnv []v1.EnvVar
+}
+
+func (c Clone) Requested() bool {
+	return len(c.SourceName) > 0
+}
+
+func (c Clone) String() string {
+	return fmt.Sprintf("%s/%s at %s", c.SourceNamespace, c.SourceName, c.Timestamp.UTC().Format(time.RFC3339))
+}
+
+// CloneSource returns the Postgres resource postgres should be cloned from, if any
+func CloneSource(postgres *data_nais_io_v1.Postgres) (types.NamespacedName, bool, error) {
+	value, ok := postgres.GetAnnotations()[CloneFromAnnotation]
+	if !ok {
+		return types.NamespacedName{}, false, nil
+	}
+	namespace, name, found := strings.Cut(value, "/")
+	if !found || len(namespace) == 0 || len(name) == 0 {
+		return types.NamespacedName{}, false, fmt.Errorf("%w: clone source %q is not on the form <namespace>/<name>", reconciler.ErrInvalid, value)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, true, nil
+}
+
+// GetClone validates that postgres may be cloned from source, and returns the clone to perform
+func GetClone(postgres *data_nais_io_v1.Postgres, source *data_nais_io_v1.Postgres, cfg *config.Config) (Clone, error) {
+	if _, ok := postgres.GetAnnotations()[RestoreFromAnnotation]; ok {
+		return Clone{}, fmt.Errorf("%w: cannot both clone and restore a cluster", reconciler.ErrInvalid)
+	}
+	if cfg.WalArchivingDisabled {
+		return Clone{}, fmt.Errorf("%w: cloning requires WAL archiving, which is disabled", reconciler.ErrInvalid)
+	}
+	if source.GetNamespace() == postgres.GetNamespace() && source.GetName() == postgres.GetName() {
+		return Clone{}, fmt.Errorf("%w: cannot clone %s from itself", reconciler.ErrInvalid, postgres.GetName())
+	}
+	if !cloneAllowed(source, postgres.GetNamespace()) {
+		return Clone{}, fmt.Errorf("%w: %s/%s does not allow cloning to namespace %s, see the %s annotation", reconciler.ErrInvalid, source.GetNamespace(), source.GetName(), postgres.GetNamespace(), AllowCloneToAnnotation)
+	}
+
+	timestamp := postgres.GetCreationTimestamp().Add(-archiveTimeout)
+	if value, ok := postgres.GetAnnotations()[CloneTimestampAnnotation]; ok {
+		var err error
+		timestamp, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return Clone{}, fmt.Errorf("%w: clone timestamp %q is not in RFC 3339 format", reconciler.ErrInvalid, value)
+		}
+	}
+
+	sourceClusterName, err := ClusterName(source.GetName())
+	if err != nil {
+		return Clone{}, err
+	}
+
+	return Clone{
+		SourceNamespace:   source.GetNamespace(),
+		SourceName:        source.GetName(),
+		SourceClusterName: sourceClusterName,
+		Timestamp:         timestamp,
+	}, nil
+}
+
+// ExistingClone returns the clone existing was created from, if any, without resolving the source again.
+// The source may since have been deleted or stopped allowing clones, which does not matter to a cluster already created.
+func ExistingClone(postgres *data_nais_io_v1.Postgres, existing *acid_zalan_do_v1.Postgresql) Clone {
+	description := existing.Spec.Clone
+	if description == nil || len(description.ClusterName) == 0 {
+		return Clone{}
+	}
+
+	clone := Clone{
+		SourceNamespace:   postgres.GetNamespace(),
+		SourceName:        description.ClusterName,
+		SourceClusterName: description.ClusterName,
+		existing:          description.DeepCopy(),
+	}
+	if source, ok, err := CloneSource(postgres); err == nil && ok {
+		clone.SourceNamespace, clone.SourceName = source.Namespace, source.Name
+	}
+	if timestamp, err := time.Parse(cloneTimestampFormat, description.EndTimestamp); err == nil {
+		clone.Timestamp = timestamp
+	}
+	for _, env := range existing.Spec.Env {
+		if strings.HasPrefix(env.Name, "CLONE_") {
+			clone.existingEnv = append(clone.existingEnv, env)
+		}
+	}
+	return clone
+}
+
+func cloneAllowed(source *data_nais_io_v1.Postgres, namespace string) bool {
+	if source.GetNamespace() == namespace {
+		return true
+	}
+	allowed := strings.Split(source.GetAnnotations()[AllowCloneToAnnotation], ",")
+	return slices.ContainsFunc(allowed, func(ns string) bool {
+		return strings.TrimSpace(ns) == namespace
+	})
+}
+
+// cloneDescription makes Zalando bootstrap the cluster from the WAL archive of the source, replaying up to the timestamp
+func (c Clone) cloneDescription() *acid_zalan_do_v1.CloneDescription {
+	if c.existing != nil {
+		return c.existing
+	}
+	return &acid_zalan_do_v1.CloneDescription{
+		ClusterName:  c.SourceClusterName,
+		EndTimestamp: c.Timestamp.Format(cloneTimestampFormat),
+	}
+}
+
+// cloneEnv points Spilo at the bucket of the source cluster. Zalando only knows about its own global bucket.
+func (c Clone) cloneEnv(cfg *config.Config) []v1.EnvVar {
+	if c.existing != nil {
+		return c.existingEnv
+	}
+	return []v1.EnvVar{
+		{Name: "CLONE_WAL_GS_BUCKET", Value: WalBucketName(cfg, c.SourceClusterName, ClusterNamespace(c.SourceNamespace))},
+		{Name: "CLONE_USE_WALG_RESTORE", Value: "true"},
+	}
+}
@@ -0,0 +1,107 @@
+package resourcecreator
+
+import (
+	"time"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Clone", func() {
+	cfg := &config.Config{
+		GoogleProjectID: "nais-dev-1234",
+	}
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	It("should parse the clone source", func() {
+		source, ok, err := CloneSource(newPostgres(withName("dev", "copy"), withCreated(created), withAnnotations(map[string]string{CloneFromAnnotation: "prod/app"})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(source).To(Equal(types.NamespacedName{Namespace: "prod", Name: "app"}))
+
+		_, ok, err = CloneSource(newPostgres(withName("dev", "copy"), withCreated(created)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+
+		_, _, err = CloneSource(newPostgres(withName("dev", "copy"), withCreated(created), withAnnotations(map[string]string{CloneFromAnnotation: "app"})))
+		Expect(err).To(MatchError(reconciler.ErrInvalid))
+	})
+
+	It("should clone from the bucket of the source", func() {
+		source := newPostgres(withName("prod", "app"), withAnnotations(map[string]string{AllowCloneToAnnotation: "test, dev"}))
+		clone, err := GetClone(newPostgres(withName("dev", "copy"), withCreated(created), withAnnotations(map[string]string{CloneFromAnnotation: "prod/app"})), source, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clone.SourceClusterName).To(Equal("app"))
+		Expect(clone.Timestamp).To(Equal(created.Add(-archiveTimeout)))
+
+		cluster, err := CreateClusterSpec(newPostgres(withName("dev", "copy"), withCreated(created)), cfg, clone, "copy", "pg-dev")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.Clone.ClusterName).To(Equal("app"))
+		Expect(cluster.Spec.Clone.EndTimestamp).To(Equal("2025-03-01T11:30:00+00:00"))
+		Expect(cluster.Spec.Env).To(ContainElement(v1.EnvVar{Name: "CLONE_WAL_GS_BUCKET", Value: WalBucketName(cfg, "app", "pg-prod")}))
+	})
+
+	It("should keep the clone of an existing cluster without the source", func() {
+		target := newPostgres(withName("dev", "copy"), withCreated(created), withAnnotations(map[string]string{CloneFromAnnotation: "prod/app"}))
+		clone, err := GetClone(target, newPostgres(withName("prod", "app"), withAnnotations(map[string]string{AllowCloneToAnnotation: "dev"})), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		created, err := CreateClusterSpec(target, cfg, clone, "copy", "pg-dev")
+		Expect(err).NotTo(HaveOccurred())
+
+		existing := ExistingClone(target, created)
+		Expect(existing.Requested()).To(BeTrue())
+		Expect(existing.String()).To(Equal(clone.String()))
+		cluster, err := CreateClusterSpec(target, cfg, existing, "copy", "pg-dev")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.Clone).To(Equal(created.Spec.Clone))
+		Expect(cluster.Spec.Env).To(Equal(created.Spec.Env))
+
+		uncloned, err := CreateClusterSpec(newPostgres(withName("dev", "copy")), cfg, Clone{}, "copy", "pg-dev")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ExistingClone(target, uncloned).Requested()).To(BeFalse())
+	})
+
+	It("should use the requested timestamp", func() {
+		source := newPostgres(withName("dev", "app"))
+		clone, err := GetClone(newPostgres(withName("dev", "copy"), withCreated(created), withAnnotations(map[string]string{
+			CloneFromAnnotation:      "dev/app",
+			CloneTimestampAnnotation: "2025-02-01T08:00:00+01:00",
+		})), source, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clone.Timestamp.UTC()).To(Equal(time.Date(2025, 2, 1, 7, 0, 0, 0, time.UTC)))
+	})
+
+	DescribeTable("should reject clones that are not allowed",
+		func(target, source *data_nais_io_v1.Postgres) {
+			_, err := GetClone(target, source, cfg)
+			Expect(err).To(MatchError(reconciler.ErrInvalid))
+		},
+		Entry("other namespace without permission",
+			newPostgres(withName("dev", "copy"), withCreated(created)),
+			newPostgres(withName("prod", "app"))),
+		Entry("other namespace not in the list",
+			newPostgres(withName("dev", "copy"), withCreated(created)),
+			newPostgres(withName("prod", "app"), withAnnotations(map[string]string{AllowCloneToAnnotation: "test,development"}))),
+		Entry("itself",
+			newPostgres(withName("dev", "app")),
+			newPostgres(withName("dev", "app"))),
+		Entry("both clone and restore",
+			newPostgres(withName("dev", "copy"), withCreated(created), withAnnotations(map[string]string{RestoreFromAnnotation: "app"})),
+			newPostgres(withName("dev", "app"))),
+		Entry("malformed timestamp",
+			newPostgres(withName("dev", "copy"), withCreated(created), withAnnotations(map[string]string{CloneTimestampAnnotation: "now"})),
+			newPostgres(withName("dev", "app"))),
+	)
+
+	It("should require WAL archiving", func() {
+		disabled := *cfg
+		disabled.WalArchivingDisabled = true
+		_, err := GetClone(newPostgres(withName("dev", "copy"), withCreated(created)), newPostgres(withName("dev", "app")), &disabled)
+		Expect(err).To(MatchError(reconciler.ErrInvalid))
+	})
+})
@@ -0,0 +1,148 @@
+package resourcecreator
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The keys of the connection secret, which can be used as environment variables as is. The unsuffixed host and URLs go
+// through the connection pooler, while those suffixed with _DIRECT go straight to the primary instance, e.g. for
+// migrations needing session features in transaction pooling mode. Those suffixed with _REPLICA go through the
+// connection pooler of the replicas, and are only there when read replicas are requested.
+const (
+	ConnectionHostKey          = "PGHOST"
+	ConnectionHostDirectKey    = "PGHOST_DIRECT"
+	ConnectionPortKey          = "PGPORT"
+	ConnectionDatabaseKey      = "PGDATABASE"
+	ConnectionUserKey          = "PGUSER"
+	ConnectionPasswordKey      = "PGPASSWORD"
+	ConnectionSSLModeKey       = "PGSSLMODE"
+	ConnectionURLKey           = "PGURL"
+	ConnectionURLDirectKey     = "PGURL_DIRECT"
+	ConnectionJDBCURLKey       = "PGJDBCURL"
+	ConnectionJDBCURLDirectKey = "PGJDBCURL_DIRECT"
+
+	ConnectionHostReplicaKey    = "PGHOST_REPLICA"
+	ConnectionURLReplicaKey     = "PGURL_REPLICA"
+	ConnectionJDBCURLReplicaKey = "PGJDBCURL_REPLICA"
+)
+
+const (
+	// connectionPort is the port of both Postgres and the connection pooler
+	connectionPort = "5432"
+	// connectionSSLMode is required, as both Postgres and the connection pooler only accept TLS
+	connectionSSLMode = "require"
+)
+
+// ConnectionSecretName returns the name of the secret with the connection details for the Postgres resource with
+// the given name, in the application namespace
+func ConnectionSecretName(postgresName string) string {
+	return fmt.Sprintf("postgres-%s", postgresName)
+}
+
+// Connection is how applications connect to the app database, as its owner user
+type Connection struct {
+	// SecretName is the name of the connection secret, in the application namespace
+	SecretName string
+	// UserSecret is the secret Zalando keeps the credentials of the owner user in, nil until Zalando creates it
+	UserSecret *v1.Secret
+	// ReadReplicas adds the connection details for reading from the replicas
+	ReadReplicas bool
+}
+
+// Ready returns true once the credentials are available
+func (c Connection) Ready() bool {
+	return c.UserSecret != nil
+}
+
+// MinimalConnectionUserSecret is the secret Zalando keeps the credentials of the owner of the app database in
+func MinimalConnectionUserSecret(postgres *data_nais_io_v1.Postgres, pgClusterName string) *v1.Secret {
+	return &v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credentialsSecretName(defaultDatabaseName+"_owner_user", pgClusterName),
+			Namespace: postgres.GetNamespace(),
+		},
+	}
+}
+
+func MinimalConnectionSecret(postgres *data_nais_io_v1.Postgres) *v1.Secret {
+	objectMeta := CreateObjectMeta(postgres)
+	objectMeta.Name = ConnectionSecretName(postgres.GetName())
+
+	return &v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: objectMeta,
+	}
+}
+
+// CreateConnectionSecretSpec creates the secret with the connection details, from the credentials kept by Zalando.
+// Applications only need to know its name, and not how Zalando names its secrets and services.
+func CreateConnectionSecretSpec(postgres *data_nais_io_v1.Postgres, connection Connection, pgClusterName string, pgNamespace string) *v1.Secret {
+	secret := MinimalConnectionSecret(postgres)
+
+	user := string(connection.UserSecret.Data["username"])
+	password := string(connection.UserSecret.Data["password"])
+	host := fmt.Sprintf("%s-pooler.%s", pgClusterName, pgNamespace)
+	directHost := fmt.Sprintf("%s.%s", pgClusterName, pgNamespace)
+
+	secret.Type = v1.SecretTypeOpaque
+	secret.Data = map[string][]byte{
+		ConnectionHostKey:          []byte(host),
+		ConnectionHostDirectKey:    []byte(directHost),
+		ConnectionPortKey:          []byte(connectionPort),
+		ConnectionDatabaseKey:      []byte(defaultDatabaseName),
+		ConnectionUserKey:          []byte(user),
+		ConnectionPasswordKey:      []byte(password),
+		ConnectionSSLModeKey:       []byte(connectionSSLMode),
+		ConnectionURLKey:           []byte(libpqURL(host, user, password)),
+		ConnectionURLDirectKey:     []byte(libpqURL(directHost, user, password)),
+		ConnectionJDBCURLKey:       []byte(jdbcURL(host, user, password)),
+		ConnectionJDBCURLDirectKey: []byte(jdbcURL(directHost, user, password)),
+	}
+	if connection.ReadReplicas {
+		replicaHost := fmt.Sprintf("%s-pooler-repl.%s", pgClusterName, pgNamespace)
+		secret.Data[ConnectionHostReplicaKey] = []byte(replicaHost)
+		secret.Data[ConnectionURLReplicaKey] = []byte(libpqURL(replicaHost, user, password))
+		secret.Data[ConnectionJDBCURLReplicaKey] = []byte(jdbcURL(replicaHost, user, password))
+	}
+	return secret
+}
+
+// libpqURL returns the URL of the app database, with the credentials, as understood by libpq and most drivers
+func libpqURL(host, user, password string) string {
+	u := url.URL{
+		Scheme:   "postgresql",
+		User:     url.UserPassword(user, password),
+		Host:     net.JoinHostPort(host, connectionPort),
+		Path:     "/" + defaultDatabaseName,
+		RawQuery: url.Values{"sslmode": {connectionSSLMode}}.Encode(),
+	}
+	return u.String()
+}
+
+// jdbcURL returns the URL of the app database for the Postgres JDBC driver, which takes the credentials as parameters
+func jdbcURL(host, user, password string) string {
+	u := url.URL{
+		Scheme: "postgresql",
+		Host:   net.JoinHostPort(host, connectionPort),
+		Path:   "/" + defaultDatabaseName,
+		RawQuery: url.Values{
+			"user":     {user},
+			"password": {password},
+			"sslmode":  {connectionSSLMode},
+		}.Encode(),
+	}
+	return "jdbc:" + u.String()
+}
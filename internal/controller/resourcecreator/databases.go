@@ -0,0 +1,250 @@
+package resourcecreator
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// DatabasesAnnotation adds databases to the cluster, as a JSON list, e.g.
+	// [{"name": "reporting", "schemas": [{"name": "sales", "defaultRoles": true}], "extensions": [{"name": "pg_trgm"}]}].
+	// An entry for the app database may only add schemas, as its extensions are in the spec.
+	DatabasesAnnotation = "postgres.data.nais.io/databases"
+
+	// RemoveDatabasesAnnotation confirms that databases no longer in DatabasesAnnotation are to be removed from the
+	// cluster, e.g. "reporting,archive". Zalando never drops the data, which is left in Postgres.
+	RemoveDatabasesAnnotation = "postgres.data.nais.io/remove-databases"
+)
+
+// reservedDatabaseNames are the databases of Postgres itself
+var reservedDatabaseNames = []string{"postgres", "template0", "template1"}
+
+// DatabaseRequest is a database requested in DatabasesAnnotation
+type DatabaseRequest struct {
+	Name       string              `json:"name"`
+	Schemas    []DatabaseSchema    `json:"schemas,omitempty"`
+	Extensions []DatabaseExtension `json:"extensions,omitempty"`
+	// DefaultUsers creates owner, writer and reader users for the database, with secrets in the application namespace.
+	// Defaults to true, as for the app database.
+	DefaultUsers *bool `json:"defaultUsers,omitempty"`
+}
+
+// DatabaseSchema is a schema created in a database
+type DatabaseSchema struct {
+	Name string `json:"name"`
+	// DefaultRoles creates owner, writer and reader roles for the schema
+	DefaultRoles bool `json:"defaultRoles,omitempty"`
+	// DefaultUsers creates users for the default roles of the schema, with secrets in the application namespace
+	DefaultUsers bool `json:"defaultUsers,omitempty"`
+}
+
+// DatabaseExtension is an extension created in a database, in the schema from the catalog unless given
+type DatabaseExtension struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema,omitempty"`
+}
+
+// Database is a database prepared by Zalando in the cluster
+type Database struct {
+	Name         string
+	DefaultUsers bool
+	Schemas      []DatabaseSchema
+	Extensions   Extensions
+}
+
+// GetDatabases returns the app database, and the databases added in DatabasesAnnotation
+func GetDatabases(postgres *data_nais_io_v1.Postgres, cfg *config.Config) ([]Database, error) {
+	requests, err := DatabaseRequests(postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	extensions, err := GetExtensions(postgres, cfg)
+	if err != nil {
+		return nil, err
+	}
+	app := Database{
+		Name:         defaultDatabaseName,
+		DefaultUsers: true,
+		Extensions:   extensions,
+	}
+	databases := []Database{app}
+
+	for _, request := range requests {
+		if request.Name == defaultDatabaseName {
+			databases[0].Schemas = request.Schemas
+			continue
+		}
+
+		names := slices.Clone(defaultExtensions)
+		schemas := map[string]string{}
+		for _, extension := range request.Extensions {
+			names = append(names, extension.Name)
+			if len(extension.Schema) > 0 {
+				schemas[extension.Name] = extension.Schema
+			}
+		}
+		slices.Sort(names)
+		extensions, err := resolveExtensions(slices.Compact(names), schemas, postgres.Spec.Cluster.MajorVersion, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		databases = append(databases, Database{
+			Name:         request.Name,
+			DefaultUsers: request.DefaultUsers == nil || *request.DefaultUsers,
+			Schemas:      request.Schemas,
+			Extensions:   extensions,
+		})
+	}
+	return databases, nil
+}
+
+// DatabaseRequests parses the databases added in the annotations of postgres
+func DatabaseRequests(postgres *data_nais_io_v1.Postgres) ([]DatabaseRequest, error) {
+	value := postgres.GetAnnotations()[DatabasesAnnotation]
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	var requests []DatabaseRequest
+	if err := json.Unmarshal([]byte(value), &requests); err != nil {
+		return nil, fmt.Errorf("%w: %s must be a JSON list of databases: %w", reconciler.ErrInvalid, DatabasesAnnotation, err)
+	}
+
+	seen := map[string]bool{}
+	for _, request := range requests {
+		switch {
+		case !identifierPattern.MatchString(request.Name):
+			return nil, fmt.Errorf("%w: %s has database %q, names must be in lower case", reconciler.ErrInvalid, DatabasesAnnotation, request.Name)
+		case slices.Contains(reservedDatabaseNames, request.Name):
+			return nil, fmt.Errorf("%w: %s has database %s, which is reserved by Postgres", reconciler.ErrInvalid, DatabasesAnnotation, request.Name)
+		case seen[request.Name]:
+			return nil, fmt.Errorf("%w: %s has database %s more than once", reconciler.ErrInvalid, DatabasesAnnotation, request.Name)
+		case request.Name == defaultDatabaseName && (len(request.Extensions) > 0 || request.DefaultUsers != nil):
+			return nil, fmt.Errorf("%w: %s may only add schemas to the %s database, its extensions are set in the spec", reconciler.ErrInvalid, DatabasesAnnotation, defaultDatabaseName)
+		}
+		seen[request.Name] = true
+
+		for _, schema := range request.Schemas {
+			if !identifierPattern.MatchString(schema.Name) {
+				return nil, fmt.Errorf("%w: %s has schema %q in database %s, names must be in lower case", reconciler.ErrInvalid, DatabasesAnnotation, schema.Name, request.Name)
+			}
+			if schema.DefaultUsers && !schema.DefaultRoles {
+				return nil, fmt.Errorf("%w: %s has default users for schema %s in database %s, which requires default roles", reconciler.ErrInvalid, DatabasesAnnotation, schema.Name, request.Name)
+			}
+		}
+		for _, extension := range request.Extensions {
+			if len(extension.Schema) > 0 && !identifierPattern.MatchString(extension.Schema) {
+				return nil, fmt.Errorf("%w: %s has extension %s in schema %q in database %s, names must be in lower case", reconciler.ErrInvalid, DatabasesAnnotation, extension.Name, extension.Schema, request.Name)
+			}
+		}
+	}
+
+	for _, name := range removedDatabaseNames(postgres) {
+		if seen[name] || name == defaultDatabaseName {
+			return nil, fmt.Errorf("%w: %s has database %s, which is still in use", reconciler.ErrInvalid, RemoveDatabasesAnnotation, name)
+		}
+	}
+	return requests, nil
+}
+
+func removedDatabaseNames(postgres *data_nais_io_v1.Postgres) []string {
+	var names []string
+	for _, name := range strings.Split(postgres.GetAnnotations()[RemoveDatabasesAnnotation], ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// preparedDatabase returns the database for Zalando to prepare, with secrets for its users in the given namespace
+func (d Database) preparedDatabase(secretNamespace string) acid_zalan_do_v1.PreparedDatabase {
+	// Zalando creates default roles for schemas unless told not to
+	schemas := map[string]acid_zalan_do_v1.PreparedSchema{
+		defaultSchema: {
+			DefaultRoles: ptr.To(false),
+			DefaultUsers: false,
+		},
+	}
+	for _, schema := range d.Extensions.Enabled {
+		schemas[schema] = acid_zalan_do_v1.PreparedSchema{
+			DefaultRoles: ptr.To(false),
+			DefaultUsers: false,
+		}
+	}
+	for _, schema := range d.Schemas {
+		schemas[schema.Name] = acid_zalan_do_v1.PreparedSchema{
+			DefaultRoles: ptr.To(schema.DefaultRoles),
+			DefaultUsers: schema.DefaultUsers,
+		}
+	}
+
+	return acid_zalan_do_v1.PreparedDatabase{
+		DefaultUsers:    d.DefaultUsers,
+		Extensions:      d.Extensions.Enabled,
+		SecretNamespace: secretNamespace,
+		PreparedSchemas: schemas,
+	}
+}
+
+// DatabaseRemoval describes the databases of the existing cluster that are no longer requested
+type DatabaseRemoval struct {
+	// Retained are kept in the cluster until their removal is confirmed in RemoveDatabasesAnnotation
+	Retained map[string]acid_zalan_do_v1.PreparedDatabase
+	// Removed are removed from the cluster, their data is left in Postgres
+	Removed []string
+}
+
+// GetDatabaseRemoval finds the databases in the existing cluster that are no longer requested. Databases are only removed
+// from the cluster when confirmed, so that a mistake in the annotation does not leave an application without its users.
+func GetDatabaseRemoval(postgres *data_nais_io_v1.Postgres, existing *acid_zalan_do_v1.Postgresql, cfg *config.Config) (DatabaseRemoval, error) {
+	removal := DatabaseRemoval{
+		Retained: map[string]acid_zalan_do_v1.PreparedDatabase{},
+	}
+	if existing == nil {
+		return removal, nil
+	}
+
+	databases, err := GetDatabases(postgres, cfg)
+	if err != nil {
+		return DatabaseRemoval{}, err
+	}
+	confirmed := removedDatabaseNames(postgres)
+	for _, name := range slices.Sorted(maps.Keys(existing.Spec.PreparedDatabases)) {
+		if slices.ContainsFunc(databases, func(database Database) bool { return database.Name == name }) {
+			continue
+		}
+		if slices.Contains(confirmed, name) {
+			removal.Removed = append(removal.Removed, name)
+		} else {
+			removal.Retained[name] = existing.Spec.PreparedDatabases[name]
+		}
+	}
+	return removal, nil
+}
+
+// RetainedNames returns the names of the databases retained in the cluster, sorted
+func (r DatabaseRemoval) RetainedNames() []string {
+	return slices.Sorted(maps.Keys(r.Retained))
+}
+
+// Apply keeps the retained databases in the cluster
+func (r DatabaseRemoval) Apply(cluster *acid_zalan_do_v1.Postgresql) {
+	if len(r.Retained) > 0 && cluster.Spec.PreparedDatabases == nil {
+		cluster.Spec.PreparedDatabases = map[string]acid_zalan_do_v1.PreparedDatabase{}
+	}
+	for name, database := range r.Retained {
+		cluster.Spec.PreparedDatabases[name] = database
+	}
+}
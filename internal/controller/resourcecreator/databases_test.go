@@ -0,0 +1,106 @@
+package resourcecreator
+
+import (
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Databases", func() {
+	cfg := &config.Config{
+		ExtensionCatalog: config.ExtensionCatalog{
+			"pgaudit": {},
+			"pg_trgm": {},
+			"plv8":    {MaxMajorVersion: 16},
+			"postgis": {Schema: "gis"},
+		},
+	}
+
+	existing := func(databases ...string) *acid_zalan_do_v1.Postgresql {
+		cluster := &acid_zalan_do_v1.Postgresql{}
+		cluster.Spec.PreparedDatabases = map[string]acid_zalan_do_v1.PreparedDatabase{}
+		for _, database := range databases {
+			cluster.Spec.PreparedDatabases[database] = acid_zalan_do_v1.PreparedDatabase{DefaultUsers: true}
+		}
+		return cluster
+	}
+
+	It("should only prepare the app database unless more are requested", func() {
+		databases, err := GetDatabases(newPostgres(withExtensions("postgis")), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(databases).To(HaveLen(1))
+
+		prepared := databases[0].preparedDatabase("team")
+		Expect(prepared.DefaultUsers).To(BeTrue())
+		Expect(prepared.SecretNamespace).To(Equal("team"))
+		Expect(prepared.Extensions).To(Equal(map[string]string{"pgaudit": "public", "postgis": "gis"}))
+		Expect(prepared.PreparedSchemas).To(Equal(map[string]acid_zalan_do_v1.PreparedSchema{
+			"public": {DefaultRoles: ptr.To(false)},
+			"gis":    {DefaultRoles: ptr.To(false)},
+		}))
+	})
+
+	It("should prepare the requested databases with their schemas and extensions", func() {
+		databases, err := GetDatabases(newPostgres(withExtensions("postgis"), withAnnotations(map[string]string{
+			DatabasesAnnotation: `[
+				{"name": "app", "schemas": [{"name": "audit", "defaultRoles": true}]},
+				{"name": "reporting", "schemas": [{"name": "sales", "defaultRoles": true, "defaultUsers": true}], "extensions": [{"name": "pg_trgm", "schema": "search"}, {"name": "plv8"}], "defaultUsers": false}
+			]`,
+		})), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(databases).To(HaveLen(2))
+
+		app := databases[0].preparedDatabase("team")
+		Expect(app.PreparedSchemas).To(HaveKeyWithValue("audit", acid_zalan_do_v1.PreparedSchema{DefaultRoles: ptr.To(true)}))
+
+		Expect(databases[1].Name).To(Equal("reporting"))
+		Expect(databases[1].Extensions.Rejected).To(Equal([]string{"plv8"}))
+		reporting := databases[1].preparedDatabase("team")
+		Expect(reporting.DefaultUsers).To(BeFalse())
+		Expect(reporting.SecretNamespace).To(Equal("team"))
+		Expect(reporting.Extensions).To(Equal(map[string]string{"pgaudit": "public", "pg_trgm": "search"}))
+		Expect(reporting.PreparedSchemas).To(Equal(map[string]acid_zalan_do_v1.PreparedSchema{
+			"public": {DefaultRoles: ptr.To(false)},
+			"search": {DefaultRoles: ptr.To(false)},
+			"sales":  {DefaultRoles: ptr.To(true), DefaultUsers: true},
+		}))
+	})
+
+	DescribeTable("should reject invalid databases",
+		func(annotations map[string]string) {
+			_, err := GetDatabases(newPostgres(withExtensions("postgis"), withAnnotations(annotations)), cfg)
+			Expect(err).To(MatchError(reconciler.ErrInvalid))
+		},
+		Entry("not JSON", map[string]string{DatabasesAnnotation: "reporting"}),
+		Entry("invalid name", map[string]string{DatabasesAnnotation: `[{"name": "Reporting"}]`}),
+		Entry("reserved name", map[string]string{DatabasesAnnotation: `[{"name": "postgres"}]`}),
+		Entry("duplicate name", map[string]string{DatabasesAnnotation: `[{"name": "reporting"}, {"name": "reporting"}]`}),
+		Entry("extensions for the app database", map[string]string{DatabasesAnnotation: `[{"name": "app", "extensions": [{"name": "pg_trgm"}]}]`}),
+		Entry("schema users without roles", map[string]string{DatabasesAnnotation: `[{"name": "reporting", "schemas": [{"name": "sales", "defaultUsers": true}]}]`}),
+		Entry("removing a requested database", map[string]string{DatabasesAnnotation: `[{"name": "reporting"}]`, RemoveDatabasesAnnotation: "reporting"}),
+	)
+
+	It("should keep databases no longer requested until their removal is confirmed", func() {
+		removal, err := GetDatabaseRemoval(newPostgres(withExtensions("postgis")), nil, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removal.Retained).To(BeEmpty())
+
+		removal, err = GetDatabaseRemoval(newPostgres(withExtensions("postgis")), existing("app", "reporting", "archive"), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removal.RetainedNames()).To(Equal([]string{"archive", "reporting"}))
+		Expect(removal.Removed).To(BeEmpty())
+
+		cluster := existing("app")
+		removal.Apply(cluster)
+		Expect(cluster.Spec.PreparedDatabases).To(HaveKey("reporting"))
+		Expect(cluster.Spec.PreparedDatabases).To(HaveKey("archive"))
+
+		removal, err = GetDatabaseRemoval(newPostgres(withExtensions("postgis"), withAnnotations(map[string]string{RemoveDatabasesAnnotation: "reporting"})), existing("app", "reporting", "archive"), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removal.RetainedNames()).To(Equal([]string{"archive"}))
+		Expect(removal.Removed).To(Equal([]string{"reporting"}))
+	})
+})
@@ -0,0 +1,69 @@
+package resourcecreator
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+)
+
+// EffectiveAnnotationPrefix prefixes annotations on the Postgres resource showing settings that have no place in its spec.
+// They are only informational, and replaced whenever the resource is changed.
+const EffectiveAnnotationPrefix = "effective.postgres.data.nais.io/"
+
+// SetDefaults fills in the spec of postgres with the values used for the cluster where it asks for less or nothing,
+// and shows the settings that are not part of the spec in annotations, so that the resource tells what it gets
+func SetDefaults(postgres *data_nais_io_v1.Postgres, cfg *config.Config) {
+	resources := &postgres.Spec.Cluster.Resources
+	resources.DiskSize = *enforceMinimum2GiDisk(resources.DiskSize)
+
+	if postgres.Spec.Database == nil {
+		postgres.Spec.Database = &data_nais_io_v1.PostgresDatabase{}
+	}
+	postgres.Spec.Database.Collation = makeCollation(postgres)
+	for _, name := range defaultExtensions {
+		if !slices.ContainsFunc(postgres.Spec.Database.Extensions, func(extension data_nais_io_v1.PostgresExtension) bool {
+			return extension.Name == name
+		}) {
+			postgres.Spec.Database.Extensions = append(postgres.Spec.Database.Extensions, data_nais_io_v1.PostgresExtension{Name: name})
+		}
+	}
+
+	cpuLimit := makeCpuLimit(postgres)
+	effective := map[string]string{
+		"instances":    strconv.Itoa(int(makeNumberOfInstances(postgres))),
+		"cpu-limit":    cpuLimit.String(),
+		"memory-limit": resources.Memory.String(),
+	}
+	// Invalid pooler settings are reported when reconciling
+	if pooler, err := GetConnectionPooler(postgres); err == nil {
+		effective["connection-pooler-mode"] = string(pooler.Mode)
+		effective["connection-pooler-instances"] = strconv.Itoa(int(pooler.Instances))
+	}
+	// An invalid schedule is reported when reconciling
+	if logicalBackup, err := GetLogicalBackup(postgres, cfg); err == nil {
+		effective["logical-backup-schedule"] = "disabled"
+		if logicalBackup.Enabled() {
+			effective["logical-backup-schedule"] = logicalBackup.Schedule
+			effective["logical-backup-retention"] = logicalBackup.Retention
+		}
+	}
+
+	annotations := postgres.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for key := range annotations {
+		if strings.HasPrefix(key, EffectiveAnnotationPrefix) {
+			delete(annotations, key)
+		}
+	}
+	for key, value := range effective {
+		if len(value) > 0 {
+			annotations[EffectiveAnnotationPrefix+key] = value
+		}
+	}
+	postgres.SetAnnotations(annotations)
+}
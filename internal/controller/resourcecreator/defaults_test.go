@@ -0,0 +1,60 @@
+package resourcecreator
+
+import (
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("Defaults", func() {
+	cfg := &config.Config{
+		LogicalBackupSchedule:  "30 0 * * *",
+		LogicalBackupRetention: "14 days",
+	}
+
+	resources := withResources("1G", "500m", "1Gi")
+	stale := withAnnotations(map[string]string{EffectiveAnnotationPrefix + "stale": "true"})
+
+	It("should fill in the spec with what the cluster gets", func() {
+		p := newPostgres(resources, stale)
+		SetDefaults(p, cfg)
+		Expect(p.Spec.Cluster.Resources.DiskSize.String()).To(Equal("2Gi"))
+		Expect(p.Spec.Database.Collation).To(Equal("en_US"))
+		Expect(p.Spec.Database.Extensions).To(ConsistOf(data_nais_io_v1.PostgresExtension{Name: "pgaudit"}))
+	})
+
+	It("should keep what is asked for", func() {
+		p := newPostgres(resources, stale)
+		p.Spec.Cluster.Resources.DiskSize = resource.MustParse("10Gi")
+		p.Spec.Database = &data_nais_io_v1.PostgresDatabase{
+			Collation:  "nb_NO",
+			Extensions: []data_nais_io_v1.PostgresExtension{{Name: "pgaudit"}, {Name: "postgis"}},
+		}
+		SetDefaults(p, cfg)
+		Expect(p.Spec.Cluster.Resources.DiskSize.String()).To(Equal("10Gi"))
+		Expect(p.Spec.Database.Collation).To(Equal("nb_NO"))
+		Expect(p.Spec.Database.Extensions).To(HaveLen(2))
+	})
+
+	It("should show the settings that are not in the spec", func() {
+		p := newPostgres(resources, stale)
+		p.Spec.Cluster.HighAvailability = true
+		SetDefaults(p, cfg)
+		Expect(p.GetAnnotations()).To(Equal(map[string]string{
+			EffectiveAnnotationPrefix + "instances":                   "3",
+			EffectiveAnnotationPrefix + "cpu-limit":                   "2",
+			EffectiveAnnotationPrefix + "memory-limit":                "1Gi",
+			EffectiveAnnotationPrefix + "connection-pooler-mode":      "transaction",
+			EffectiveAnnotationPrefix + "connection-pooler-instances": "2",
+			EffectiveAnnotationPrefix + "logical-backup-schedule":     "30 0 * * *",
+			EffectiveAnnotationPrefix + "logical-backup-retention":    "14 days",
+		}))
+
+		p.Annotations[LogicalBackupScheduleAnnotation] = ""
+		SetDefaults(p, cfg)
+		Expect(p.GetAnnotations()).To(HaveKeyWithValue(EffectiveAnnotationPrefix+"logical-backup-schedule", "disabled"))
+		Expect(p.GetAnnotations()).NotTo(HaveKey(EffectiveAnnotationPrefix + "logical-backup-retention"))
+	})
+})
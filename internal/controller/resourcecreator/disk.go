@@ -0,0 +1,136 @@
+package resourcecreator
+
+import (
+	"fmt"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// DiskAutoGrowMaxAnnotation enables growing the disk when it is almost full, up to the given size, e.g. "100Gi".
+	// The disk size in the spec is then only the least size of the disk.
+	DiskAutoGrowMaxAnnotation = "postgres.data.nais.io/disk-autogrow-max"
+
+	// diskGrowthPercent is how much the disk grows each time usage is high
+	diskGrowthPercent = 50
+
+	gibibyte = int64(1 << 30)
+)
+
+// DiskResize describes the size of the cluster volumes, compared to the volumes of the existing cluster
+type DiskResize struct {
+	// Requested is the size in the spec, at least the minimum size
+	Requested resource.Quantity
+	// Current is the largest size requested for the existing cluster or any of its volumes, nil for new clusters
+	Current *resource.Quantity
+	// Capacity is the smallest capacity reported by the volumes, nil until any are bound
+	Capacity *resource.Quantity
+	// AutoGrowMax is the largest size the disk is grown to automatically, nil when automatic growth is disabled
+	AutoGrowMax *resource.Quantity
+	// UsageHigh is set when disk usage is high enough for the PostgresDiskUsageHigh alert to fire
+	UsageHigh bool
+}
+
+// GetDiskResize compares the requested disk size with the existing cluster and its volumes.
+// Volumes are never shrunk, as neither Zalando nor Kubernetes is able to.
+func GetDiskResize(postgres *data_nais_io_v1.Postgres, existing *acid_zalan_do_v1.Postgresql, pvcs []v1.PersistentVolumeClaim, cfg *config.Config) (DiskResize, error) {
+	disk := DiskResize{
+		Requested: *enforceMinimum2GiDisk(postgres.Spec.Cluster.Resources.DiskSize),
+	}
+
+	if value, ok := postgres.GetAnnotations()[DiskAutoGrowMaxAnnotation]; ok {
+		autoGrowMax, err := resource.ParseQuantity(value)
+		if err != nil {
+			return DiskResize{}, fmt.Errorf("%w: %s must be a size like 100Gi, not %q", reconciler.ErrInvalid, DiskAutoGrowMaxAnnotation, value)
+		}
+		if len(cfg.PrometheusURL) == 0 {
+			return DiskResize{}, fmt.Errorf("%w: automatic disk growth is not available, as disk usage metrics are not configured", reconciler.ErrInvalid)
+		}
+		disk.AutoGrowMax = &autoGrowMax
+	}
+
+	if existing != nil && len(existing.Spec.Volume.Size) > 0 {
+		size, err := resource.ParseQuantity(existing.Spec.Volume.Size)
+		if err != nil {
+			return DiskResize{}, fmt.Errorf("parsing volume size %q of existing cluster: %w", existing.Spec.Volume.Size, err)
+		}
+		disk.Current = &size
+	}
+
+	for _, pvc := range pvcs {
+		if request, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]; ok && (disk.Current == nil || request.Cmp(*disk.Current) > 0) {
+			disk.Current = &request
+		}
+		if capacity, ok := pvc.Status.Capacity[v1.ResourceStorage]; ok && (disk.Capacity == nil || capacity.Cmp(*disk.Capacity) < 0) {
+			disk.Capacity = &capacity
+		}
+	}
+
+	return disk, nil
+}
+
+// AutoGrowEnabled returns true when the disk is grown automatically when usage is high
+func (d DiskResize) AutoGrowEnabled() bool {
+	return d.AutoGrowMax != nil
+}
+
+// ShrinkRejected returns true when the requested size is smaller than the existing volumes.
+// When growing automatically, the disk is expected to be larger than requested.
+func (d DiskResize) ShrinkRejected() bool {
+	return !d.AutoGrowEnabled() && d.Current != nil && d.Requested.Cmp(*d.Current) < 0
+}
+
+// AutoGrowing returns true when usage is high, and the disk is grown automatically this time
+func (d DiskResize) AutoGrowing() bool {
+	current := d.current()
+	return d.AutoGrowEnabled() && d.UsageHigh &&
+		// Wait for the last resize to finish, the usage reported until then is of the old capacity
+		d.Capacity != nil && d.Capacity.Cmp(current) >= 0 &&
+		current.Cmp(*d.AutoGrowMax) < 0
+}
+
+// AutoGrowLimitReached returns true when usage is high, but the disk is already as large as it is grown automatically
+func (d DiskResize) AutoGrowLimitReached() bool {
+	current := d.current()
+	return d.AutoGrowEnabled() && d.UsageHigh && current.Cmp(*d.AutoGrowMax) >= 0
+}
+
+// Resizing returns true until all volumes report the desired capacity
+func (d DiskResize) Resizing() bool {
+	size := d.Size()
+	return d.Capacity != nil && d.Capacity.Cmp(size) < 0
+}
+
+// Size returns the desired size of the volumes, which is never smaller than the existing volumes
+func (d DiskResize) Size() resource.Quantity {
+	size := d.current()
+	if !d.AutoGrowing() {
+		return size
+	}
+
+	grown := size.Value() * (100 + diskGrowthPercent) / 100
+	grown = (grown + gibibyte - 1) / gibibyte * gibibyte
+	if grown > d.AutoGrowMax.Value() {
+		return d.AutoGrowMax.DeepCopy()
+	}
+	return *resource.NewQuantity(grown, resource.BinarySI)
+}
+
+// current returns the requested size, or the size of the existing volumes if they are larger
+func (d DiskResize) current() resource.Quantity {
+	if d.Current != nil && d.Current.Cmp(d.Requested) > 0 {
+		return d.Current.DeepCopy()
+	}
+	return d.Requested.DeepCopy()
+}
+
+// Apply sets the volume size of the cluster, which Zalando resizes the volumes to
+func (d DiskResize) Apply(cluster *acid_zalan_do_v1.Postgresql) {
+	size := d.Size()
+	cluster.Spec.Volume.Size = size.String()
+}
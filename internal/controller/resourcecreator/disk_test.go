@@ -0,0 +1,108 @@
+package resourcecreator
+
+import (
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("Disk resize", func() {
+	cfg := &config.Config{
+		PrometheusURL: "http://prometheus",
+	}
+
+	existing := func(volumeSize string) *acid_zalan_do_v1.Postgresql {
+		cluster := &acid_zalan_do_v1.Postgresql{}
+		cluster.Spec.Volume.Size = volumeSize
+		return cluster
+	}
+
+	pvc := func(request, capacity string) v1.PersistentVolumeClaim {
+		claim := v1.PersistentVolumeClaim{}
+		claim.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse(request)}
+		if len(capacity) > 0 {
+			claim.Status.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse(capacity)}
+		}
+		return claim
+	}
+
+	autoGrow := map[string]string{DiskAutoGrowMaxAnnotation: "20Gi"}
+
+	It("should use the requested size for new clusters", func() {
+		disk, err := GetDiskResize(newPostgres(withDiskSize("1Gi")), nil, nil, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(disk.Size()).To(Equal(resource.MustParse("2Gi")))
+		Expect(disk.ShrinkRejected()).To(BeFalse())
+		Expect(disk.Resizing()).To(BeFalse())
+	})
+
+	It("should keep the size of the existing volumes when asked to shrink", func() {
+		disk, err := GetDiskResize(newPostgres(withDiskSize("5Gi")), existing("10Gi"), []v1.PersistentVolumeClaim{pvc("10Gi", "10Gi")}, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(disk.ShrinkRejected()).To(BeTrue())
+
+		cluster := existing("5Gi")
+		disk.Apply(cluster)
+		Expect(cluster.Spec.Volume.Size).To(Equal("10Gi"))
+	})
+
+	It("should grow and follow the resize until all volumes have the new capacity", func() {
+		disk, err := GetDiskResize(newPostgres(withDiskSize("20Gi")), existing("10Gi"), []v1.PersistentVolumeClaim{pvc("10Gi", "10Gi"), pvc("20Gi", "10Gi")}, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(disk.Size()).To(Equal(resource.MustParse("20Gi")))
+		Expect(disk.Resizing()).To(BeTrue())
+
+		disk, err = GetDiskResize(newPostgres(withDiskSize("20Gi")), existing("20Gi"), []v1.PersistentVolumeClaim{pvc("20Gi", "20Gi"), pvc("20Gi", "20Gi")}, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(disk.Resizing()).To(BeFalse())
+	})
+
+	It("should grow the disk automatically when usage is high", func() {
+		disk, err := GetDiskResize(newPostgres(withDiskSize("5Gi"), withAnnotations(autoGrow)), existing("5Gi"), []v1.PersistentVolumeClaim{pvc("5Gi", "5Gi")}, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(disk.AutoGrowing()).To(BeFalse())
+
+		disk.UsageHigh = true
+		Expect(disk.AutoGrowing()).To(BeTrue())
+		Expect(disk.Size()).To(Equal(resource.MustParse("8Gi")))
+	})
+
+	It("should not grow the disk automatically while resizing or beyond the limit", func() {
+		disk, err := GetDiskResize(newPostgres(withDiskSize("5Gi"), withAnnotations(autoGrow)), existing("8Gi"), []v1.PersistentVolumeClaim{pvc("8Gi", "5Gi")}, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		disk.UsageHigh = true
+		Expect(disk.AutoGrowing()).To(BeFalse())
+		Expect(disk.ShrinkRejected()).To(BeFalse())
+		Expect(disk.Size()).To(Equal(resource.MustParse("8Gi")))
+
+		disk, err = GetDiskResize(newPostgres(withDiskSize("5Gi"), withAnnotations(autoGrow)), existing("18Gi"), []v1.PersistentVolumeClaim{pvc("18Gi", "18Gi")}, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		disk.UsageHigh = true
+		Expect(disk.Size()).To(Equal(resource.MustParse("20Gi")))
+
+		disk, err = GetDiskResize(newPostgres(withDiskSize("5Gi"), withAnnotations(autoGrow)), existing("20Gi"), []v1.PersistentVolumeClaim{pvc("20Gi", "20Gi")}, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		disk.UsageHigh = true
+		Expect(disk.AutoGrowing()).To(BeFalse())
+		Expect(disk.AutoGrowLimitReached()).To(BeTrue())
+	})
+
+	It("should reject invalid automatic growth", func() {
+		_, err := GetDiskResize(newPostgres(withDiskSize("5Gi"), withAnnotations(map[string]string{DiskAutoGrowMaxAnnotation: "lots"})), nil, nil, cfg)
+		Expect(err).To(MatchError(reconciler.ErrInvalid))
+
+		_, err = GetDiskResize(newPostgres(withDiskSize("5Gi"), withAnnotations(autoGrow)), nil, nil, &config.Config{})
+		Expect(err).To(MatchError(reconciler.ErrInvalid))
+	})
+
+	It("should query the same disk usage as the alert", func() {
+		query := DiskUsageHighQuery("app", "pg-team")
+		Expect(query).To(HavePrefix("min_over_time(("))
+		Expect(query).To(ContainSubstring(`kubelet_volume_stats_used_bytes{namespace="pg-team", persistentvolumeclaim=~"pgdata-app-[0-9]"}`))
+		Expect(query).To(HaveSuffix(")[5m:]) > 0.9"))
+	})
+})
@@ -0,0 +1,164 @@
+package resourcecreator
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+)
+
+// ExtensionSchemasAnnotation pins extensions in the app database to schemas other than the one in the catalog,
+// e.g. "postgis=gis,pg_cron=cron"
+const ExtensionSchemasAnnotation = "postgres.data.nais.io/extension-schemas"
+
+// identifierPattern is the unquoted identifiers Zalando can create databases and schemas for
+var identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// spiloExtensionCatalog lists the extensions in the Spilo image, used unless a catalog is configured
+var spiloExtensionCatalog = config.ExtensionCatalog{
+	"amcheck":            {},
+	"btree_gin":          {},
+	"btree_gist":         {},
+	"citext":             {},
+	"cube":               {},
+	"dblink":             {},
+	"earthdistance":      {},
+	"fuzzystrmatch":      {},
+	"hstore":             {},
+	"hypopg":             {},
+	"intarray":           {},
+	"isn":                {},
+	"lo":                 {},
+	"ltree":              {},
+	"pg_buffercache":     {},
+	"pg_cron":            {},
+	"pg_partman":         {},
+	"pg_repack":          {},
+	"pg_stat_kcache":     {},
+	"pg_stat_statements": {},
+	"pg_trgm":            {},
+	"pgaudit":            {},
+	"pgcrypto":           {},
+	"pgrouting":          {},
+	"pgstattuple":        {},
+	"plpgsql_check":      {},
+	"plv8":               {MaxMajorVersion: 16},
+	"postgis":            {},
+	"postgis_raster":     {},
+	"postgis_topology":   {},
+	"postgres_fdw":       {},
+	"tablefunc":          {},
+	"timescaledb":        {},
+	"unaccent":           {},
+	"uuid-ossp":          {},
+	"vector":             {},
+}
+
+// Extensions are the extensions requested for the database, split by whether they are available in its major version
+type Extensions struct {
+	MajorVersion string
+	// Enabled maps the available extensions to the schema they are created in
+	Enabled map[string]string
+	// Rejected lists the extensions that are unknown or not available in the major version, which are left out
+	Rejected []string
+}
+
+func extensionCatalog(cfg *config.Config) config.ExtensionCatalog {
+	if len(cfg.ExtensionCatalog) > 0 {
+		return cfg.ExtensionCatalog
+	}
+	return spiloExtensionCatalog
+}
+
+// AvailableExtensions returns the names of the extensions in the catalog that are available in the major version
+func AvailableExtensions(cfg *config.Config, majorVersion int) []string {
+	var names []string
+	for name, extension := range extensionCatalog(cfg) {
+		if extension.AvailableIn(majorVersion) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// requestedExtensions returns the names of the default extensions, and those in the spec
+func requestedExtensions(postgres *data_nais_io_v1.Postgres) []string {
+	extensions := slices.Clone(defaultExtensions)
+	if postgres.Spec.Database != nil {
+		for _, extension := range postgres.Spec.Database.Extensions {
+			extensions = append(extensions, extension.Name)
+		}
+	}
+	slices.Sort(extensions)
+	return slices.Compact(extensions)
+}
+
+// ExtensionSchemas returns the schemas extensions are pinned to in the annotations of postgres
+func ExtensionSchemas(postgres *data_nais_io_v1.Postgres) (map[string]string, error) {
+	schemas := map[string]string{}
+	value := postgres.GetAnnotations()[ExtensionSchemasAnnotation]
+	if len(value) == 0 {
+		return schemas, nil
+	}
+
+	requested := requestedExtensions(postgres)
+	for _, pair := range strings.Split(value, ",") {
+		name, schema, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !identifierPattern.MatchString(schema) {
+			return nil, fmt.Errorf("%w: %s must be a list of extension=schema, with schema names in lower case, not %q", reconciler.ErrInvalid, ExtensionSchemasAnnotation, pair)
+		}
+		if !slices.Contains(requested, name) {
+			return nil, fmt.Errorf("%w: %s pins the schema of %s, which is not requested", reconciler.ErrInvalid, ExtensionSchemasAnnotation, name)
+		}
+		schemas[name] = schema
+	}
+	return schemas, nil
+}
+
+// GetExtensions checks the extensions requested for the app database against the catalog, and finds the schemas they
+// are created in
+func GetExtensions(postgres *data_nais_io_v1.Postgres, cfg *config.Config) (Extensions, error) {
+	schemas, err := ExtensionSchemas(postgres)
+	if err != nil {
+		return Extensions{}, err
+	}
+	return resolveExtensions(requestedExtensions(postgres), schemas, postgres.Spec.Cluster.MajorVersion, cfg)
+}
+
+// resolveExtensions checks the requested extensions against the catalog. Extensions are created in the schema pinned in
+// schemas, or else the schema in the catalog.
+func resolveExtensions(requested []string, schemas map[string]string, majorVersion string, cfg *config.Config) (Extensions, error) {
+	version, err := strconv.Atoi(majorVersion)
+	if err != nil {
+		return Extensions{}, fmt.Errorf("%w: major version %q is not a number", reconciler.ErrInvalid, majorVersion)
+	}
+
+	catalog := extensionCatalog(cfg)
+	extensions := Extensions{
+		MajorVersion: majorVersion,
+		Enabled:      map[string]string{},
+	}
+	for _, name := range requested {
+		extension, ok := catalog[name]
+		if !ok || !extension.AvailableIn(version) {
+			extensions.Rejected = append(extensions.Rejected, name)
+			continue
+		}
+
+		schema := defaultSchema
+		if len(extension.Schema) > 0 {
+			schema = extension.Schema
+		}
+		if pinned, ok := schemas[name]; ok {
+			schema = pinned
+		}
+		extensions.Enabled[name] = schema
+	}
+	return extensions, nil
+}
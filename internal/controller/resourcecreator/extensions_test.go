@@ -0,0 +1,76 @@
+package resourcecreator
+
+import (
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Extensions", func() {
+	cfg := &config.Config{
+		ExtensionCatalog: config.ExtensionCatalog{
+			"pgaudit":   {},
+			"pg_trgm":   {},
+			"plv8":      {MaxMajorVersion: 16},
+			"postgis":   {Schema: "gis"},
+			"pg_future": {MinMajorVersion: 18},
+		},
+	}
+
+	It("should decode the catalog from JSON", func() {
+		catalog := config.ExtensionCatalog{}
+		Expect(catalog.EnvDecode(`{"postgis": {"schema": "gis"}, "plv8": {"maxMajorVersion": 16}}`)).To(Succeed())
+		Expect(catalog).To(Equal(config.ExtensionCatalog{
+			"postgis": {Schema: "gis"},
+			"plv8":    {MaxMajorVersion: 16},
+		}))
+
+		Expect(catalog.EnvDecode(`plv8:16`)).NotTo(Succeed())
+	})
+
+	It("should enable the default extensions in the public schema", func() {
+		extensions, err := GetExtensions(newPostgres(), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extensions.Enabled).To(Equal(map[string]string{"pgaudit": "public"}))
+		Expect(extensions.Rejected).To(BeEmpty())
+	})
+
+	It("should leave out extensions that are unknown or not available in the major version", func() {
+		extensions, err := GetExtensions(newPostgres(withExtensions("pg_trgm", "plv8", "pg_future", "pg_magic")), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extensions.Enabled).To(HaveKey("pg_trgm"))
+		Expect(extensions.Rejected).To(Equal([]string{"pg_future", "pg_magic", "plv8"}))
+
+		extensions, err = GetExtensions(newPostgres(withMajorVersion("16"), withExtensions("plv8")), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extensions.Enabled).To(HaveKey("plv8"))
+		Expect(extensions.Rejected).To(BeEmpty())
+	})
+
+	It("should create extensions in the schema from the catalog or the annotation", func() {
+		extensions, err := GetExtensions(newPostgres(withExtensions("postgis")), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extensions.Enabled).To(HaveKeyWithValue("postgis", "gis"))
+
+		extensions, err = GetExtensions(newPostgres(withAnnotations(map[string]string{ExtensionSchemasAnnotation: "postgis=geo, pg_trgm=search"}), withExtensions("postgis", "pg_trgm")), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extensions.Enabled).To(Equal(map[string]string{"pgaudit": "public", "postgis": "geo", "pg_trgm": "search"}))
+	})
+
+	DescribeTable("should reject invalid schema annotations",
+		func(value string) {
+			_, err := GetExtensions(newPostgres(withAnnotations(map[string]string{ExtensionSchemasAnnotation: value}), withExtensions("postgis")), cfg)
+			Expect(err).To(MatchError(reconciler.ErrInvalid))
+		},
+		Entry("missing schema", "postgis"),
+		Entry("quoted identifier", "postgis=Geo Data"),
+		Entry("extension not requested", "pg_trgm=search"),
+	)
+
+	It("should use the extensions in the Spilo image when no catalog is configured", func() {
+		Expect(AvailableExtensions(&config.Config{}, 16)).To(ContainElement("plv8"))
+		Expect(AvailableExtensions(&config.Config{}, 17)).NotTo(ContainElement("plv8"))
+		Expect(AvailableExtensions(&config.Config{}, 17)).To(ContainElement("postgis"))
+	})
+})
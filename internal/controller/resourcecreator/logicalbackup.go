@@ -0,0 +1,67 @@
+package resourcecreator
+
+import (
+	"fmt"
+	"regexp"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	batch_v1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// LogicalBackupScheduleAnnotation overrides the default cron schedule for logical backups. An empty value disables them.
+	LogicalBackupScheduleAnnotation = "postgres.data.nais.io/logical-backup-schedule"
+	// LogicalBackupRetentionAnnotation overrides how long logical backups are kept, e.g. "14 days"
+	LogicalBackupRetentionAnnotation = "postgres.data.nais.io/logical-backup-retention"
+
+	// logicalBackupJobPrefix is prepended to the cluster name by Zalando when naming the logical backup CronJob
+	logicalBackupJobPrefix = "logical-backup-"
+)
+
+// cronSchedulePattern is the pattern Zalando requires for logicalBackupSchedule
+var cronSchedulePattern = regexp.MustCompile(`^(\d+|\*)(/\d+)?(\s+(\d+|\*)(/\d+)?){4}$`)
+
+type LogicalBackup struct {
+	Schedule  string
+	Retention string
+}
+
+func (b LogicalBackup) Enabled() bool {
+	return len(b.Schedule) > 0
+}
+
+// GetLogicalBackup returns the logical backup settings for postgres, from its annotations or the configured defaults
+func GetLogicalBackup(postgres *data_nais_io_v1.Postgres, cfg *config.Config) (LogicalBackup, error) {
+	backup := LogicalBackup{
+		Schedule:  cfg.LogicalBackupSchedule,
+		Retention: cfg.LogicalBackupRetention,
+	}
+	if schedule, ok := postgres.GetAnnotations()[LogicalBackupScheduleAnnotation]; ok {
+		backup.Schedule = schedule
+	}
+	if retention, ok := postgres.GetAnnotations()[LogicalBackupRetentionAnnotation]; ok {
+		backup.Retention = retention
+	}
+
+	if backup.Enabled() && !cronSchedulePattern.MatchString(backup.Schedule) {
+		return LogicalBackup{}, fmt.Errorf("%w: logical backup schedule %q is not a valid cron schedule", reconciler.ErrInvalid, backup.Schedule)
+	}
+	return backup, nil
+}
+
+// MinimalLogicalBackupCronJob identifies the CronJob Zalando creates for logical backups of the cluster
+func MinimalLogicalBackupCronJob(pgClusterName string, pgNamespace string) *batch_v1.CronJob {
+	return &batch_v1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CronJob",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      logicalBackupJobPrefix + pgClusterName,
+			Namespace: pgNamespace,
+		},
+	}
+}
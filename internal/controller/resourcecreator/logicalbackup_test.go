@@ -0,0 +1,60 @@
+package resourcecreator
+
+import (
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetLogicalBackup", func() {
+	cfg := &config.Config{
+		LogicalBackupSchedule:  "30 0 * * *",
+		LogicalBackupRetention: "14 days",
+	}
+
+	It("should use the configured defaults", func() {
+		backup, err := GetLogicalBackup(newPostgres(), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backup.Enabled()).To(BeTrue())
+		Expect(backup).To(Equal(LogicalBackup{Schedule: "30 0 * * *", Retention: "14 days"}))
+	})
+
+	It("should let annotations override the defaults", func() {
+		backup, err := GetLogicalBackup(newPostgres(withAnnotations(map[string]string{
+			LogicalBackupScheduleAnnotation:  "0 */6 * * *",
+			LogicalBackupRetentionAnnotation: "1 month",
+		})), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backup).To(Equal(LogicalBackup{Schedule: "0 */6 * * *", Retention: "1 month"}))
+	})
+
+	It("should disable backups with an empty schedule", func() {
+		backup, err := GetLogicalBackup(newPostgres(withAnnotations(map[string]string{
+			LogicalBackupScheduleAnnotation: "",
+		})), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backup.Enabled()).To(BeFalse())
+
+		backup, err = GetLogicalBackup(newPostgres(), &config.Config{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backup.Enabled()).To(BeFalse())
+	})
+
+	It("should reject invalid schedules", func() {
+		_, err := GetLogicalBackup(newPostgres(withAnnotations(map[string]string{
+			LogicalBackupScheduleAnnotation: "every night",
+		})), cfg)
+		Expect(err).To(MatchError(reconciler.ErrInvalid))
+	})
+
+	It("should configure logical backups on the cluster", func() {
+		postgres := newPostgres()
+		postgres.Spec.Cluster.MajorVersion = "17"
+		cluster, err := CreateClusterSpec(postgres, cfg, Clone{}, "app", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.EnableLogicalBackup).To(BeTrue())
+		Expect(cluster.Spec.LogicalBackupSchedule).To(Equal("30 0 * * *"))
+		Expect(cluster.Spec.LogicalBackupRetention).To(Equal("14 days"))
+	})
+})
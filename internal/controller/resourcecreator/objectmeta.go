@@ -6,6 +6,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// NameLabel is set to the name of the Postgres on everything created for it
+const NameLabel = "postgres.data.nais.io/name"
+
 func CreateObjectMeta(postgres *data_nais_io_v1.Postgres) metav1.ObjectMeta {
 	labels := map[string]string{}
 
@@ -13,7 +16,7 @@ func CreateObjectMeta(postgres *data_nais_io_v1.Postgres) metav1.ObjectMeta {
 		labels[k] = v
 	}
 
-	labels["postgres.data.nais.io/name"] = postgres.GetName()
+	labels[NameLabel] = postgres.GetName()
 
 	return metav1.ObjectMeta{
 		Name:      postgres.GetName(),
@@ -0,0 +1,189 @@
+package resourcecreator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// ConnectionPoolerAnnotation configures the connection pooler in front of the cluster, as a JSON object, e.g.
+	// {"mode": "session", "maxDBConnections": 100, "instances": 3, "cpu": "100m", "memory": "200Mi"}.
+	// Settings left out keep their defaults.
+	ConnectionPoolerAnnotation = "postgres.data.nais.io/connection-pooler"
+
+	// ReadReplicasAnnotation lets applications read from the replicas of the cluster when "true", through a connection
+	// pooler of their own with the same settings. The connection secret then has keys suffixed with _REPLICA.
+	// Only clusters with high availability have replicas to read from.
+	ReadReplicasAnnotation = "postgres.data.nais.io/read-replicas"
+)
+
+// PoolerMode is when PgBouncer gives a server connection back to the pool
+type PoolerMode string
+
+const (
+	// PoolerModeSession keeps the server connection until the client disconnects
+	PoolerModeSession PoolerMode = "session"
+	// PoolerModeTransaction keeps the server connection until the end of each transaction, which rules out session
+	// features like prepared statements kept across transactions, advisory locks and LISTEN
+	PoolerModeTransaction PoolerMode = "transaction"
+)
+
+const (
+	defaultPoolerMode             = PoolerModeTransaction
+	defaultPoolerMaxDBConnections = int32(60)
+	defaultPoolerInstances        = int32(2)
+	defaultPoolerCpu              = "50m"
+	defaultPoolerMemory           = "50Mi"
+
+	maxPoolerInstances = int32(10)
+)
+
+// minPoolerCpuLimit keeps PgBouncer from being throttled below the limit Zalando gives it by default
+var minPoolerCpuLimit = resource.MustParse("1")
+
+// ConnectionPoolerRequest is the settings requested in ConnectionPoolerAnnotation
+type ConnectionPoolerRequest struct {
+	Mode PoolerMode `json:"mode,omitempty"`
+	// MaxDBConnections is the number of connections to Postgres shared by all instances of the pooler
+	MaxDBConnections *int32 `json:"maxDBConnections,omitempty"`
+	Instances        *int32 `json:"instances,omitempty"`
+	Cpu              string `json:"cpu,omitempty"`
+	Memory           string `json:"memory,omitempty"`
+}
+
+// ConnectionPooler is the PgBouncer Zalando runs in front of the primary, and of the replicas when read replicas are
+// requested
+type ConnectionPooler struct {
+	Mode             PoolerMode
+	MaxDBConnections int32
+	Instances        int32
+	Cpu              resource.Quantity
+	Memory           resource.Quantity
+	// CpuLimit and MemoryLimit are only set when the resources are asked for, and are otherwise left to Zalando, whose
+	// default limits could be below larger requests
+	CpuLimit     *resource.Quantity
+	MemoryLimit  *resource.Quantity
+	ReadReplicas bool
+}
+
+// GetConnectionPooler returns the connection pooler settings for postgres, from its annotations or the defaults
+func GetConnectionPooler(postgres *data_nais_io_v1.Postgres) (ConnectionPooler, error) {
+	readReplicas, err := ReadReplicasRequested(postgres)
+	if err != nil {
+		return ConnectionPooler{}, err
+	}
+	pooler := ConnectionPooler{
+		Mode:             defaultPoolerMode,
+		MaxDBConnections: defaultPoolerMaxDBConnections,
+		Instances:        defaultPoolerInstances,
+		Cpu:              resource.MustParse(defaultPoolerCpu),
+		Memory:           resource.MustParse(defaultPoolerMemory),
+		ReadReplicas:     readReplicas,
+	}
+
+	value := postgres.GetAnnotations()[ConnectionPoolerAnnotation]
+	if len(value) == 0 {
+		return pooler, nil
+	}
+	var request ConnectionPoolerRequest
+	if err := json.Unmarshal([]byte(value), &request); err != nil {
+		return ConnectionPooler{}, fmt.Errorf("%w: %s must be a JSON object with the settings of the pooler: %w", reconciler.ErrInvalid, ConnectionPoolerAnnotation, err)
+	}
+
+	switch request.Mode {
+	case "":
+	case PoolerModeSession, PoolerModeTransaction:
+		pooler.Mode = request.Mode
+	default:
+		return ConnectionPooler{}, fmt.Errorf("%w: %s has mode %q, must be %s or %s", reconciler.ErrInvalid, ConnectionPoolerAnnotation, request.Mode, PoolerModeSession, PoolerModeTransaction)
+	}
+	if request.MaxDBConnections != nil {
+		pooler.MaxDBConnections = *request.MaxDBConnections
+	}
+	if request.Instances != nil {
+		pooler.Instances = *request.Instances
+	}
+	if pooler.Instances < 1 || pooler.Instances > maxPoolerInstances {
+		return ConnectionPooler{}, fmt.Errorf("%w: %s has %d instances, must be from 1 to %d", reconciler.ErrInvalid, ConnectionPoolerAnnotation, pooler.Instances, maxPoolerInstances)
+	}
+	// Each instance needs at least one connection of its own
+	if pooler.MaxDBConnections < pooler.Instances {
+		return ConnectionPooler{}, fmt.Errorf("%w: %s has %d max DB connections, must be at least one for each of the %d instances", reconciler.ErrInvalid, ConnectionPoolerAnnotation, pooler.MaxDBConnections, pooler.Instances)
+	}
+	// The memory limit is the same as the request, as for Postgres, while the CPU limit is a multiple of the request
+	if len(request.Cpu) > 0 {
+		if pooler.Cpu, err = parsePoolerQuantity("cpu", request.Cpu); err != nil {
+			return ConnectionPooler{}, err
+		}
+		cpuLimit := pooler.Cpu.DeepCopy()
+		cpuLimit.Mul(cpuLimitFactor)
+		if cpuLimit.Cmp(minPoolerCpuLimit) < 0 {
+			cpuLimit = minPoolerCpuLimit.DeepCopy()
+		}
+		pooler.CpuLimit = &cpuLimit
+	}
+	if len(request.Memory) > 0 {
+		if pooler.Memory, err = parsePoolerQuantity("memory", request.Memory); err != nil {
+			return ConnectionPooler{}, err
+		}
+		pooler.MemoryLimit = ptr.To(pooler.Memory.DeepCopy())
+	}
+	return pooler, nil
+}
+
+func parsePoolerQuantity(name, value string) (resource.Quantity, error) {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil || quantity.Sign() <= 0 {
+		return resource.Quantity{}, fmt.Errorf("%w: %s has %s %q, must be a positive quantity", reconciler.ErrInvalid, ConnectionPoolerAnnotation, name, value)
+	}
+	return quantity, nil
+}
+
+// ReadReplicasRequested returns true if the annotations of postgres ask for reading from the replicas
+func ReadReplicasRequested(postgres *data_nais_io_v1.Postgres) (bool, error) {
+	value, ok := postgres.GetAnnotations()[ReadReplicasAnnotation]
+	if !ok {
+		return false, nil
+	}
+	readReplicas, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s must be true or false, not %q", reconciler.ErrInvalid, ReadReplicasAnnotation, value)
+	}
+	if readReplicas && !postgres.Spec.Cluster.HighAvailability {
+		return false, fmt.Errorf("%w: %s requires high availability, as there are no replicas to read from without it", reconciler.ErrInvalid, ReadReplicasAnnotation)
+	}
+	return readReplicas, nil
+}
+
+// apply enables the connection poolers of the cluster
+func (p ConnectionPooler) apply(cluster *acid_zalan_do_v1.Postgresql) {
+	var limits acid_zalan_do_v1.ResourceDescription
+	if p.CpuLimit != nil {
+		limits.CPU = ptr.To(p.CpuLimit.String())
+	}
+	if p.MemoryLimit != nil {
+		limits.Memory = ptr.To(p.MemoryLimit.String())
+	}
+
+	cluster.Spec.EnableConnectionPooler = ptr.To(true)
+	cluster.Spec.EnableReplicaConnectionPooler = ptr.To(p.ReadReplicas)
+	cluster.Spec.ConnectionPooler = &acid_zalan_do_v1.ConnectionPooler{
+		NumberOfInstances: ptr.To(p.Instances),
+		Mode:              string(p.Mode),
+		MaxDBConnections:  ptr.To(p.MaxDBConnections),
+		Resources: &acid_zalan_do_v1.Resources{
+			ResourceRequests: acid_zalan_do_v1.ResourceDescription{
+				CPU:    ptr.To(p.Cpu.String()),
+				Memory: ptr.To(p.Memory.String()),
+			},
+			ResourceLimits: limits,
+		},
+	}
+}
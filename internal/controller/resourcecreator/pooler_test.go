@@ -0,0 +1,77 @@
+package resourcecreator
+
+import (
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Connection pooler", func() {
+	It("should run a pooler in transaction mode in front of the primary by default", func() {
+		cluster, err := CreateClusterSpec(newPostgres(withResources("2Gi", "100m", "1Gi")), &config.Config{}, Clone{}, "app", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.EnableConnectionPooler).To(Equal(ptr.To(true)))
+		Expect(cluster.Spec.EnableReplicaConnectionPooler).To(Equal(ptr.To(false)))
+		Expect(cluster.Spec.ConnectionPooler).To(Equal(&acid_zalan_do_v1.ConnectionPooler{
+			NumberOfInstances: ptr.To(int32(2)),
+			Mode:              "transaction",
+			MaxDBConnections:  ptr.To(int32(60)),
+			Resources: &acid_zalan_do_v1.Resources{
+				ResourceRequests: acid_zalan_do_v1.ResourceDescription{CPU: ptr.To("50m"), Memory: ptr.To("50Mi")},
+			},
+		}))
+	})
+
+	It("should use the settings asked for, and pool connections to the replicas when reading from them", func() {
+		p := newPostgres(withResources("2Gi", "100m", "1Gi"), withHighAvailability(), withAnnotations(map[string]string{
+			ConnectionPoolerAnnotation: `{"mode": "session", "maxDBConnections": 100, "instances": 3, "cpu": "500m", "memory": "200Mi"}`,
+			ReadReplicasAnnotation:     "true",
+		}))
+		cluster, err := CreateClusterSpec(p, &config.Config{}, Clone{}, "app", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.EnableReplicaConnectionPooler).To(Equal(ptr.To(true)))
+		Expect(cluster.Spec.ConnectionPooler).To(Equal(&acid_zalan_do_v1.ConnectionPooler{
+			NumberOfInstances: ptr.To(int32(3)),
+			Mode:              "session",
+			MaxDBConnections:  ptr.To(int32(100)),
+			Resources: &acid_zalan_do_v1.Resources{
+				ResourceRequests: acid_zalan_do_v1.ResourceDescription{CPU: ptr.To("500m"), Memory: ptr.To("200Mi")},
+				ResourceLimits:   acid_zalan_do_v1.ResourceDescription{CPU: ptr.To("2"), Memory: ptr.To("200Mi")},
+			},
+		}))
+	})
+
+	It("should not let the limits fall below those Zalando gives the pooler by default", func() {
+		pooler, err := GetConnectionPooler(newPostgres(withAnnotations(map[string]string{ConnectionPoolerAnnotation: `{"cpu": "100m"}`})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pooler.CpuLimit.String()).To(Equal("1"))
+		Expect(pooler.MemoryLimit).To(BeNil())
+	})
+
+	It("should keep the defaults of settings left out", func() {
+		pooler, err := GetConnectionPooler(newPostgres(withResources("2Gi", "100m", "1Gi"), withAnnotations(map[string]string{ConnectionPoolerAnnotation: `{"instances": 1}`})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pooler.Instances).To(Equal(int32(1)))
+		Expect(pooler.Mode).To(Equal(PoolerModeTransaction))
+		Expect(pooler.MaxDBConnections).To(Equal(int32(60)))
+	})
+
+	DescribeTable("should reject invalid settings",
+		func(annotations map[string]string) {
+			_, err := GetConnectionPooler(newPostgres(withResources("2Gi", "100m", "1Gi"), withAnnotations(annotations)))
+			Expect(err).To(MatchError(reconciler.ErrInvalid))
+		},
+		Entry("not JSON", map[string]string{ConnectionPoolerAnnotation: "session"}),
+		Entry("statement mode", map[string]string{ConnectionPoolerAnnotation: `{"mode": "statement"}`}),
+		Entry("no instances", map[string]string{ConnectionPoolerAnnotation: `{"instances": 0}`}),
+		Entry("too many instances", map[string]string{ConnectionPoolerAnnotation: `{"instances": 11}`}),
+		Entry("fewer connections than instances", map[string]string{ConnectionPoolerAnnotation: `{"maxDBConnections": 1}`}),
+		Entry("invalid cpu", map[string]string{ConnectionPoolerAnnotation: `{"cpu": "lots"}`}),
+		Entry("no memory", map[string]string{ConnectionPoolerAnnotation: `{"memory": "0"}`}),
+		Entry("read replicas neither true nor false", map[string]string{ReadReplicasAnnotation: "maybe"}),
+		Entry("read replicas without high availability", map[string]string{ReadReplicasAnnotation: "true"}),
+	)
+})
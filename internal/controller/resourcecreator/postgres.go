@@ -5,6 +5,7 @@ import (
 	"time"
 
 	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/liberator/pkg/namegen"
 	"github.com/nais/pgrator/internal/config"
 	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
 	v1 "k8s.io/api/core/v1"
@@ -27,23 +28,48 @@ const (
 
 	defaultDatabaseName = "app"
 
+	defaultCollation = "en_US"
+
 	sharedPreloadLibraries = "bg_mon,pg_stat_statements,pgextwlist,pg_auth_mon,set_user,timescaledb,pg_cron,pg_stat_kcache,pgaudit"
 
 	runAsUser  = int64(101)
 	runAsGroup = int64(103)
 	fsGroup    = int64(103)
+
+	// Max length is 63, but we need to save space for suffixes added by Zalando operator or StatefulSets
+	maxClusterNameLength = 50
 )
 
 var defaultExtensions = []string{
 	"pgaudit",
 }
 
+// ClusterName returns the name of the Zalando cluster for the Postgres resource with the given name
+func ClusterName(postgresName string) (string, error) {
+	if len(postgresName) <= maxClusterNameLength {
+		return postgresName, nil
+	}
+	pgClusterName, err := namegen.ShortName(postgresName, maxClusterNameLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to shorten PostgreSQL cluster name: %w", err)
+	}
+	return pgClusterName, nil
+}
+
+// ClusterNamespace returns the namespace holding the Zalando clusters for Postgres resources in the given namespace
+func ClusterNamespace(postgresNamespace string) string {
+	return fmt.Sprintf("pg-%s", postgresNamespace)
+}
+
 func MinimalCluster(postgres *data_nais_io_v1.Postgres, pgClusterName string, pgNamespace string) *acid_zalan_do_v1.Postgresql {
 	objectMeta := CreateObjectMeta(postgres)
 	objectMeta.Name = pgClusterName
 	objectMeta.Namespace = pgNamespace
 	objectMeta.Labels["apiserver-access"] = "enabled"
 
+	// Always set, so that revoking deletion also takes on clusters last updated before we recorded what we set on them,
+	// whose annotations are all kept. Zalando only deletes when the value matches the cluster name.
+	objectMeta.Annotations[allowDeletionAnnotation] = ""
 	if postgres.Spec.Cluster.AllowDeletion {
 		objectMeta.Annotations[allowDeletionAnnotation] = pgClusterName
 	}
@@ -57,17 +83,43 @@ func MinimalCluster(postgres *data_nais_io_v1.Postgres, pgClusterName string, pg
 	}
 }
 
-func CreateClusterSpec(postgres *data_nais_io_v1.Postgres, cfg *config.Config, pgClusterName string, pgNamespace string) *acid_zalan_do_v1.Postgresql {
+// CreateClusterSpec creates the Zalando cluster for postgres. If clone is requested, the cluster is bootstrapped from its source.
+func CreateClusterSpec(postgres *data_nais_io_v1.Postgres, cfg *config.Config, clone Clone, pgClusterName string, pgNamespace string) (*acid_zalan_do_v1.Postgresql, error) {
 	cluster := MinimalCluster(postgres, pgClusterName, pgNamespace)
 
-	cpuLimit := postgres.Spec.Cluster.Resources.Cpu.DeepCopy()
-	cpuLimit.Mul(cpuLimitFactor)
+	logicalBackup, err := GetLogicalBackup(postgres, cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	numberOfInstances := defaultNumInstances
-	if postgres.Spec.Cluster.HighAvailability {
-		numberOfInstances = haNumInstances
+	// Extensions that are not available are left out of each database, and reported in a condition
+	databases, err := GetDatabases(postgres, cfg)
+	if err != nil {
+		return nil, err
+	}
+	preparedDatabases := map[string]acid_zalan_do_v1.PreparedDatabase{}
+	for _, database := range databases {
+		preparedDatabases[database.Name] = database.preparedDatabase(postgres.GetNamespace())
+	}
+
+	users, err := GetUsers(postgres, databases)
+	if err != nil {
+		return nil, err
+	}
+
+	rotation, err := GetPasswordRotationPolicy(postgres, databases, users, cfg)
+	if err != nil {
+		return nil, err
 	}
 
+	pooler, err := GetConnectionPooler(postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	cpuLimit := makeCpuLimit(postgres)
+	numberOfInstances := makeNumberOfInstances(postgres)
+
 	var maintenanceWindows []acid_zalan_do_v1.MaintenanceWindow
 	if postgres.Spec.MaintenanceWindow != nil && postgres.Spec.MaintenanceWindow.Day != 0 && postgres.Spec.MaintenanceWindow.Hour != nil {
 		startTime := time.Hour * time.Duration(*postgres.Spec.MaintenanceWindow.Hour)
@@ -83,32 +135,20 @@ func CreateClusterSpec(postgres *data_nais_io_v1.Postgres, cfg *config.Config, p
 		})
 	}
 
-	extensions := map[string]string{}
-	if postgres.Spec.Database != nil && postgres.Spec.Database.Extensions != nil {
-		for _, extension := range postgres.Spec.Database.Extensions {
-			extensions[extension.Name] = defaultSchema
-		}
-	}
-	for _, extension := range defaultExtensions {
-		extensions[extension] = defaultSchema
+	var env []v1.EnvVar
+	if !cfg.WalArchivingDisabled {
+		env = walArchivingEnv(cfg, pgClusterName, pgNamespace)
 	}
 
-	collation := "en_US.UTF-8"
-	if postgres.Spec.Database != nil && postgres.Spec.Database.Collation != "" {
-		collation = fmt.Sprintf("%s.UTF-8", postgres.Spec.Database.Collation)
+	var cloneDescription *acid_zalan_do_v1.CloneDescription
+	if clone.Requested() {
+		cloneDescription = clone.cloneDescription()
+		env = append(env, clone.cloneEnv(cfg)...)
 	}
 
+	collation := fmt.Sprintf("%s.UTF-8", makeCollation(postgres))
+
 	cluster.Spec = acid_zalan_do_v1.PostgresSpec{
-		EnableConnectionPooler:        ptr.To(true),
-		EnableReplicaConnectionPooler: ptr.To(false),
-		ConnectionPooler: &acid_zalan_do_v1.ConnectionPooler{
-			Resources: &acid_zalan_do_v1.Resources{
-				ResourceRequests: acid_zalan_do_v1.ResourceDescription{
-					CPU:    ptr.To("50m"),
-					Memory: ptr.To("50Mi"),
-				},
-			},
-		},
 		NodeAffinity: &v1.NodeAffinity{
 			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
 				NodeSelectorTerms: []v1.NodeSelectorTerm{
@@ -154,25 +194,42 @@ func CreateClusterSpec(postgres *data_nais_io_v1.Postgres, cfg *config.Config, p
 		DockerImage:        cfg.PostgresImage,
 		NumberOfInstances:  numberOfInstances,
 		MaintenanceWindows: maintenanceWindows,
-		PreparedDatabases: map[string]acid_zalan_do_v1.PreparedDatabase{
-			defaultDatabaseName: {
-				DefaultUsers:    true,
-				Extensions:      extensions,
-				SecretNamespace: postgres.GetNamespace(),
-				PreparedSchemas: map[string]acid_zalan_do_v1.PreparedSchema{
-					defaultSchema: {
-						DefaultRoles: ptr.To(false),
-						DefaultUsers: false,
-					},
-				},
-			},
-		},
-		SpiloRunAsUser:  ptr.To(runAsUser),
-		SpiloRunAsGroup: ptr.To(runAsGroup),
-		SpiloFSGroup:    ptr.To(fsGroup),
+		PreparedDatabases:  preparedDatabases,
+		SpiloRunAsUser:     ptr.To(runAsUser),
+		SpiloRunAsGroup:    ptr.To(runAsGroup),
+		SpiloFSGroup:       ptr.To(fsGroup),
+		Env:                env,
+		Clone:              cloneDescription,
+
+		EnableLogicalBackup:    logicalBackup.Enabled(),
+		LogicalBackupSchedule:  logicalBackup.Schedule,
+		LogicalBackupRetention: logicalBackup.Retention,
+	}
+	pooler.apply(cluster)
+	applyUsers(cluster, users)
+	rotation.apply(cluster)
+
+	return cluster, nil
+}
+
+func makeCpuLimit(postgres *data_nais_io_v1.Postgres) resource.Quantity {
+	cpuLimit := postgres.Spec.Cluster.Resources.Cpu.DeepCopy()
+	cpuLimit.Mul(cpuLimitFactor)
+	return cpuLimit
+}
+
+func makeNumberOfInstances(postgres *data_nais_io_v1.Postgres) int32 {
+	if postgres.Spec.Cluster.HighAvailability {
+		return haNumInstances
 	}
+	return defaultNumInstances
+}
 
-	return cluster
+func makeCollation(postgres *data_nais_io_v1.Postgres) string {
+	if postgres.Spec.Database != nil && postgres.Spec.Database.Collation != "" {
+		return postgres.Spec.Database.Collation
+	}
+	return defaultCollation
 }
 
 func enforceMinimum2GiDisk(diskSize resource.Quantity) *resource.Quantity {
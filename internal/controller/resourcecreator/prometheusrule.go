@@ -5,12 +5,19 @@ import (
 	"strings"
 
 	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
 	monitoring_v1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/utils/ptr"
 )
 
+const (
+	// diskUsageHighLimit and diskUsageHighFor are shared by the PostgresDiskUsageHigh alert and automatic disk growth
+	diskUsageHighLimit = "> 0.9"
+	diskUsageHighFor   = "5m"
+)
+
 func MinimalPrometheusRule(postgres *data_nais_io_v1.Postgres, pgClusterName string) *monitoring_v1.PrometheusRule {
 	objectMeta := CreateObjectMeta(postgres)
 	objectMeta.Name = fmt.Sprintf("pg-%s", pgClusterName)
@@ -24,7 +31,7 @@ func MinimalPrometheusRule(postgres *data_nais_io_v1.Postgres, pgClusterName str
 	}
 }
 
-func CreatePrometheusRuleSpec(postgres *data_nais_io_v1.Postgres, pgClusterName string, pgNamespace string) *monitoring_v1.PrometheusRule {
+func CreatePrometheusRuleSpec(postgres *data_nais_io_v1.Postgres, cfg *config.Config, pgClusterName string, pgNamespace string) *monitoring_v1.PrometheusRule {
 	prometheusRule := MinimalPrometheusRule(postgres, pgClusterName)
 
 	prometheusRule.Spec = monitoring_v1.PrometheusRuleSpec{
@@ -85,14 +92,8 @@ func CreatePrometheusRuleSpec(postgres *data_nais_io_v1.Postgres, pgClusterName
 					{
 						Alert: "PostgresDiskIsFull",
 						Expr: intstr.FromString(makeQuery(
-							makeSingleQuery("kubelet_volume_stats_used_bytes", "persistentvolumeclaim", []string{
-								fmt.Sprintf("namespace=\"%s\"", pgNamespace),
-								fmt.Sprintf("persistentvolumeclaim=~\"pgdata-%s-[0-9]\"", pgClusterName),
-							}, false),
-							makeSingleQuery("kubelet_volume_stats_capacity_bytes", "persistentvolumeclaim", []string{
-								fmt.Sprintf("namespace=\"%s\"", pgNamespace),
-								fmt.Sprintf("persistentvolumeclaim=~\"pgdata-%s-[0-9]\"", pgClusterName),
-							}, false),
+							diskUsedQuery(pgClusterName, pgNamespace),
+							diskCapacityQuery(pgClusterName, pgNamespace),
 							"> 0.99")),
 						For: ptr.To(monitoring_v1.Duration("5m")),
 						Labels: map[string]string{
@@ -107,16 +108,10 @@ func CreatePrometheusRuleSpec(postgres *data_nais_io_v1.Postgres, pgClusterName
 					{
 						Alert: "PostgresDiskUsageHigh",
 						Expr: intstr.FromString(makeQuery(
-							makeSingleQuery("kubelet_volume_stats_used_bytes", "persistentvolumeclaim", []string{
-								fmt.Sprintf("namespace=\"%s\"", pgNamespace),
-								fmt.Sprintf("persistentvolumeclaim=~\"pgdata-%s-[0-9]\"", pgClusterName),
-							}, false),
-							makeSingleQuery("kubelet_volume_stats_capacity_bytes", "persistentvolumeclaim", []string{
-								fmt.Sprintf("namespace=\"%s\"", pgNamespace),
-								fmt.Sprintf("persistentvolumeclaim=~\"pgdata-%s-[0-9]\"", pgClusterName),
-							}, false),
-							"> 0.9")),
-						For: ptr.To(monitoring_v1.Duration("5m")),
+							diskUsedQuery(pgClusterName, pgNamespace),
+							diskCapacityQuery(pgClusterName, pgNamespace),
+							diskUsageHighLimit)),
+						For: ptr.To(monitoring_v1.Duration(diskUsageHighFor)),
 						Labels: map[string]string{
 							"severity": "warning",
 						},
@@ -156,9 +151,50 @@ func CreatePrometheusRuleSpec(postgres *data_nais_io_v1.Postgres, pgClusterName
 			},
 		},
 	}
+	if !cfg.WalArchivingDisabled {
+		rules := &prometheusRule.Spec.Groups[0].Rules
+		*rules = append(*rules, monitoring_v1.Rule{
+			Alert: "PostgresWalArchivingLagging",
+			// Spilo forces a WAL switch at least every 30 minutes, so an idle cluster also archives regularly
+			Expr: intstr.FromString(fmt.Sprintf("max(pg_stat_archiver_last_archive_age{namespace=\"%s\", pod=~\"%s-[0-9]\"}) > 3600", pgNamespace, pgClusterName)),
+			For:  ptr.To(monitoring_v1.Duration("15m")),
+			Labels: map[string]string{
+				"severity": "critical",
+			},
+			Annotations: map[string]string{
+				"summary":     "PostgreSQL WAL archiving is lagging",
+				"description": fmt.Sprintf("PostgreSQL instance %s has not archived WAL for over an hour, point-in-time recovery is at risk.", pgClusterName),
+				"action":      "Check the postgres logs for archive_command failures",
+			},
+		})
+	}
+
 	return prometheusRule
 }
 
+// DiskUsageHighQuery returns series for the volumes of the cluster when the PostgresDiskUsageHigh alert would fire
+func DiskUsageHighQuery(pgClusterName string, pgNamespace string) string {
+	return fmt.Sprintf("min_over_time((%s / %s)[%s:]) %s",
+		diskUsedQuery(pgClusterName, pgNamespace),
+		diskCapacityQuery(pgClusterName, pgNamespace),
+		diskUsageHighFor,
+		diskUsageHighLimit)
+}
+
+func diskUsedQuery(pgClusterName string, pgNamespace string) string {
+	return makeSingleQuery("kubelet_volume_stats_used_bytes", "persistentvolumeclaim", []string{
+		fmt.Sprintf("namespace=\"%s\"", pgNamespace),
+		fmt.Sprintf("persistentvolumeclaim=~\"pgdata-%s-[0-9]\"", pgClusterName),
+	}, false)
+}
+
+func diskCapacityQuery(pgClusterName string, pgNamespace string) string {
+	return makeSingleQuery("kubelet_volume_stats_capacity_bytes", "persistentvolumeclaim", []string{
+		fmt.Sprintf("namespace=\"%s\"", pgNamespace),
+		fmt.Sprintf("persistentvolumeclaim=~\"pgdata-%s-[0-9]\"", pgClusterName),
+	}, false)
+}
+
 func makeQuery(numeratorQuery, denominatorQuery, limit string) string {
 	return fmt.Sprintf("(%s / %s) %s", numeratorQuery, denominatorQuery, limit)
 }
@@ -0,0 +1,54 @@
+package resourcecreator
+
+import (
+	"fmt"
+	"time"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+)
+
+const (
+	// RestoreFromAnnotation names a Postgres resource in the same namespace whose WAL archive the new cluster is restored from
+	RestoreFromAnnotation = "postgres.data.nais.io/restore-from"
+	// RestoreTimestampAnnotation is the point in time to restore to, in RFC 3339 format
+	RestoreTimestampAnnotation = "postgres.data.nais.io/restore-timestamp"
+)
+
+// GetRestore returns the point-in-time restore requested for postgres in its annotations, if any.
+// A restore is a clone from the same namespace, to an explicit point in time.
+func GetRestore(postgres *data_nais_io_v1.Postgres, cfg *config.Config) (Clone, error) {
+	source := postgres.GetAnnotations()[RestoreFromAnnotation]
+	if len(source) == 0 {
+		return Clone{}, nil
+	}
+
+	if cfg.WalArchivingDisabled {
+		return Clone{}, fmt.Errorf("%w: point-in-time restore requires WAL archiving, which is disabled", reconciler.ErrInvalid)
+	}
+	if source == postgres.GetName() {
+		return Clone{}, fmt.Errorf("%w: cannot restore %s from itself", reconciler.ErrInvalid, source)
+	}
+
+	value, ok := postgres.GetAnnotations()[RestoreTimestampAnnotation]
+	if !ok {
+		return Clone{}, fmt.Errorf("%w: %s is required when restoring from %s", reconciler.ErrInvalid, RestoreTimestampAnnotation, source)
+	}
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return Clone{}, fmt.Errorf("%w: restore timestamp %q is not in RFC 3339 format", reconciler.ErrInvalid, value)
+	}
+
+	sourceClusterName, err := ClusterName(source)
+	if err != nil {
+		return Clone{}, err
+	}
+
+	return Clone{
+		SourceNamespace:   postgres.GetNamespace(),
+		SourceName:        source,
+		SourceClusterName: sourceClusterName,
+		Timestamp:         timestamp,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package resourcecreator
+
+import (
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Point-in-time restore", func() {
+	cfg := &config.Config{
+		GoogleProjectID:       "nais-dev-1234",
+		WalRetentionDays:      7,
+		WalBaseBackupSchedule: "0 1 * * *",
+	}
+
+	It("should not restore unless requested", func() {
+		restore, err := GetRestore(newPostgres(withName("team", "app-restored")), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restore.Requested()).To(BeFalse())
+
+		cluster, err := CreateClusterSpec(newPostgres(withName("team", "app-restored")), cfg, restore, "app-restored", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.Clone).To(BeNil())
+	})
+
+	It("should clone from the WAL archive of the source up to the timestamp", func() {
+		postgres := newPostgres(withName("team", "app-restored"), withAnnotations(map[string]string{
+			RestoreFromAnnotation:      "app",
+			RestoreTimestampAnnotation: "2025-03-01T13:00:00+01:00",
+		}))
+		restore, err := GetRestore(postgres, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restore.SourceNamespace).To(Equal("team"))
+		cluster, err := CreateClusterSpec(postgres, cfg, restore, "app-restored", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.Clone).NotTo(BeNil())
+		Expect(cluster.Spec.Clone.ClusterName).To(Equal("app"))
+		Expect(cluster.Spec.Clone.EndTimestamp).To(Equal("2025-03-01T13:00:00+01:00"))
+		Expect(cluster.Spec.Env).To(ContainElements(
+			v1.EnvVar{Name: "CLONE_WAL_GS_BUCKET", Value: WalBucketName(cfg, "app", "pg-team")},
+			v1.EnvVar{Name: "CLONE_USE_WALG_RESTORE", Value: "true"},
+			v1.EnvVar{Name: "WAL_GS_BUCKET", Value: WalBucketName(cfg, "app-restored", "pg-team")},
+		))
+	})
+
+	It("should use an explicit offset for UTC timestamps", func() {
+		postgres := newPostgres(withName("team", "app-restored"), withAnnotations(map[string]string{
+			RestoreFromAnnotation:      "app",
+			RestoreTimestampAnnotation: "2025-03-01T12:00:00Z",
+		}))
+		restore, err := GetRestore(postgres, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		cluster, err := CreateClusterSpec(postgres, cfg, restore, "app-restored", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.Clone.EndTimestamp).To(Equal("2025-03-01T12:00:00+00:00"))
+	})
+
+	It("should use the shortened cluster name of the source", func() {
+		source := "a-very-long-postgres-name-that-will-be-shortened-by-pgrator"
+		postgres := newPostgres(withName("team", "app-restored"), withAnnotations(map[string]string{
+			RestoreFromAnnotation:      source,
+			RestoreTimestampAnnotation: "2025-03-01T12:00:00Z",
+		}))
+		restore, err := GetRestore(postgres, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restore.SourceName).To(Equal(source))
+		Expect(len(restore.SourceClusterName)).To(BeNumerically("<=", 50))
+	})
+
+	DescribeTable("should reject invalid restores",
+		func(annotations map[string]string, walArchivingDisabled bool) {
+			cfg := *cfg
+			cfg.WalArchivingDisabled = walArchivingDisabled
+			_, err := GetRestore(newPostgres(withName("team", "app-restored"), withAnnotations(annotations)), &cfg)
+			Expect(err).To(MatchError(reconciler.ErrInvalid))
+		},
+		Entry("missing timestamp", map[string]string{RestoreFromAnnotation: "app"}, false),
+		Entry("malformed timestamp", map[string]string{RestoreFromAnnotation: "app", RestoreTimestampAnnotation: "yesterday"}, false),
+		Entry("restoring from itself", map[string]string{RestoreFromAnnotation: "app-restored", RestoreTimestampAnnotation: "2025-03-01T12:00:00Z"}, false),
+		Entry("WAL archiving disabled", map[string]string{RestoreFromAnnotation: "app", RestoreTimestampAnnotation: "2025-03-01T12:00:00Z"}, true),
+	)
+})
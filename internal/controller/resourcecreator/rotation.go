@@ -0,0 +1,307 @@
+package resourcecreator
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// PasswordRotationIntervalAnnotation rotates the passwords of all users with secrets in the application namespace
+	// every given number of days, e.g. "30". It cannot be longer than the interval Zalando is configured with.
+	PasswordRotationIntervalAnnotation = "postgres.data.nais.io/password-rotation-interval"
+
+	// RotatePasswordsAnnotation rotates the passwords last rotated before the given time, in RFC 3339 format, e.g.
+	// "2026-10-17T12:00:00Z". Setting it to the current time rotates all passwords right away. It also enables
+	// rotation for all users, every interval Zalando is configured with unless PasswordRotationIntervalAnnotation is set.
+	RotatePasswordsAnnotation = "postgres.data.nais.io/rotate-passwords"
+
+	// passwordRotationRequestedAnnotation is set on the cluster to when the last rotated passwords were due, as
+	// Zalando only rotates passwords when syncing, which it does right away when the annotations of the cluster change
+	passwordRotationRequestedAnnotation = "postgres.data.nais.io/password-rotation-requested"
+
+	// nextRotationKey is where Zalando keeps when to rotate the password next, in the secret of the user
+	nextRotationKey = "nextRotation"
+)
+
+// defaultUserSuffixes are the suffixes of the users Zalando creates for default roles with default users
+var defaultUserSuffixes = []string{"_owner_user", "_writer_user", "_reader_user"}
+
+// RotatedUser is a user with its password rotated by Zalando
+type RotatedUser struct {
+	RoleName string
+	// InPlace replaces the password of the user, instead of creating a new user in the same role which keeps the
+	// previous password working until Zalando removes it after its retention. Owners are rotated in place, as the
+	// objects they create must keep the same owner.
+	InPlace bool
+}
+
+// PasswordRotationPolicy describes which users have their passwords rotated, and how often
+type PasswordRotationPolicy struct {
+	Users []RotatedUser
+	// Interval is the time between rotations
+	Interval time.Duration
+	// RequestedAt rotates the passwords last rotated before it, zero when no rotation is requested
+	RequestedAt time.Time
+}
+
+// Enabled returns true if any users have their passwords rotated
+func (p PasswordRotationPolicy) Enabled() bool {
+	return len(p.Users) > 0
+}
+
+// GetPasswordRotationPolicy returns the users of the databases, and the additional users, that have their passwords
+// rotated. Rotation is enabled for all of them by the annotations, or for single additional users.
+func GetPasswordRotationPolicy(postgres *data_nais_io_v1.Postgres, databases []Database, users []User, cfg *config.Config) (PasswordRotationPolicy, error) {
+	interval, err := PasswordRotationInterval(postgres, cfg)
+	if err != nil {
+		return PasswordRotationPolicy{}, err
+	}
+	requestedAt, err := PasswordRotationRequestedAt(postgres)
+	if err != nil {
+		return PasswordRotationPolicy{}, err
+	}
+	policy := PasswordRotationPolicy{
+		Interval:    interval,
+		RequestedAt: requestedAt,
+	}
+
+	_, intervalSet := postgres.GetAnnotations()[PasswordRotationIntervalAnnotation]
+	_, requested := postgres.GetAnnotations()[RotatePasswordsAnnotation]
+	all := intervalSet || requested
+	if all {
+		for _, database := range databases {
+			if database.DefaultUsers {
+				policy.Users = append(policy.Users, defaultRotatedUsers(database.Name)...)
+			}
+			for _, schema := range database.Schemas {
+				if schema.DefaultRoles && schema.DefaultUsers {
+					policy.Users = append(policy.Users, defaultRotatedUsers(database.Name+"_"+schema.Name)...)
+				}
+			}
+		}
+	}
+	for _, user := range users {
+		if all || user.PasswordRotation {
+			policy.Users = append(policy.Users, RotatedUser{RoleName: user.RoleName, InPlace: user.Privileges == PrivilegeOwner})
+		}
+	}
+	return policy, nil
+}
+
+// PasswordRotationInterval returns the interval set in the annotations of postgres, or the one Zalando is configured with
+func PasswordRotationInterval(postgres *data_nais_io_v1.Postgres, cfg *config.Config) (time.Duration, error) {
+	value, ok := postgres.GetAnnotations()[PasswordRotationIntervalAnnotation]
+	if !ok {
+		return days(cfg.PasswordRotationIntervalDays), nil
+	}
+	interval, err := strconv.Atoi(value)
+	if err != nil || interval < 1 || interval > cfg.PasswordRotationIntervalDays {
+		return 0, fmt.Errorf("%w: %s must be a number of days from 1 to %d, not %q", reconciler.ErrInvalid, PasswordRotationIntervalAnnotation, cfg.PasswordRotationIntervalDays, value)
+	}
+	return days(interval), nil
+}
+
+// PasswordRotationRequestedAt returns the time set in the annotations of postgres, zero if none
+func PasswordRotationRequestedAt(postgres *data_nais_io_v1.Postgres) (time.Time, error) {
+	value, ok := postgres.GetAnnotations()[RotatePasswordsAnnotation]
+	if !ok {
+		return time.Time{}, nil
+	}
+	requestedAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be a time in RFC 3339 format, e.g. 2006-01-02T15:04:05Z, not %q", reconciler.ErrInvalid, RotatePasswordsAnnotation, value)
+	}
+	return requestedAt, nil
+}
+
+func defaultRotatedUsers(prefix string) []RotatedUser {
+	users := make([]RotatedUser, 0, len(defaultUserSuffixes))
+	for i, suffix := range defaultUserSuffixes {
+		users = append(users, RotatedUser{RoleName: prefix + suffix, InPlace: i == 0})
+	}
+	return users
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// apply has Zalando rotate the passwords of the users
+func (p PasswordRotationPolicy) apply(cluster *acid_zalan_do_v1.Postgresql) {
+	for _, user := range p.Users {
+		if user.InPlace {
+			cluster.Spec.UsersWithInPlaceSecretRotation = append(cluster.Spec.UsersWithInPlaceSecretRotation, user.RoleName)
+		} else {
+			cluster.Spec.UsersWithSecretRotation = append(cluster.Spec.UsersWithSecretRotation, user.RoleName)
+		}
+	}
+}
+
+// MinimalPasswordRotationSecret is the secret Zalando keeps the credentials of the user in, in the application namespace
+func MinimalPasswordRotationSecret(postgres *data_nais_io_v1.Postgres, user RotatedUser, pgClusterName string) *v1.Secret {
+	return &v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credentialsSecretName(user.RoleName, pgClusterName),
+			Namespace: postgres.GetNamespace(),
+		},
+	}
+}
+
+// UserPasswordRotation is the state of the rotation of the password of a user, as kept by Zalando in its secret
+type UserPasswordRotation struct {
+	RotatedUser
+	// Secret is the secret holding the credentials, nil until Zalando creates it
+	Secret *v1.Secret
+	// LastRotated is when the password in the secret was set, zero while a rotation is pending
+	LastRotated time.Time
+	// Due is when the password is to be rotated next
+	Due time.Time
+	// Pending is set when the password is due, and Zalando is yet to rotate it
+	Pending bool
+}
+
+// PasswordRotation describes the rotation of the passwords of the users at a point in time
+type PasswordRotation struct {
+	Policy PasswordRotationPolicy
+	Users  []UserPasswordRotation
+	Now    time.Time
+}
+
+// GetPasswordRotation finds when the passwords of the users were last rotated, and when they are due, from the secrets
+// of the users by role name. Zalando writes the time of the next rotation to the secret when rotating the password,
+// one interval of its configuration later, and rotates the password once that time has passed.
+func GetPasswordRotation(policy PasswordRotationPolicy, secrets map[string]*v1.Secret, cfg *config.Config, now time.Time) PasswordRotation {
+	rotation := PasswordRotation{
+		Policy: policy,
+		Now:    now,
+	}
+
+	for _, user := range policy.Users {
+		state := UserPasswordRotation{
+			RotatedUser: user,
+			Secret:      secrets[user.RoleName],
+		}
+		if state.Secret == nil {
+			rotation.Users = append(rotation.Users, state)
+			continue
+		}
+
+		next, err := time.Parse(time.RFC3339, string(state.Secret.Data[nextRotationKey]))
+		switch {
+		case err != nil:
+			// Zalando is yet to start rotating, the password is the one the secret was created with
+			state.LastRotated = state.Secret.GetCreationTimestamp().Time
+		case !next.After(now):
+			state.Pending = true
+			state.Due = next
+			rotation.Users = append(rotation.Users, state)
+			continue
+		default:
+			state.LastRotated = next.Add(-days(cfg.PasswordRotationIntervalDays))
+		}
+
+		state.Due = state.LastRotated.Add(policy.Interval)
+		if policy.RequestedAt.After(state.LastRotated) && policy.RequestedAt.Before(state.Due) {
+			state.Due = policy.RequestedAt
+		}
+		// The users Zalando creates at each rotation are named for the day, so a second rotation on the same day would
+		// replace the password of the user created at the first one, leaving no previous password working
+		if !user.InPlace && string(state.Secret.Data["username"]) != user.RoleName {
+			nextDay := state.LastRotated.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			if state.Due.Before(nextDay) {
+				state.Due = nextDay
+			}
+		}
+		rotation.Users = append(rotation.Users, state)
+	}
+	return rotation
+}
+
+// Due returns the users with their passwords due for rotation, which Zalando has not been asked to rotate yet
+func (r PasswordRotation) Due() []UserPasswordRotation {
+	var due []UserPasswordRotation
+	for _, user := range r.Users {
+		if user.Secret != nil && !user.Pending && !user.Due.After(r.Now) {
+			due = append(due, user)
+		}
+	}
+	return due
+}
+
+// Pending returns the users with their passwords due for rotation, which Zalando is yet to rotate
+func (r PasswordRotation) Pending() []UserPasswordRotation {
+	var pending []UserPasswordRotation
+	for _, user := range r.Users {
+		if user.Pending {
+			pending = append(pending, user)
+		}
+	}
+	return pending
+}
+
+// NextDue returns when the next password is due for rotation, zero if none are
+func (r PasswordRotation) NextDue() time.Time {
+	var next time.Time
+	for _, user := range r.Users {
+		if user.Secret != nil && !user.Pending && (next.IsZero() || user.Due.Before(next)) {
+			next = user.Due
+		}
+	}
+	return next
+}
+
+// CreateRotationSecretPatch sets the time of the next rotation in the secret of the user to when it was due, which
+// is in the past, for Zalando to rotate the password the next time it syncs
+func CreateRotationSecretPatch(postgres *data_nais_io_v1.Postgres, user UserPasswordRotation, pgClusterName string) *v1.Secret {
+	secret := MinimalPasswordRotationSecret(postgres, user.RotatedUser, pgClusterName)
+	secret.Data = map[string][]byte{
+		nextRotationKey: []byte(user.Due.UTC().Format(time.RFC3339)),
+	}
+	return secret
+}
+
+// Apply annotates the cluster with when the latest of the passwords to be rotated were due, for Zalando to sync the
+// secrets right away
+func (r PasswordRotation) Apply(cluster *acid_zalan_do_v1.Postgresql) {
+	var requested time.Time
+	for _, user := range append(r.Due(), r.Pending()...) {
+		if user.Due.After(requested) {
+			requested = user.Due
+		}
+	}
+	if requested.IsZero() {
+		return
+	}
+
+	annotations := cluster.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[passwordRotationRequestedAnnotation] = requested.UTC().Format(time.RFC3339)
+	cluster.SetAnnotations(annotations)
+}
+
+// InProgress returns true while passwords are being rotated, or Zalando is yet to create the secrets of the users
+func (r PasswordRotation) InProgress() bool {
+	if len(r.Due()) > 0 || len(r.Pending()) > 0 {
+		return true
+	}
+	for _, user := range r.Users {
+		if user.Secret == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package resourcecreator
+
+import (
+	"time"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Password rotation", func() {
+	cfg := &config.Config{
+		PasswordRotationIntervalDays: 90,
+	}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	getPolicy := func(p *data_nais_io_v1.Postgres) (PasswordRotationPolicy, error) {
+		databases, err := GetDatabases(p, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		users, err := GetUsers(p, databases)
+		Expect(err).NotTo(HaveOccurred())
+		return GetPasswordRotationPolicy(p, databases, users, cfg)
+	}
+
+	// secret is the secret of a user as Zalando leaves it after rotating its password at rotatedAt
+	secret := func(username string, rotatedAt time.Time) *v1.Secret {
+		return &v1.Secret{
+			Data: map[string][]byte{
+				"username":      []byte(username),
+				nextRotationKey: []byte(rotatedAt.Add(90 * 24 * time.Hour).Format(time.RFC3339)),
+			},
+		}
+	}
+
+	It("should only rotate passwords when enabled", func() {
+		policy, err := getPolicy(newPostgres(withAnnotations(map[string]string{
+			UsersAnnotation: `[{"name": "migrate", "privileges": "owner", "passwordRotation": true}, {"name": "reporting", "privileges": "read-only"}]`,
+		})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.Users).To(Equal([]RotatedUser{{RoleName: "team.migrate", InPlace: true}}))
+		Expect(policy.Interval).To(Equal(90 * 24 * time.Hour))
+	})
+
+	It("should rotate all users with secrets in the application namespace, owners in place", func() {
+		p := newPostgres(withAnnotations(map[string]string{
+			PasswordRotationIntervalAnnotation: "30",
+			DatabasesAnnotation:                `[{"name": "reporting", "defaultUsers": false, "schemas": [{"name": "sales", "defaultRoles": true, "defaultUsers": true}]}]`,
+			UsersAnnotation:                    `[{"name": "reporting", "privileges": "read-only"}]`,
+		}))
+		policy, err := getPolicy(p)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.Interval).To(Equal(30 * 24 * time.Hour))
+		Expect(policy.Users).To(Equal([]RotatedUser{
+			{RoleName: "app_owner_user", InPlace: true},
+			{RoleName: "app_writer_user"},
+			{RoleName: "app_reader_user"},
+			{RoleName: "reporting_sales_owner_user", InPlace: true},
+			{RoleName: "reporting_sales_writer_user"},
+			{RoleName: "reporting_sales_reader_user"},
+			{RoleName: "team.reporting"},
+		}))
+
+		cluster, err := CreateClusterSpec(p, cfg, Clone{}, "app", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.UsersWithInPlaceSecretRotation).To(Equal([]string{"app_owner_user", "reporting_sales_owner_user"}))
+		Expect(cluster.Spec.UsersWithSecretRotation).To(Equal([]string{"app_writer_user", "app_reader_user", "reporting_sales_writer_user", "reporting_sales_reader_user", "team.reporting"}))
+	})
+
+	DescribeTable("should reject invalid annotations",
+		func(annotations map[string]string) {
+			_, err := getPolicy(newPostgres(withAnnotations(annotations)))
+			Expect(err).To(MatchError(reconciler.ErrInvalid))
+		},
+		Entry("interval not a number", map[string]string{PasswordRotationIntervalAnnotation: "30d"}),
+		Entry("interval longer than Zalando's", map[string]string{PasswordRotationIntervalAnnotation: "91"}),
+		Entry("requested at an invalid time", map[string]string{RotatePasswordsAnnotation: "2026-10-17"}),
+	)
+
+	It("should have passwords rotated when due", func() {
+		policy, err := getPolicy(newPostgres(withAnnotations(map[string]string{PasswordRotationIntervalAnnotation: "30"})))
+		Expect(err).NotTo(HaveOccurred())
+
+		rotation := GetPasswordRotation(policy, map[string]*v1.Secret{
+			"app_owner_user":  secret("app_owner_user", now.Add(-31*24*time.Hour)),
+			"app_writer_user": secret("app_writer_user261010", now.Add(-7*24*time.Hour)),
+		}, cfg, now)
+
+		Expect(rotation.Due()).To(HaveLen(1))
+		due := rotation.Due()[0]
+		Expect(due.RoleName).To(Equal("app_owner_user"))
+		Expect(due.LastRotated).To(Equal(now.Add(-31 * 24 * time.Hour)))
+		Expect(string(CreateRotationSecretPatch(newPostgres(), due, "app").Data[nextRotationKey])).To(Equal("2026-10-16T12:00:00Z"))
+		Expect(rotation.Users[1].Due).To(Equal(now.Add(23 * 24 * time.Hour)))
+
+		By("Waiting for the secret of the reader to be created")
+		Expect(rotation.InProgress()).To(BeTrue())
+
+		By("Annotating the cluster for Zalando to sync the secrets")
+		cluster := &acid_zalan_do_v1.Postgresql{}
+		rotation.Apply(cluster)
+		Expect(cluster.GetAnnotations()).To(HaveKeyWithValue(passwordRotationRequestedAnnotation, "2026-10-16T12:00:00Z"))
+	})
+
+	It("should follow rotations until Zalando is done", func() {
+		policy, err := getPolicy(newPostgres(withAnnotations(map[string]string{PasswordRotationIntervalAnnotation: "30"})))
+		Expect(err).NotTo(HaveOccurred())
+
+		pending := secret("app_owner_user", now)
+		pending.Data[nextRotationKey] = []byte("2026-10-16T12:00:00Z")
+		rotation := GetPasswordRotation(policy, map[string]*v1.Secret{"app_owner_user": pending}, cfg, now)
+		Expect(rotation.Due()).To(BeEmpty())
+		Expect(rotation.Pending()).To(HaveLen(1))
+		Expect(rotation.Pending()[0].LastRotated.IsZero()).To(BeTrue())
+	})
+
+	It("should rotate passwords last rotated before the requested time, once a day for users created at each rotation", func() {
+		requestedAt := now.Add(-time.Hour)
+		policy, err := getPolicy(newPostgres(withAnnotations(map[string]string{RotatePasswordsAnnotation: requestedAt.Format(time.RFC3339)})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.Interval).To(Equal(90 * 24 * time.Hour))
+
+		rotation := GetPasswordRotation(policy, map[string]*v1.Secret{
+			"app_owner_user":  secret("app_owner_user", now.Add(-2*time.Hour)),
+			"app_writer_user": secret("app_writer_user261017", now.Add(-2*time.Hour)),
+			"app_reader_user": secret("app_reader_user", now.Add(-30*time.Minute)),
+		}, cfg, now)
+
+		Expect(rotation.Due()).To(HaveLen(1))
+		Expect(rotation.Due()[0].RoleName).To(Equal("app_owner_user"))
+		Expect(rotation.Due()[0].Due).To(Equal(requestedAt))
+		Expect(rotation.Users[1].Due).To(Equal(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)))
+		Expect(rotation.Users[2].Due).To(Equal(now.Add(-30*time.Minute + 90*24*time.Hour)))
+	})
+})
@@ -1,10 +1,15 @@
 package resourcecreator
 
 import (
+	"maps"
 	"testing"
+	"time"
 
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
@@ -15,3 +20,84 @@ func TestResourceCreator(t *testing.T) {
 
 	RunSpecs(t, "Resource Creator Suite")
 }
+
+// postgresOption changes a Postgres resource built by newPostgres
+type postgresOption func(p *data_nais_io_v1.Postgres)
+
+// newPostgres builds the Postgres resource app in namespace team with major version 17, changed by the given options
+func newPostgres(options ...postgresOption) *data_nais_io_v1.Postgres {
+	p := &data_nais_io_v1.Postgres{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "team",
+		},
+	}
+	p.Spec.Cluster.MajorVersion = "17"
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+func withName(namespace, name string) postgresOption {
+	return func(p *data_nais_io_v1.Postgres) {
+		p.Namespace = namespace
+		p.Name = name
+	}
+}
+
+func withCreated(created time.Time) postgresOption {
+	return func(p *data_nais_io_v1.Postgres) {
+		p.CreationTimestamp = metav1.NewTime(created)
+	}
+}
+
+func withAnnotations(annotations map[string]string) postgresOption {
+	return func(p *data_nais_io_v1.Postgres) {
+		// Copied, since tests may change the annotations of the resource
+		p.Annotations = maps.Clone(annotations)
+	}
+}
+
+func withMajorVersion(majorVersion string) postgresOption {
+	return func(p *data_nais_io_v1.Postgres) {
+		p.Spec.Cluster.MajorVersion = majorVersion
+	}
+}
+
+// withExtensions asks for the extensions in the database, leaving the database unset when there are none
+func withExtensions(extensions ...string) postgresOption {
+	return func(p *data_nais_io_v1.Postgres) {
+		if len(extensions) == 0 {
+			return
+		}
+		if p.Spec.Database == nil {
+			p.Spec.Database = &data_nais_io_v1.PostgresDatabase{}
+		}
+		for _, extension := range extensions {
+			p.Spec.Database.Extensions = append(p.Spec.Database.Extensions, data_nais_io_v1.PostgresExtension{Name: extension})
+		}
+	}
+}
+
+func withDiskSize(diskSize string) postgresOption {
+	return func(p *data_nais_io_v1.Postgres) {
+		p.Spec.Cluster.Resources.DiskSize = resource.MustParse(diskSize)
+	}
+}
+
+func withHighAvailability() postgresOption {
+	return func(p *data_nais_io_v1.Postgres) {
+		p.Spec.Cluster.HighAvailability = true
+	}
+}
+
+func withResources(diskSize, cpu, memory string) postgresOption {
+	return func(p *data_nais_io_v1.Postgres) {
+		p.Spec.Cluster.Resources = data_nais_io_v1.PostgresResources{
+			DiskSize: resource.MustParse(diskSize),
+			Cpu:      resource.MustParse(cpu),
+			Memory:   resource.MustParse(memory),
+		}
+	}
+}
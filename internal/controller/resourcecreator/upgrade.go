@@ -0,0 +1,210 @@
+package resourcecreator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/liberator/pkg/namegen"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	batch_v1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// MajorUpgradeBackupAnnotation overrides whether a logical backup is taken before a major version upgrade, "true" or "false"
+	MajorUpgradeBackupAnnotation = "postgres.data.nais.io/major-upgrade-backup"
+
+	// majorUpgradeFromAnnotation and majorUpgradeStartedAnnotation are set on the cluster when the new version is handed
+	// over to Zalando, to follow the upgrade until Zalando reports its outcome
+	majorUpgradeFromAnnotation    = "postgres.data.nais.io/major-upgrade-from"
+	majorUpgradeStartedAnnotation = "postgres.data.nais.io/major-upgrade-started"
+
+	// MajorUpgradeSuccessAnnotation and MajorUpgradeFailureAnnotation are set by Zalando on the cluster when an upgrade is done.
+	// Zalando does not attempt the upgrade again until the failure annotation is removed.
+	MajorUpgradeSuccessAnnotation = "last-major-upgrade-success"
+	MajorUpgradeFailureAnnotation = "last-major-upgrade-failure"
+
+	maxJobNameLength = 63
+)
+
+// MajorVersionUpgrade describes an in-place upgrade of the cluster from one major version to another
+type MajorVersionUpgrade struct {
+	From string
+	To   string
+	// Started is when the new version was handed over to Zalando, zero until then
+	Started time.Time
+	// BackupRequested is set when a logical backup must succeed before the new version is handed over
+	BackupRequested bool
+	// Backup is the job taking the backup, with its current status if it exists
+	Backup *batch_v1.Job
+}
+
+func (u MajorVersionUpgrade) Requested() bool {
+	return len(u.From) > 0
+}
+
+// BackupSucceeded returns true when the backup taken before upgrading is complete
+func (u MajorVersionUpgrade) BackupSucceeded() bool {
+	return u.Backup != nil && jobHasCondition(u.Backup, batch_v1.JobComplete)
+}
+
+// BackupFailed returns true when the backup taken before upgrading has failed, which holds back the upgrade
+func (u MajorVersionUpgrade) BackupFailed() bool {
+	return u.Backup != nil && jobHasCondition(u.Backup, batch_v1.JobFailed)
+}
+
+// ready returns true when nothing holds back handing the new version over to Zalando
+func (u MajorVersionUpgrade) ready() bool {
+	return !u.Started.IsZero() || !u.BackupRequested || u.BackupSucceeded()
+}
+
+// GetMajorVersionUpgrade compares the requested major version with the one of the existing cluster, if any.
+// Downgrades and upgrades to a version lacking any of the requested extensions are rejected.
+func GetMajorVersionUpgrade(postgres *data_nais_io_v1.Postgres, existing *acid_zalan_do_v1.Postgresql, cfg *config.Config) (MajorVersionUpgrade, error) {
+	if existing == nil || len(existing.Spec.PgVersion) == 0 {
+		return MajorVersionUpgrade{}, nil
+	}
+
+	current, err := strconv.Atoi(existing.Spec.PgVersion)
+	if err != nil {
+		return MajorVersionUpgrade{}, fmt.Errorf("parsing major version %q of existing cluster: %w", existing.Spec.PgVersion, err)
+	}
+	desired, err := strconv.Atoi(postgres.Spec.Cluster.MajorVersion)
+	if err != nil {
+		return MajorVersionUpgrade{}, fmt.Errorf("%w: major version %q is not a number", reconciler.ErrInvalid, postgres.Spec.Cluster.MajorVersion)
+	}
+
+	switch {
+	case desired < current:
+		return MajorVersionUpgrade{}, fmt.Errorf("%w: cannot downgrade from major version %d to %d", reconciler.ErrInvalid, current, desired)
+	case desired == current:
+		// Keep following the last upgrade handed over to Zalando
+		from, ok := existing.GetAnnotations()[majorUpgradeFromAnnotation]
+		if !ok {
+			return MajorVersionUpgrade{}, nil
+		}
+		started, _ := time.Parse(time.RFC3339, existing.GetAnnotations()[majorUpgradeStartedAnnotation])
+		return MajorVersionUpgrade{From: from, To: existing.Spec.PgVersion, Started: started}, nil
+	}
+
+	if incompatible := incompatibleExtensions(postgres, cfg, desired); len(incompatible) > 0 {
+		return MajorVersionUpgrade{}, fmt.Errorf("%w: extensions %s are not available in major version %d", reconciler.ErrInvalid, strings.Join(incompatible, ", "), desired)
+	}
+
+	backup, err := majorUpgradeBackupRequested(postgres, cfg)
+	if err != nil {
+		return MajorVersionUpgrade{}, err
+	}
+
+	return MajorVersionUpgrade{
+		From:            existing.Spec.PgVersion,
+		To:              postgres.Spec.Cluster.MajorVersion,
+		BackupRequested: backup,
+	}, nil
+}
+
+func majorUpgradeBackupRequested(postgres *data_nais_io_v1.Postgres, cfg *config.Config) (bool, error) {
+	backup := cfg.MajorUpgradeBackup
+	if value, ok := postgres.GetAnnotations()[MajorUpgradeBackupAnnotation]; ok {
+		var err error
+		backup, err = strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("%w: %s must be true or false, not %q", reconciler.ErrInvalid, MajorUpgradeBackupAnnotation, value)
+		}
+	}
+	if !backup {
+		return false, nil
+	}
+
+	// The backup is taken using the logical backup job created by Zalando
+	logicalBackup, err := GetLogicalBackup(postgres, cfg)
+	if err != nil {
+		return false, err
+	}
+	if !logicalBackup.Enabled() {
+		return false, fmt.Errorf("%w: a backup before upgrading requires logical backups, which are disabled", reconciler.ErrInvalid)
+	}
+	return true, nil
+}
+
+// incompatibleExtensions returns the requested extensions in the catalog that are not available in the given major version.
+// Unknown extensions are rejected in every version, and do not hold back an upgrade.
+func incompatibleExtensions(postgres *data_nais_io_v1.Postgres, cfg *config.Config, majorVersion int) []string {
+	catalog := extensionCatalog(cfg)
+	incompatible := make([]string, 0)
+	for _, name := range requestedExtensions(postgres) {
+		if extension, ok := catalog[name]; ok && !extension.AvailableIn(majorVersion) {
+			incompatible = append(incompatible, name)
+		}
+	}
+	return incompatible
+}
+
+// Apply sets the major version of the cluster. The current version is kept while waiting for the backup to succeed.
+func (u MajorVersionUpgrade) Apply(cluster *acid_zalan_do_v1.Postgresql, now time.Time) {
+	if !u.Requested() {
+		return
+	}
+	if !u.ready() {
+		cluster.Spec.PgVersion = u.From
+		return
+	}
+
+	started := u.Started
+	if started.IsZero() {
+		started = now
+	}
+	cluster.Spec.PgVersion = u.To
+	metav1.SetMetaDataAnnotation(&cluster.ObjectMeta, majorUpgradeFromAnnotation, u.From)
+	metav1.SetMetaDataAnnotation(&cluster.ObjectMeta, majorUpgradeStartedAnnotation, started.UTC().Format(time.RFC3339))
+}
+
+func MinimalUpgradeBackupJob(postgres *data_nais_io_v1.Postgres, upgrade MajorVersionUpgrade, pgClusterName string, pgNamespace string) *batch_v1.Job {
+	name := fmt.Sprintf("%s-upgrade-%s", pgClusterName, upgrade.To)
+	if len(name) > maxJobNameLength {
+		var err error
+		name, err = namegen.ShortName(name, maxJobNameLength)
+		if err != nil {
+			panic(fmt.Sprintf("This should never happen: %v", err))
+		}
+	}
+
+	objectMeta := CreateObjectMeta(postgres)
+	objectMeta.Name = name
+	objectMeta.Namespace = pgNamespace
+
+	return &batch_v1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: objectMeta,
+	}
+}
+
+// CreateUpgradeBackupJobSpec runs the logical backup job of the cluster once, like a manually triggered CronJob
+func CreateUpgradeBackupJobSpec(postgres *data_nais_io_v1.Postgres, upgrade MajorVersionUpgrade, logicalBackupCronJob *batch_v1.CronJob, pgClusterName string, pgNamespace string) *batch_v1.Job {
+	job := MinimalUpgradeBackupJob(postgres, upgrade, pgClusterName, pgNamespace)
+	for k, v := range logicalBackupCronJob.Spec.JobTemplate.GetLabels() {
+		if _, ok := job.Labels[k]; !ok {
+			job.Labels[k] = v
+		}
+	}
+	job.Spec = *logicalBackupCronJob.Spec.JobTemplate.Spec.DeepCopy()
+	return job
+}
+
+func jobHasCondition(job *batch_v1.Job, conditionType batch_v1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package resourcecreator
+
+import (
+	"time"
+
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	batch_v1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Major version upgrade", func() {
+	cfg := &config.Config{
+		LogicalBackupSchedule: "30 0 * * *",
+		ExtensionCatalog: config.ExtensionCatalog{
+			"pgaudit": {},
+			"plv8":    {MaxMajorVersion: 16},
+			"postgis": {},
+		},
+	}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	existing := func(majorVersion string, annotations map[string]string) *acid_zalan_do_v1.Postgresql {
+		cluster := &acid_zalan_do_v1.Postgresql{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		cluster.Spec.PgVersion = majorVersion
+		return cluster
+	}
+
+	It("should not upgrade new or unchanged clusters", func() {
+		upgrade, err := GetMajorVersionUpgrade(newPostgres(), nil, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgrade.Requested()).To(BeFalse())
+
+		upgrade, err = GetMajorVersionUpgrade(newPostgres(), existing("17", nil), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgrade.Requested()).To(BeFalse())
+	})
+
+	It("should reject downgrades", func() {
+		_, err := GetMajorVersionUpgrade(newPostgres(withMajorVersion("16")), existing("17", nil), cfg)
+		Expect(err).To(MatchError(reconciler.ErrInvalid))
+		Expect(err).To(MatchError(ContainSubstring("cannot downgrade from major version 17 to 16")))
+	})
+
+	It("should reject upgrades when extensions are not available in the new version", func() {
+		_, err := GetMajorVersionUpgrade(newPostgres(withExtensions("plv8", "postgis")), existing("16", nil), cfg)
+		Expect(err).To(MatchError(reconciler.ErrInvalid))
+		Expect(err).To(MatchError(ContainSubstring("plv8")))
+
+		_, err = GetMajorVersionUpgrade(newPostgres(withExtensions("postgis")), existing("16", nil), cfg)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should hold back the new version until the backup has succeeded", func() {
+		backupConfig := *cfg
+		backupConfig.MajorUpgradeBackup = true
+		upgrade, err := GetMajorVersionUpgrade(newPostgres(), existing("16", nil), &backupConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgrade.BackupRequested).To(BeTrue())
+
+		cluster := existing("16", nil)
+		upgrade.Apply(cluster, now)
+		Expect(cluster.Spec.PgVersion).To(Equal("16"))
+
+		upgrade.Backup = &batch_v1.Job{Status: batch_v1.JobStatus{Conditions: []batch_v1.JobCondition{
+			{Type: batch_v1.JobComplete, Status: v1.ConditionTrue},
+		}}}
+		upgrade.Apply(cluster, now)
+		Expect(cluster.Spec.PgVersion).To(Equal("17"))
+		Expect(cluster.GetAnnotations()).To(HaveKeyWithValue("postgres.data.nais.io/major-upgrade-from", "16"))
+		Expect(cluster.GetAnnotations()).To(HaveKeyWithValue("postgres.data.nais.io/major-upgrade-started", "2025-03-01T12:00:00Z"))
+	})
+
+	It("should let the annotation override whether to back up", func() {
+		upgrade, err := GetMajorVersionUpgrade(newPostgres(withAnnotations(map[string]string{MajorUpgradeBackupAnnotation: "true"})), existing("16", nil), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgrade.BackupRequested).To(BeTrue())
+
+		_, err = GetMajorVersionUpgrade(newPostgres(withAnnotations(map[string]string{MajorUpgradeBackupAnnotation: "maybe"})), existing("16", nil), cfg)
+		Expect(err).To(MatchError(reconciler.ErrInvalid))
+
+		noLogicalBackup := *cfg
+		noLogicalBackup.LogicalBackupSchedule = ""
+		_, err = GetMajorVersionUpgrade(newPostgres(withAnnotations(map[string]string{MajorUpgradeBackupAnnotation: "true"})), existing("16", nil), &noLogicalBackup)
+		Expect(err).To(MatchError(reconciler.ErrInvalid))
+	})
+
+	It("should keep following an upgrade handed over to Zalando", func() {
+		annotations := map[string]string{
+			"postgres.data.nais.io/major-upgrade-from":    "16",
+			"postgres.data.nais.io/major-upgrade-started": "2025-03-01T12:00:00Z",
+		}
+		upgrade, err := GetMajorVersionUpgrade(newPostgres(), existing("17", annotations), cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgrade.From).To(Equal("16"))
+		Expect(upgrade.To).To(Equal("17"))
+		Expect(upgrade.Started).To(Equal(now))
+
+		cluster := existing("17", nil)
+		upgrade.Apply(cluster, now.Add(time.Hour))
+		Expect(cluster.GetAnnotations()).To(HaveKeyWithValue("postgres.data.nais.io/major-upgrade-started", "2025-03-01T12:00:00Z"))
+	})
+
+	It("should take the backup using the logical backup job", func() {
+		cronJob := &batch_v1.CronJob{
+			Spec: batch_v1.CronJobSpec{
+				JobTemplate: batch_v1.JobTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"application": "spilo-logical-backup"}},
+					Spec: batch_v1.JobSpec{
+						Template: v1.PodTemplateSpec{
+							Spec: v1.PodSpec{Containers: []v1.Container{{Name: "logical-backup", Image: "backup"}}},
+						},
+					},
+				},
+			},
+		}
+		upgrade := MajorVersionUpgrade{From: "16", To: "17", BackupRequested: true}
+		job := CreateUpgradeBackupJobSpec(newPostgres(), upgrade, cronJob, "app", "pg-team")
+		Expect(job.GetName()).To(Equal("app-upgrade-17"))
+		Expect(job.GetNamespace()).To(Equal("pg-team"))
+		Expect(job.GetLabels()).To(HaveKeyWithValue("application", "spilo-logical-backup"))
+		Expect(job.Spec.Template.Spec.Containers).To(HaveLen(1))
+
+		long := MinimalUpgradeBackupJob(newPostgres(), upgrade, "a-cluster-name-that-is-exactly-fifty-characters-lo", "pg-team")
+		Expect(len(long.GetName())).To(BeNumerically("<=", 63))
+	})
+})
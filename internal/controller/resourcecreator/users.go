@@ -0,0 +1,319 @@
+package resourcecreator
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"slices"
+	"strings"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/liberator/pkg/namegen"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	batch_v1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// UsersAnnotation adds users with a privilege profile on a database, or some of its schemas, as a JSON list, e.g.
+	// [{"name": "reporting", "database": "app", "privileges": "read-only"}]. Schemas must have default roles.
+	// Users removed from the annotation are left in Postgres.
+	UsersAnnotation = "postgres.data.nais.io/users"
+
+	// superuserName is the user Zalando creates for the operator, used to grant privileges to the users
+	superuserName = "postgres"
+
+	// Role names longer than this are truncated by Postgres
+	maxRoleNameLength = 63
+
+	// userGrantsBackoffLimit lets the grants be retried for about an hour, while Zalando creates the users
+	userGrantsBackoffLimit = int32(10)
+)
+
+// userNamePattern is the user names Zalando accepts, without the namespace prefix
+var userNamePattern = regexp.MustCompile(`^[a-z]([a-z0-9_]*[a-z0-9])?$`)
+
+// PrivilegeProfile is the privileges a user has on a database or schema, given by membership in one of the default
+// roles created by Zalando
+type PrivilegeProfile string
+
+const (
+	PrivilegeOwner     PrivilegeProfile = "owner"
+	PrivilegeReadWrite PrivilegeProfile = "read-write"
+	PrivilegeReadOnly  PrivilegeProfile = "read-only"
+)
+
+// privilegeRoleSuffixes are the suffixes of the default roles for each privilege profile
+var privilegeRoleSuffixes = map[PrivilegeProfile]string{
+	PrivilegeOwner:     "_owner",
+	PrivilegeReadWrite: "_writer",
+	PrivilegeReadOnly:  "_reader",
+}
+
+// UserRequest is a user requested in UsersAnnotation
+type UserRequest struct {
+	Name string `json:"name"`
+	// Database is the database the user has privileges on, defaults to the app database
+	Database string `json:"database,omitempty"`
+	// Schemas limits the privileges to the given schemas of the database
+	Schemas    []string         `json:"schemas,omitempty"`
+	Privileges PrivilegeProfile `json:"privileges"`
+	// PasswordRotation lets Zalando rotate the password, also when not enabled for all users of the cluster
+	PasswordRotation bool `json:"passwordRotation,omitempty"`
+}
+
+// User is an additional user in the cluster, with its credentials in a secret in the application namespace
+type User struct {
+	// RoleName is the name of the user in Postgres. It is prefixed with the application namespace, as Zalando
+	// requires to create its secret there.
+	RoleName         string
+	Privileges       PrivilegeProfile
+	PasswordRotation bool
+	// Granted are the default roles the user is a member of
+	Granted []string
+	// Revoked are the other default roles of the database, which the user is no longer to be a member of
+	Revoked []string
+}
+
+// GetUsers returns the users requested in the annotations of postgres, with the roles they are granted in databases
+func GetUsers(postgres *data_nais_io_v1.Postgres, databases []Database) ([]User, error) {
+	requests, err := UserRequests(postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]User, 0, len(requests))
+	for _, request := range requests {
+		databaseName := request.Database
+		if len(databaseName) == 0 {
+			databaseName = defaultDatabaseName
+		}
+		i := slices.IndexFunc(databases, func(database Database) bool { return database.Name == databaseName })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s has user %s on database %s, which is not in the cluster", reconciler.ErrInvalid, UsersAnnotation, request.Name, databaseName)
+		}
+		database := databases[i]
+
+		// The default roles of the database, and of the schemas having them, are managed for each user
+		prefixes := []string{database.Name}
+		for _, schema := range database.Schemas {
+			if schema.DefaultRoles {
+				prefixes = append(prefixes, database.Name+"_"+schema.Name)
+			}
+		}
+		granted := []string{database.Name}
+		if len(request.Schemas) > 0 {
+			granted = nil
+			for _, schema := range request.Schemas {
+				prefix := database.Name + "_" + schema
+				if !slices.Contains(prefixes, prefix) {
+					return nil, fmt.Errorf("%w: %s has user %s on schema %s in database %s, which has no default roles", reconciler.ErrInvalid, UsersAnnotation, request.Name, schema, database.Name)
+				}
+				granted = append(granted, prefix)
+			}
+		}
+
+		user := User{
+			RoleName:         postgres.GetNamespace() + "." + request.Name,
+			Privileges:       request.Privileges,
+			PasswordRotation: request.PasswordRotation,
+		}
+		for _, prefix := range prefixes {
+			for _, profile := range []PrivilegeProfile{PrivilegeOwner, PrivilegeReadWrite, PrivilegeReadOnly} {
+				role := prefix + privilegeRoleSuffixes[profile]
+				if profile == request.Privileges && slices.Contains(granted, prefix) {
+					user.Granted = append(user.Granted, role)
+				} else {
+					user.Revoked = append(user.Revoked, role)
+				}
+			}
+		}
+		if len(user.RoleName) > maxRoleNameLength {
+			return nil, fmt.Errorf("%w: %s has user %s, which is longer than %d characters", reconciler.ErrInvalid, UsersAnnotation, user.RoleName, maxRoleNameLength)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// UserRequests parses the users added in the annotations of postgres
+func UserRequests(postgres *data_nais_io_v1.Postgres) ([]UserRequest, error) {
+	value := postgres.GetAnnotations()[UsersAnnotation]
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	var requests []UserRequest
+	if err := json.Unmarshal([]byte(value), &requests); err != nil {
+		return nil, fmt.Errorf("%w: %s must be a JSON list of users: %w", reconciler.ErrInvalid, UsersAnnotation, err)
+	}
+
+	seen := map[string]bool{}
+	for _, request := range requests {
+		switch {
+		case !userNamePattern.MatchString(request.Name):
+			return nil, fmt.Errorf("%w: %s has user %q, names must be in lower case", reconciler.ErrInvalid, UsersAnnotation, request.Name)
+		case request.Name == superuserName:
+			return nil, fmt.Errorf("%w: %s has user %s, which is reserved", reconciler.ErrInvalid, UsersAnnotation, request.Name)
+		case seen[request.Name]:
+			return nil, fmt.Errorf("%w: %s has user %s more than once", reconciler.ErrInvalid, UsersAnnotation, request.Name)
+		case len(privilegeRoleSuffixes[request.Privileges]) == 0:
+			return nil, fmt.Errorf("%w: %s has user %s with privileges %q, must be one of %s, %s or %s", reconciler.ErrInvalid, UsersAnnotation, request.Name, request.Privileges, PrivilegeOwner, PrivilegeReadWrite, PrivilegeReadOnly)
+		}
+		seen[request.Name] = true
+	}
+	return requests, nil
+}
+
+// UserSecretName returns the name of the secret Zalando creates for the user, in the application namespace
+func UserSecretName(user User, pgClusterName string) string {
+	return credentialsSecretName(user.RoleName, pgClusterName)
+}
+
+// credentialsSecretName returns the name of the secret Zalando keeps the credentials of a role in
+func credentialsSecretName(roleName string, pgClusterName string) string {
+	return fmt.Sprintf("%s.%s.credentials.postgresql.acid.zalan.do", strings.ReplaceAll(roleName, "_", "-"), pgClusterName)
+}
+
+// applyUsers adds the users to the cluster, for Zalando to create them with their secrets
+func applyUsers(cluster *acid_zalan_do_v1.Postgresql, users []User) {
+	if len(users) == 0 {
+		return
+	}
+	cluster.Spec.Users = map[string]acid_zalan_do_v1.UserFlags{}
+	for _, user := range users {
+		cluster.Spec.Users[user.RoleName] = acid_zalan_do_v1.UserFlags{}
+	}
+}
+
+// userGrantsSQL returns the statements giving each user exactly the default roles of its privilege profile
+func userGrantsSQL(users []User) string {
+	quote := func(roles []string) string {
+		quoted := make([]string, 0, len(roles))
+		for _, role := range roles {
+			quoted = append(quoted, `"`+role+`"`)
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	var statements []string
+	for _, user := range users {
+		if len(user.Revoked) > 0 {
+			statements = append(statements, fmt.Sprintf(`REVOKE %s FROM "%s";`, quote(user.Revoked), user.RoleName))
+		}
+		statements = append(statements, fmt.Sprintf(`GRANT %s TO "%s";`, quote(user.Granted), user.RoleName))
+	}
+	return strings.Join(statements, "\n")
+}
+
+func MinimalUserGrantsJob(postgres *data_nais_io_v1.Postgres, users []User, pgClusterName string, pgNamespace string) *batch_v1.Job {
+	// The job is named for its statements, so that it is run again whenever they change
+	name := fmt.Sprintf("%s-grants-%08x", pgClusterName, crc32.ChecksumIEEE([]byte(userGrantsSQL(users))))
+	if len(name) > maxJobNameLength {
+		var err error
+		name, err = namegen.ShortName(name, maxJobNameLength)
+		if err != nil {
+			panic(fmt.Sprintf("This should never happen: %v", err))
+		}
+	}
+
+	objectMeta := CreateObjectMeta(postgres)
+	objectMeta.Name = name
+	objectMeta.Namespace = pgNamespace
+
+	return &batch_v1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: objectMeta,
+	}
+}
+
+// CreateUserGrantsJobSpec grants the users the default roles of their privilege profiles, connecting as the superuser.
+// Zalando only creates the users, and has no way of making them members of other roles.
+func CreateUserGrantsJobSpec(postgres *data_nais_io_v1.Postgres, users []User, cfg *config.Config, pgClusterName string, pgNamespace string) *batch_v1.Job {
+	job := MinimalUserGrantsJob(postgres, users, pgClusterName, pgNamespace)
+
+	// The label lets the job through the network policy of the cluster
+	podLabels := map[string]string{
+		"cluster-name": pgClusterName,
+	}
+	superuserSecret := &v1.SecretKeySelector{
+		LocalObjectReference: v1.LocalObjectReference{
+			Name: credentialsSecretName(superuserName, pgClusterName),
+		},
+	}
+
+	job.Spec = batch_v1.JobSpec{
+		BackoffLimit: ptr.To(userGrantsBackoffLimit),
+		Template: v1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: podLabels,
+			},
+			Spec: v1.PodSpec{
+				RestartPolicy: v1.RestartPolicyNever,
+				SecurityContext: &v1.PodSecurityContext{
+					RunAsNonRoot: ptr.To(true),
+					RunAsUser:    ptr.To(runAsUser),
+					RunAsGroup:   ptr.To(runAsGroup),
+				},
+				Containers: []v1.Container{
+					{
+						Name:    "grants",
+						Image:   cfg.PsqlImage,
+						Command: []string{"psql", "--set=ON_ERROR_STOP=1", "--command", userGrantsSQL(users)},
+						Env: []v1.EnvVar{
+							{Name: "PGHOST", Value: pgClusterName},
+							{Name: "PGDATABASE", Value: superuserName},
+							{Name: "PGSSLMODE", Value: "require"},
+							{Name: "PGUSER", ValueFrom: &v1.EnvVarSource{SecretKeyRef: withKey(superuserSecret, "username")}},
+							{Name: "PGPASSWORD", ValueFrom: &v1.EnvVarSource{SecretKeyRef: withKey(superuserSecret, "password")}},
+						},
+						SecurityContext: &v1.SecurityContext{
+							AllowPrivilegeEscalation: ptr.To(false),
+							ReadOnlyRootFilesystem:   ptr.To(true),
+							Capabilities: &v1.Capabilities{
+								Drop: []v1.Capability{"ALL"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	return job
+}
+
+func withKey(selector *v1.SecretKeySelector, key string) *v1.SecretKeySelector {
+	s := selector.DeepCopy()
+	s.Key = key
+	return s
+}
+
+// UserGrants describes the job granting the users their privileges
+type UserGrants struct {
+	Users []User
+	// Job is the job granting the privileges, nil when no users are requested or the cluster is not yet running
+	Job *batch_v1.Job
+}
+
+// Requested returns true if any users are requested
+func (g UserGrants) Requested() bool {
+	return len(g.Users) > 0
+}
+
+// Done returns true if the job has granted the privileges
+func (g UserGrants) Done() bool {
+	return g.Job != nil && jobHasCondition(g.Job, batch_v1.JobComplete)
+}
+
+// Failed returns true if the job has given up granting the privileges
+func (g UserGrants) Failed() bool {
+	return g.Job != nil && jobHasCondition(g.Job, batch_v1.JobFailed)
+}
@@ -0,0 +1,110 @@
+package resourcecreator
+
+import (
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	batch_v1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Users", func() {
+	cfg := &config.Config{
+		PsqlImage: "postgres:17-alpine",
+	}
+
+	// withUsers asks for the users in a cluster with the databases app, with the schema sales, and reporting
+	withUsers := func(users string) postgresOption {
+		return withAnnotations(map[string]string{
+			DatabasesAnnotation: `[{"name": "app", "schemas": [{"name": "sales", "defaultRoles": true}]}, {"name": "reporting"}]`,
+			UsersAnnotation:     users,
+		})
+	}
+
+	getUsers := func(p *data_nais_io_v1.Postgres) ([]User, error) {
+		databases, err := GetDatabases(p, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		return GetUsers(p, databases)
+	}
+
+	It("should grant the default roles of the privilege profile", func() {
+		users, err := getUsers(newPostgres(withUsers(`[
+			{"name": "reporting", "privileges": "read-only"},
+			{"name": "migrate", "database": "reporting", "privileges": "owner", "passwordRotation": true},
+			{"name": "sales_writer", "schemas": ["sales"], "privileges": "read-write"}
+		]`)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(HaveLen(3))
+
+		Expect(users[0].RoleName).To(Equal("team.reporting"))
+		Expect(users[0].Granted).To(Equal([]string{"app_reader"}))
+		Expect(users[0].Revoked).To(ConsistOf("app_owner", "app_writer", "app_sales_owner", "app_sales_writer", "app_sales_reader"))
+
+		Expect(users[1].Granted).To(Equal([]string{"reporting_owner"}))
+		Expect(users[1].Revoked).To(ConsistOf("reporting_writer", "reporting_reader"))
+
+		Expect(users[2].Granted).To(Equal([]string{"app_sales_writer"}))
+		Expect(UserSecretName(users[2], "app")).To(Equal("team.sales-writer.app.credentials.postgresql.acid.zalan.do"))
+	})
+
+	It("should add the users to the cluster for Zalando to create them", func() {
+		p := newPostgres(withUsers(`[{"name": "reporting", "privileges": "read-only"}, {"name": "migrate", "privileges": "owner", "passwordRotation": true}]`))
+		cluster, err := CreateClusterSpec(p, cfg, Clone{}, "app", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.Users).To(Equal(map[string]acid_zalan_do_v1.UserFlags{
+			"team.reporting": {},
+			"team.migrate":   {},
+		}))
+		Expect(cluster.Spec.UsersWithInPlaceSecretRotation).To(Equal([]string{"team.migrate"}))
+	})
+
+	DescribeTable("should reject invalid users",
+		func(users string) {
+			_, err := getUsers(newPostgres(withUsers(users)))
+			Expect(err).To(MatchError(reconciler.ErrInvalid))
+		},
+		Entry("not JSON", "reporting"),
+		Entry("invalid name", `[{"name": "Reporting", "privileges": "read-only"}]`),
+		Entry("superuser", `[{"name": "postgres", "privileges": "owner"}]`),
+		Entry("duplicate name", `[{"name": "reporting", "privileges": "read-only"}, {"name": "reporting", "privileges": "owner"}]`),
+		Entry("unknown privileges", `[{"name": "reporting", "privileges": "superuser"}]`),
+		Entry("unknown database", `[{"name": "reporting", "database": "archive", "privileges": "read-only"}]`),
+		Entry("schema without default roles", `[{"name": "reporting", "schemas": ["public"], "privileges": "read-only"}]`),
+	)
+
+	It("should grant privileges in a job connecting as the superuser", func() {
+		users, err := getUsers(newPostgres(withUsers(`[{"name": "reporting", "privileges": "read-only"}]`)))
+		Expect(err).NotTo(HaveOccurred())
+
+		job := CreateUserGrantsJobSpec(newPostgres(withUsers("")), users, cfg, "app", "pg-team")
+		Expect(job.Namespace).To(Equal("pg-team"))
+		Expect(job.Name).To(HavePrefix("app-grants-"))
+		Expect(job.Spec.Template.Labels).To(HaveKeyWithValue("cluster-name", "app"))
+
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal("postgres:17-alpine"))
+		Expect(container.Command).To(ContainElement(ContainSubstring(`GRANT "app_reader" TO "team.reporting";`)))
+		Expect(container.Command).To(ContainElement(ContainSubstring(`REVOKE "app_owner", "app_writer"`)))
+		Expect(container.Env).To(ContainElement(And(
+			HaveField("Name", "PGPASSWORD"),
+			HaveField("ValueFrom.SecretKeyRef.Name", "postgres.app.credentials.postgresql.acid.zalan.do"),
+		)))
+
+		By("Naming the job after the grants, so that changes are granted by a new job")
+		owners, err := getUsers(newPostgres(withUsers(`[{"name": "reporting", "privileges": "owner"}]`)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(MinimalUserGrantsJob(newPostgres(withUsers("")), owners, "app", "pg-team").Name).NotTo(Equal(job.Name))
+	})
+
+	It("should follow the job granting privileges", func() {
+		grants := UserGrants{Users: []User{{RoleName: "team.reporting"}}, Job: &batch_v1.Job{}}
+		Expect(grants.Done()).To(BeFalse())
+		Expect(grants.Failed()).To(BeFalse())
+
+		grants.Job.Status.Conditions = []batch_v1.JobCondition{{Type: batch_v1.JobComplete, Status: v1.ConditionTrue}}
+		Expect(grants.Done()).To(BeTrue())
+	})
+})
@@ -0,0 +1,121 @@
+package resourcecreator
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// collations lists the locales in the Spilo image, which the database can be initialized with
+var collations = []string{
+	"en_US",
+	"nb_NO",
+}
+
+// ValidatePostgres finds what in postgres would fail when reconciled, or produce a cluster other than the one asked for
+func ValidatePostgres(postgres *data_nais_io_v1.Postgres, cfg *config.Config) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(postgres.GetName()) > maxClusterNameLength {
+		errs = append(errs, field.TooLong(field.NewPath("metadata", "name"), postgres.GetName(), maxClusterNameLength))
+	}
+
+	majorVersionPath := field.NewPath("spec", "cluster", "majorVersion")
+	if !slices.Contains(cfg.SupportedMajorVersions, postgres.Spec.Cluster.MajorVersion) {
+		errs = append(errs, field.NotSupported(majorVersionPath, postgres.Spec.Cluster.MajorVersion, cfg.SupportedMajorVersions))
+	}
+
+	// An unsupported major version is already reported, and leaves no extensions to check against
+	majorVersion, majorVersionErr := strconv.Atoi(postgres.Spec.Cluster.MajorVersion)
+	available := AvailableExtensions(cfg, majorVersion)
+
+	if postgres.Spec.Database != nil {
+		databasePath := field.NewPath("spec", "database")
+		if collation := postgres.Spec.Database.Collation; len(collation) > 0 && !slices.Contains(collations, collation) {
+			errs = append(errs, field.NotSupported(databasePath.Child("collation"), collation, collations))
+		}
+		for i, extension := range postgres.Spec.Database.Extensions {
+			path := databasePath.Child("extensions").Index(i).Child("name")
+			switch {
+			case len(extension.Name) == 0:
+				errs = append(errs, field.Required(path, "name of the extension is required"))
+			case majorVersionErr == nil && !slices.Contains(available, extension.Name):
+				errs = append(errs, field.NotSupported(path, extension.Name, available))
+			}
+		}
+	}
+
+	annotationsPath := field.NewPath("metadata", "annotations")
+	if _, err := ExtensionSchemas(postgres); err != nil {
+		errs = append(errs, field.Invalid(annotationsPath.Key(ExtensionSchemasAnnotation), postgres.GetAnnotations()[ExtensionSchemasAnnotation], err.Error()))
+	}
+
+	databasesPath := annotationsPath.Key(DatabasesAnnotation)
+	if requests, err := DatabaseRequests(postgres); err != nil {
+		errs = append(errs, field.Invalid(databasesPath, postgres.GetAnnotations()[DatabasesAnnotation], err.Error()))
+	} else if majorVersionErr == nil {
+		for _, request := range requests {
+			for _, extension := range request.Extensions {
+				if !slices.Contains(available, extension.Name) {
+					errs = append(errs, field.NotSupported(databasesPath, extension.Name, available))
+				}
+			}
+		}
+	}
+
+	usersPath := annotationsPath.Key(UsersAnnotation)
+	if _, err := UserRequests(postgres); err != nil {
+		errs = append(errs, field.Invalid(usersPath, postgres.GetAnnotations()[UsersAnnotation], err.Error()))
+	} else if databases, err := GetDatabases(postgres, cfg); err == nil {
+		// Users can only be checked against the databases once they are valid
+		if _, err := GetUsers(postgres, databases); err != nil {
+			errs = append(errs, field.Invalid(usersPath, postgres.GetAnnotations()[UsersAnnotation], err.Error()))
+		}
+	}
+
+	if _, err := PasswordRotationInterval(postgres, cfg); err != nil {
+		errs = append(errs, field.Invalid(annotationsPath.Key(PasswordRotationIntervalAnnotation), postgres.GetAnnotations()[PasswordRotationIntervalAnnotation], err.Error()))
+	}
+	if _, err := PasswordRotationRequestedAt(postgres); err != nil {
+		errs = append(errs, field.Invalid(annotationsPath.Key(RotatePasswordsAnnotation), postgres.GetAnnotations()[RotatePasswordsAnnotation], err.Error()))
+	}
+
+	if _, err := ReadReplicasRequested(postgres); err != nil {
+		errs = append(errs, field.Invalid(annotationsPath.Key(ReadReplicasAnnotation), postgres.GetAnnotations()[ReadReplicasAnnotation], err.Error()))
+	} else if _, err := GetConnectionPooler(postgres); err != nil {
+		// The read replicas are part of the pooler, so any error left is in its settings
+		errs = append(errs, field.Invalid(annotationsPath.Key(ConnectionPoolerAnnotation), postgres.GetAnnotations()[ConnectionPoolerAnnotation], err.Error()))
+	}
+
+	// The maintenance window is silently ignored unless both day and hour are set
+	if window := postgres.Spec.MaintenanceWindow; window != nil {
+		windowPath := field.NewPath("spec", "maintenanceWindow")
+		if window.Day < 1 || window.Day > 7 {
+			errs = append(errs, field.Invalid(windowPath.Child("day"), window.Day, "must be from 1 (Monday) to 7 (Sunday)"))
+		}
+		if window.Hour == nil {
+			errs = append(errs, field.Required(windowPath.Child("hour"), "hour is required to set a maintenance window"))
+		} else if *window.Hour < 0 || *window.Hour > 23 {
+			errs = append(errs, field.Invalid(windowPath.Child("hour"), *window.Hour, "must be from 0 to 23"))
+		}
+	}
+
+	return errs
+}
+
+// ValidatePostgresUpdate finds changes from old to postgres that cannot be made to an existing cluster
+func ValidatePostgresUpdate(old *data_nais_io_v1.Postgres, postgres *data_nais_io_v1.Postgres) field.ErrorList {
+	var errs field.ErrorList
+
+	oldVersion, oldErr := strconv.Atoi(old.Spec.Cluster.MajorVersion)
+	newVersion, newErr := strconv.Atoi(postgres.Spec.Cluster.MajorVersion)
+	if oldErr == nil && newErr == nil && newVersion < oldVersion {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "cluster", "majorVersion"), fmt.Sprintf("cannot downgrade from major version %d to %d", oldVersion, newVersion)))
+	}
+
+	return errs
+}
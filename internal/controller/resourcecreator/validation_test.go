@@ -0,0 +1,107 @@
+package resourcecreator
+
+import (
+	"strings"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Validation", func() {
+	cfg := &config.Config{
+		SupportedMajorVersions:       []string{"16", "17"},
+		PasswordRotationIntervalDays: 90,
+	}
+
+	// valid sets the fields that are validated, and left out by newPostgres, to valid values
+	valid := func(p *data_nais_io_v1.Postgres) {
+		p.Spec.Database = &data_nais_io_v1.PostgresDatabase{
+			Collation:  "nb_NO",
+			Extensions: []data_nais_io_v1.PostgresExtension{{Name: "pg_trgm"}},
+		}
+		p.Spec.MaintenanceWindow = &nais_io_v1.Maintenance{Day: 2, Hour: ptr.To(4)}
+	}
+
+	It("should accept a valid resource", func() {
+		Expect(ValidatePostgres(newPostgres(valid), cfg)).To(BeEmpty())
+	})
+
+	DescribeTable("should point at the invalid field",
+		func(mutate func(p *data_nais_io_v1.Postgres), path string, errorType field.ErrorType) {
+			errs := ValidatePostgres(newPostgres(valid, mutate), cfg)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal(path))
+			Expect(errs[0].Type).To(Equal(errorType))
+		},
+		Entry("name that would be shortened", func(p *data_nais_io_v1.Postgres) {
+			p.Name = strings.Repeat("a", 51)
+		}, "metadata.name", field.ErrorTypeTooLong),
+		Entry("unsupported major version", func(p *data_nais_io_v1.Postgres) {
+			p.Spec.Cluster.MajorVersion = "15"
+		}, "spec.cluster.majorVersion", field.ErrorTypeNotSupported),
+		Entry("unknown collation", func(p *data_nais_io_v1.Postgres) {
+			p.Spec.Database.Collation = "sv_SE"
+		}, "spec.database.collation", field.ErrorTypeNotSupported),
+		Entry("unknown extension", func(p *data_nais_io_v1.Postgres) {
+			p.Spec.Database.Extensions = append(p.Spec.Database.Extensions, data_nais_io_v1.PostgresExtension{Name: "pg_magic"})
+		}, "spec.database.extensions[1].name", field.ErrorTypeNotSupported),
+		Entry("extension not available in the major version", func(p *data_nais_io_v1.Postgres) {
+			p.Spec.Database.Extensions = append(p.Spec.Database.Extensions, data_nais_io_v1.PostgresExtension{Name: "plv8"})
+		}, "spec.database.extensions[1].name", field.ErrorTypeNotSupported),
+		Entry("invalid extension schema", func(p *data_nais_io_v1.Postgres) {
+			p.Annotations = map[string]string{ExtensionSchemasAnnotation: "pg_trgm=Search"}
+		}, "metadata.annotations[postgres.data.nais.io/extension-schemas]", field.ErrorTypeInvalid),
+		Entry("invalid databases", func(p *data_nais_io_v1.Postgres) {
+			p.Annotations = map[string]string{DatabasesAnnotation: `[{"name": "Reporting"}]`}
+		}, "metadata.annotations[postgres.data.nais.io/databases]", field.ErrorTypeInvalid),
+		Entry("extension not available in an additional database", func(p *data_nais_io_v1.Postgres) {
+			p.Annotations = map[string]string{DatabasesAnnotation: `[{"name": "reporting", "extensions": [{"name": "pg_magic"}]}]`}
+		}, "metadata.annotations[postgres.data.nais.io/databases]", field.ErrorTypeNotSupported),
+		Entry("invalid users", func(p *data_nais_io_v1.Postgres) {
+			p.Annotations = map[string]string{UsersAnnotation: `[{"name": "reporting", "privileges": "superuser"}]`}
+		}, "metadata.annotations[postgres.data.nais.io/users]", field.ErrorTypeInvalid),
+		Entry("user on a database not in the cluster", func(p *data_nais_io_v1.Postgres) {
+			p.Annotations = map[string]string{UsersAnnotation: `[{"name": "reporting", "database": "reporting", "privileges": "read-only"}]`}
+		}, "metadata.annotations[postgres.data.nais.io/users]", field.ErrorTypeInvalid),
+		Entry("password rotation interval longer than Zalando's", func(p *data_nais_io_v1.Postgres) {
+			p.Annotations = map[string]string{PasswordRotationIntervalAnnotation: "120"}
+		}, "metadata.annotations[postgres.data.nais.io/password-rotation-interval]", field.ErrorTypeInvalid),
+		Entry("password rotation requested at an invalid time", func(p *data_nais_io_v1.Postgres) {
+			p.Annotations = map[string]string{RotatePasswordsAnnotation: "now"}
+		}, "metadata.annotations[postgres.data.nais.io/rotate-passwords]", field.ErrorTypeInvalid),
+		Entry("unknown connection pooler mode", func(p *data_nais_io_v1.Postgres) {
+			p.Annotations = map[string]string{ConnectionPoolerAnnotation: `{"mode": "statement"}`}
+		}, "metadata.annotations[postgres.data.nais.io/connection-pooler]", field.ErrorTypeInvalid),
+		Entry("read replicas neither true nor false", func(p *data_nais_io_v1.Postgres) {
+			p.Annotations = map[string]string{ReadReplicasAnnotation: "yes please"}
+		}, "metadata.annotations[postgres.data.nais.io/read-replicas]", field.ErrorTypeInvalid),
+		Entry("read replicas without high availability", func(p *data_nais_io_v1.Postgres) {
+			p.Spec.Cluster.HighAvailability = false
+			p.Annotations = map[string]string{ReadReplicasAnnotation: "true"}
+		}, "metadata.annotations[postgres.data.nais.io/read-replicas]", field.ErrorTypeInvalid),
+		Entry("maintenance hour out of range", func(p *data_nais_io_v1.Postgres) {
+			p.Spec.MaintenanceWindow.Hour = ptr.To(24)
+		}, "spec.maintenanceWindow.hour", field.ErrorTypeInvalid),
+		Entry("maintenance window without hour", func(p *data_nais_io_v1.Postgres) {
+			p.Spec.MaintenanceWindow.Hour = nil
+		}, "spec.maintenanceWindow.hour", field.ErrorTypeRequired),
+		Entry("maintenance window without day", func(p *data_nais_io_v1.Postgres) {
+			p.Spec.MaintenanceWindow.Day = 0
+		}, "spec.maintenanceWindow.day", field.ErrorTypeInvalid),
+	)
+
+	It("should forbid downgrades", func() {
+		old := newPostgres(valid)
+		downgraded := newPostgres(valid, withMajorVersion("16"))
+		errs := ValidatePostgresUpdate(old, downgraded)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+
+		Expect(ValidatePostgresUpdate(downgraded, old)).To(BeEmpty())
+	})
+})
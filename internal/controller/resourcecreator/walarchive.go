@@ -0,0 +1,107 @@
+package resourcecreator
+
+import (
+	"fmt"
+	"strconv"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	iam_google_v1beta1 "github.com/nais/liberator/pkg/apis/iam.cnrm.cloud.google.com/v1beta1"
+	storage_cnrm_cloud_google_com_v1beta1 "github.com/nais/liberator/pkg/apis/storage.cnrm.cloud.google.com/v1beta1"
+	"github.com/nais/liberator/pkg/namegen"
+	"github.com/nais/pgrator/internal/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	walBucketSuffix  = "wal"
+	walBucketRole    = "roles/storage.objectAdmin"
+	maxBucketNameLen = 63
+)
+
+// WalBucketName is the globally unique name of the GCS bucket holding WAL archives and base backups for the cluster
+func WalBucketName(cfg *config.Config, pgClusterName string, pgNamespace string) string {
+	name, err := namegen.ShortName(fmt.Sprintf("%s-%s-%s", cfg.GoogleProjectID, pgNamespace, pgClusterName), maxBucketNameLen)
+	if err != nil {
+		panic(fmt.Sprintf("This should never happen: %v", err))
+	}
+	return name
+}
+
+func MinimalWalBucket(postgres *data_nais_io_v1.Postgres, pgClusterName string, pgNamespace string) *storage_cnrm_cloud_google_com_v1beta1.StorageBucket {
+	objectMeta := CreateObjectMeta(postgres)
+	objectMeta.Name = fmt.Sprintf("%s-%s", pgClusterName, walBucketSuffix)
+	objectMeta.Namespace = pgNamespace
+
+	return &storage_cnrm_cloud_google_com_v1beta1.StorageBucket{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StorageBucket",
+			APIVersion: "storage.cnrm.cloud.google.com/v1beta1",
+		},
+		ObjectMeta: objectMeta,
+	}
+}
+
+func CreateWalBucketSpec(postgres *data_nais_io_v1.Postgres, cfg *config.Config, pgClusterName string, pgNamespace string) *storage_cnrm_cloud_google_com_v1beta1.StorageBucket {
+	bucket := MinimalWalBucket(postgres, pgClusterName, pgNamespace)
+	bucket.Spec = storage_cnrm_cloud_google_com_v1beta1.StorageBucketSpec{
+		ResourceID:               WalBucketName(cfg, pgClusterName, pgNamespace),
+		Location:                 cfg.GoogleBucketLocation,
+		UniformBucketLevelAccess: true,
+		PublicAccessPrevention:   storage_cnrm_cloud_google_com_v1beta1.PublicAccessPreventionEnforced,
+		LifecycleRules: []storage_cnrm_cloud_google_com_v1beta1.LifecycleRules{
+			{
+				Action:    storage_cnrm_cloud_google_com_v1beta1.Action{Type: "Delete"},
+				Condition: storage_cnrm_cloud_google_com_v1beta1.Condition{Age: cfg.WalRetentionDays},
+			},
+		},
+	}
+	metav1.SetMetaDataAnnotation(&bucket.ObjectMeta, ProjectIdAnnotation, cfg.GoogleProjectID)
+	return bucket
+}
+
+func MinimalWalBucketIAMPolicyMember(postgres *data_nais_io_v1.Postgres, pgClusterName string, pgNamespace string) *iam_google_v1beta1.IAMPolicyMember {
+	objectMeta := CreateObjectMeta(postgres)
+	objectMeta.Name = fmt.Sprintf("%s-%s", pgClusterName, walBucketSuffix)
+	objectMeta.Namespace = pgNamespace
+
+	return &iam_google_v1beta1.IAMPolicyMember{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "IAMPolicyMember",
+			APIVersion: "iam.cnrm.cloud.google.com/v1beta1",
+		},
+		ObjectMeta: objectMeta,
+	}
+}
+
+// CreateWalBucketIAMPolicyMemberSpec lets the postgres-pod service account, used by the cluster pods through
+// workload identity, read and write the WAL bucket
+func CreateWalBucketIAMPolicyMemberSpec(postgres *data_nais_io_v1.Postgres, cfg *config.Config, pgClusterName string, pgNamespace string) *iam_google_v1beta1.IAMPolicyMember {
+	iamPolicyMember := MinimalWalBucketIAMPolicyMember(postgres, pgClusterName, pgNamespace)
+	iamPolicyMember.Spec = iam_google_v1beta1.IAMPolicyMemberSpec{
+		Member: fmt.Sprintf("serviceAccount:postgres-pod@%s.iam.gserviceaccount.com", cfg.GoogleProjectID),
+		Role:   walBucketRole,
+		ResourceRef: iam_google_v1beta1.ResourceRef{
+			ApiVersion: "storage.cnrm.cloud.google.com/v1beta1",
+			Kind:       "StorageBucket",
+			Name:       ptr.To(MinimalWalBucket(postgres, pgClusterName, pgNamespace).GetName()),
+		},
+	}
+	metav1.SetMetaDataAnnotation(&iamPolicyMember.ObjectMeta, ProjectIdAnnotation, cfg.GoogleProjectID)
+	return iamPolicyMember
+}
+
+// walArchivingEnv configures Spilo to continuously archive WAL and take daily base backups to the bucket using WAL-G
+func walArchivingEnv(cfg *config.Config, pgClusterName string, pgNamespace string) []v1.EnvVar {
+	return []v1.EnvVar{
+		{Name: "WAL_GS_BUCKET", Value: WalBucketName(cfg, pgClusterName, pgNamespace)},
+		{Name: "USE_WALG_BACKUP", Value: "true"},
+		{Name: "USE_WALG_RESTORE", Value: "true"},
+		// Spilo defaults to prefixing the archive path with the namespace, but Zalando clones without a prefix
+		{Name: "WAL_BUCKET_SCOPE_PREFIX", Value: ""},
+		{Name: "BACKUP_SCHEDULE", Value: cfg.WalBaseBackupSchedule},
+		// Base backups older than the retention are deleted by the bucket lifecycle, so keep at least as many
+		{Name: "BACKUP_NUM_TO_RETAIN", Value: strconv.Itoa(cfg.WalRetentionDays)},
+	}
+}
@@ -0,0 +1,84 @@
+package resourcecreator
+
+import (
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("WAL archiving", func() {
+	cfg := &config.Config{
+		GoogleProjectID:       "nais-dev-1234",
+		GoogleBucketLocation:  "europe-north1",
+		WalRetentionDays:      7,
+		WalBaseBackupSchedule: "0 1 * * *",
+	}
+
+	postgres := &data_nais_io_v1.Postgres{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "team",
+		},
+	}
+
+	It("should create unique bucket names within the GCS limits", func() {
+		name := WalBucketName(cfg, "app", "pg-team")
+		Expect(name).To(HavePrefix("nais-dev-1234-pg-team-app-"))
+		Expect(len(name)).To(BeNumerically("<=", 63))
+
+		long := WalBucketName(cfg, "a-very-long-cluster-name-that-is-close-to-fifty-ch", "pg-a-very-long-team-name")
+		Expect(len(long)).To(BeNumerically("<=", 63))
+
+		other := WalBucketName(&config.Config{GoogleProjectID: "nais-prod-5678"}, "app", "pg-team")
+		Expect(other).NotTo(Equal(name))
+	})
+
+	It("should create a bucket with retention", func() {
+		bucket := CreateWalBucketSpec(postgres, cfg, "app", "pg-team")
+		Expect(bucket.GetName()).To(Equal("app-wal"))
+		Expect(bucket.GetNamespace()).To(Equal("pg-team"))
+		Expect(bucket.GetAnnotations()).To(HaveKeyWithValue(ProjectIdAnnotation, "nais-dev-1234"))
+		Expect(bucket.Spec.ResourceID).To(Equal(WalBucketName(cfg, "app", "pg-team")))
+		Expect(bucket.Spec.LifecycleRules).To(HaveLen(1))
+		Expect(bucket.Spec.LifecycleRules[0].Action.Type).To(Equal("Delete"))
+		Expect(bucket.Spec.LifecycleRules[0].Condition.Age).To(Equal(7))
+	})
+
+	It("should grant the postgres pods access to the bucket", func() {
+		iam := CreateWalBucketIAMPolicyMemberSpec(postgres, cfg, "app", "pg-team")
+		Expect(iam.Spec.Member).To(Equal("serviceAccount:postgres-pod@nais-dev-1234.iam.gserviceaccount.com"))
+		Expect(iam.Spec.ResourceRef.Kind).To(Equal("StorageBucket"))
+		Expect(*iam.Spec.ResourceRef.Name).To(Equal("app-wal"))
+	})
+
+	It("should configure Spilo to archive to the bucket", func() {
+		postgres := postgres.DeepCopy()
+		postgres.Spec.Cluster.MajorVersion = "17"
+		cluster, err := CreateClusterSpec(postgres, cfg, Clone{}, "app", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.Env).To(ContainElements(
+			v1.EnvVar{Name: "WAL_GS_BUCKET", Value: WalBucketName(cfg, "app", "pg-team")},
+			v1.EnvVar{Name: "USE_WALG_BACKUP", Value: "true"},
+			v1.EnvVar{Name: "WAL_BUCKET_SCOPE_PREFIX", Value: ""},
+		))
+
+		disabled := *cfg
+		disabled.WalArchivingDisabled = true
+		cluster, err = CreateClusterSpec(postgres, &disabled, Clone{}, "app", "pg-team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Spec.Env).To(BeEmpty())
+	})
+
+	It("should alert on archiving lag", func() {
+		rule := CreatePrometheusRuleSpec(postgres, cfg, "app", "pg-team")
+		Expect(rule.Spec.Groups[0].Rules).To(ContainElement(HaveField("Alert", "PostgresWalArchivingLagging")))
+
+		disabled := *cfg
+		disabled.WalArchivingDisabled = true
+		rule = CreatePrometheusRuleSpec(postgres, &disabled, "app", "pg-team")
+		Expect(rule.Spec.Groups[0].Rules).NotTo(ContainElement(HaveField("Alert", "PostgresWalArchivingLagging")))
+	})
+})
@@ -86,7 +86,8 @@ var _ = BeforeSuite(func() {
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
-	recorder = events.NewRecorder(record.NewFakeRecorder(100))
+	// Events are not checked, and a buffered fake recorder would block the reconciler once its buffer is full
+	recorder = events.NewRecorder(&record.FakeRecorder{})
 	Expect(recorder).NotTo(BeNil())
 })
 
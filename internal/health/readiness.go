@@ -0,0 +1,93 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const cacheSyncTimeout = time.Second
+
+type cacheSyncer interface {
+	WaitForCacheSync(ctx context.Context) bool
+}
+
+// Readiness tells whether a replica is ready to do its job, which depends on its role.
+// The elected leader is ready when its caches are synced, and it can reconcile.
+// A standby does not reconcile, but serves webhooks like the leader, and must be able to take over from it.
+// It is ready when its caches are synced, and there is a live leader holding the lease, so that it is only waiting
+// to take over. A lease that has expired without anyone taking over means leader election is stuck, and the
+// standby is reported as not ready, even though it may still serve webhooks, so that someone looks into it.
+type Readiness struct {
+	elected <-chan struct{}
+	cache   cacheSyncer
+	reader  client.Reader
+	lease   types.NamespacedName
+	now     func() time.Time
+}
+
+// NewReadiness creates a readiness check. The lease is only checked by standbys, so it must be set when leader
+// election is enabled, and elected closed right away when it is not.
+func NewReadiness(elected <-chan struct{}, cache cacheSyncer, reader client.Reader, lease types.NamespacedName) *Readiness {
+	return &Readiness{
+		elected: elected,
+		cache:   cache,
+		reader:  reader,
+		lease:   lease,
+		now:     time.Now,
+	}
+}
+
+// IsLeader returns true once this replica has been elected leader, or immediately if leader election is disabled
+func (r *Readiness) IsLeader() bool {
+	select {
+	case <-r.elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check implements healthz.Checker
+func (r *Readiness) Check(req *http.Request) error {
+	ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+	defer cancel()
+	if !r.cache.WaitForCacheSync(ctx) {
+		return errors.New("caches not synced")
+	}
+
+	if r.IsLeader() {
+		return nil
+	}
+
+	lease := &coordination_v1.Lease{}
+	if err := r.reader.Get(req.Context(), r.lease, lease); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("standby: lease %s does not exist, no leader elected", r.lease)
+		}
+		return fmt.Errorf("standby: unable to get lease %s: %w", r.lease, err)
+	}
+
+	spec := lease.Spec
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return fmt.Errorf("standby: lease %s has not been acquired", r.lease)
+	}
+
+	// Standbys try to acquire an expired lease right away, so give them one lease duration to do so
+	leaseDuration := time.Duration(*spec.LeaseDurationSeconds) * time.Second
+	if stuckAt := spec.RenewTime.Add(2 * leaseDuration); r.now().After(stuckAt) {
+		holder := "unknown"
+		if spec.HolderIdentity != nil {
+			holder = *spec.HolderIdentity
+		}
+		return fmt.Errorf("standby: lease %s held by %s expired at %s without being taken over", r.lease, holder, spec.RenewTime.Add(leaseDuration).Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coordination_v1 "k8s.io/api/coordination/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeCache bool
+
+func (c fakeCache) WaitForCacheSync(_ context.Context) bool {
+	return bool(c)
+}
+
+var _ = Describe("Readiness", func() {
+	leaseKey := types.NamespacedName{Namespace: "nais-system", Name: "pgrator.nais.io"}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	newLease := func(renewedAgo time.Duration) *coordination_v1.Lease {
+		return &coordination_v1.Lease{
+			ObjectMeta: meta_v1.ObjectMeta{Name: leaseKey.Name, Namespace: leaseKey.Namespace},
+			Spec: coordination_v1.LeaseSpec{
+				HolderIdentity:       ptr.To("pgrator-abc"),
+				LeaseDurationSeconds: ptr.To[int32](15),
+				RenewTime:            ptr.To(meta_v1.NewMicroTime(now.Add(-renewedAgo))),
+			},
+		}
+	}
+
+	newReadiness := func(elected bool, synced bool, objects ...client.Object) *Readiness {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		electedCh := make(chan struct{})
+		if elected {
+			close(electedCh)
+		}
+		r := NewReadiness(electedCh, fakeCache(synced), fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(), leaseKey)
+		r.now = func() time.Time { return now }
+		return r
+	}
+
+	check := func(r *Readiness) error {
+		return r.Check(httptest.NewRequest("GET", "/readyz", nil))
+	}
+
+	It("should not be ready before caches are synced", func() {
+		Expect(check(newReadiness(true, false))).To(MatchError(ContainSubstring("caches not synced")))
+	})
+
+	It("should report the leader as ready", func() {
+		r := newReadiness(true, true)
+		Expect(r.IsLeader()).To(BeTrue())
+		Expect(check(r)).To(Succeed())
+	})
+
+	It("should report a standby as ready while the leader renews the lease", func() {
+		r := newReadiness(false, true, newLease(5*time.Second))
+		Expect(r.IsLeader()).To(BeFalse())
+		Expect(check(r)).To(Succeed())
+	})
+
+	It("should report a standby as not ready when the lease has expired without being taken over", func() {
+		Expect(check(newReadiness(false, true, newLease(time.Minute)))).To(MatchError(ContainSubstring("without being taken over")))
+	})
+
+	It("should report a standby as not ready when there is no lease", func() {
+		Expect(check(newReadiness(false, true))).To(MatchError(ContainSubstring("no leader elected")))
+	})
+})
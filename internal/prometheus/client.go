@@ -0,0 +1,38 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	prometheus_v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// Client runs queries against the Prometheus holding the metrics of the clusters
+type Client struct {
+	api prometheus_v1.API
+}
+
+func NewClient(address string) (*Client, error) {
+	client, err := api.NewClient(api.Config{Address: address})
+	if err != nil {
+		return nil, fmt.Errorf("creating Prometheus client: %w", err)
+	}
+	return &Client{api: prometheus_v1.NewAPI(client)}, nil
+}
+
+// HasResults returns true when the instant query currently returns any series
+func (c *Client) HasResults(ctx context.Context, query string) (bool, error) {
+	result, _, err := c.api.Query(ctx, query, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("querying Prometheus: %w", err)
+	}
+
+	vector, ok := result.(model.Vector)
+	if !ok {
+		return false, fmt.Errorf("query returned %s, expected a vector", result.Type())
+	}
+	return len(vector) > 0, nil
+}
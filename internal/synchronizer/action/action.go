@@ -3,6 +3,8 @@ package action
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sync"
 
 	liberator_scheme "github.com/nais/liberator/pkg/scheme"
 	"github.com/nais/pgrator/internal/synchronizer/events"
@@ -20,8 +22,17 @@ type ConditionGetter func(obj client.Object) []meta_v1.Condition
 
 type Action interface {
 	Do(context.Context, client.Client, *runtime.Scheme) error
+	// Plan describes what Do would change, without changing anything
+	Plan(context.Context, client.Client, *runtime.Scheme) (Plan, error)
 	GetObject() client.Object
 	GetOwner() object.NaisObject
+	// Type returns the name of the kind of action, e.g. "CreateOrUpdate"
+	Type() string
+	// Owned reports whether the object belongs to the owner of the action, and is deleted when no longer referenced
+	Owned() bool
+	// DependsOn declares actions that must be performed successfully before this action
+	DependsOn(...Action)
+	Dependencies() []Action
 }
 
 type action struct {
@@ -29,6 +40,7 @@ type action struct {
 	owner           object.NaisObject
 	conditionGetter ConditionGetter
 	recorder        events.Recorder
+	dependencies    []Action
 }
 
 func (a *action) GetObject() client.Object {
@@ -39,10 +51,44 @@ func (a *action) GetOwner() object.NaisObject {
 	return a.owner
 }
 
+func (a *action) Owned() bool {
+	return true
+}
+
+func (a *action) DependsOn(dependencies ...Action) {
+	a.dependencies = append(a.dependencies, dependencies...)
+}
+
+func (a *action) Dependencies() []Action {
+	return a.dependencies
+}
+
+// statusLock serializes changes to owner status, since actions may be performed concurrently
+var statusLock sync.Mutex
+
+// SetConditions sets conditions on the status of owner, and is safe for concurrent use
+func SetConditions(owner object.NaisObject, conditions ...meta_v1.Condition) {
+	statusLock.Lock()
+	defer statusLock.Unlock()
+
+	status := owner.GetStatus()
+	if status.Conditions == nil {
+		status.Conditions = new([]meta_v1.Condition)
+	}
+
+	for _, condition := range conditions {
+		meta.SetStatusCondition(status.Conditions, condition)
+	}
+}
+
 type createIfNotExists struct {
 	action
 }
 
+func (a *createIfNotExists) Type() string {
+	return "CreateIfNotExists"
+}
+
 func (a *createIfNotExists) Do(ctx context.Context, c client.Client, scheme *runtime.Scheme) error {
 	log := logf.FromContext(ctx)
 	log.Info(fmt.Sprintf("CreateIfNotExists %s", liberator_scheme.TypeName(a.obj)))
@@ -70,14 +116,7 @@ func (a *createIfNotExists) Do(ctx context.Context, c client.Client, scheme *run
 		a.recorder.RecordEvent(a.owner, v1.EventTypeNormal, "Exists", "%s already exists", describeObj(a.obj))
 	}
 
-	status := a.owner.GetStatus()
-	if status.Conditions == nil {
-		status.Conditions = new([]meta_v1.Condition)
-	}
-
-	for _, condition := range conditions {
-		meta.SetStatusCondition(status.Conditions, condition)
-	}
+	SetConditions(a.owner, conditions...)
 
 	return nil
 }
@@ -97,10 +136,18 @@ type createOrUpdate struct {
 	action
 }
 
+func (a *createOrUpdate) Type() string {
+	return "CreateOrUpdate"
+}
+
 func (a *createOrUpdate) Do(ctx context.Context, c client.Client, scheme *runtime.Scheme) error {
 	log := logf.FromContext(ctx)
 	log.Info(fmt.Sprintf("CreateOrUpdate %s", liberator_scheme.TypeName(a.obj)))
 
+	if err := setManagedFields(a.obj); err != nil {
+		return fmt.Errorf("recording managed fields: %w", err)
+	}
+
 	existing, err := scheme.New(a.obj.GetObjectKind().GroupVersionKind())
 	if err != nil {
 		return fmt.Errorf("internal error: %w", err)
@@ -119,6 +166,20 @@ func (a *createOrUpdate) Do(ctx context.Context, c client.Client, scheme *runtim
 		return nil
 	}
 
+	fields, err := driftedFields(a.obj, existing)
+	if err != nil {
+		return fmt.Errorf("detecting drift: %w", err)
+	}
+	drift := driftCondition(a.obj, fields)
+
+	if len(fields) == 0 {
+		log.V(1).Info(fmt.Sprintf("No drift detected for %s, skipping update", describeObj(a.obj)))
+		existingObj := existing.(client.Object)
+		existingObj.GetObjectKind().SetGroupVersionKind(a.obj.GetObjectKind().GroupVersionKind())
+		SetConditions(a.owner, append(a.conditionGetter(existingObj), drift)...)
+		return nil
+	}
+
 	if err = copyMeta(a.obj, existing); err != nil {
 		return fmt.Errorf("copying metadata: %w", err)
 	}
@@ -126,28 +187,75 @@ func (a *createOrUpdate) Do(ctx context.Context, c client.Client, scheme *runtim
 	if err = c.Update(ctx, a.obj); err != nil {
 		return err
 	}
-	a.recorder.RecordEvent(a.owner, v1.EventTypeNormal, "Updated", "Updated %s", describeObj(a.obj))
+	a.recorder.RecordEvent(a.owner, v1.EventTypeNormal, "Updated", "Updated %s, drifted fields: %s", describeObj(a.obj), describeFields(fields))
 
-	status := a.owner.GetStatus()
-	if status.Conditions == nil {
-		status.Conditions = new([]meta_v1.Condition)
+	SetConditions(a.owner, append(a.conditionGetter(a.obj), drift)...)
+
+	return nil
+}
+
+func CreateOrUpdate(obj client.Object, owner object.NaisObject, conditionGetter ConditionGetter, recorder events.Recorder) Action {
+	return &createOrUpdate{
+		action: action{
+			obj:             obj,
+			owner:           owner,
+			conditionGetter: conditionGetter,
+			recorder:        recorder,
+		},
 	}
+}
 
-	for _, condition := range a.conditionGetter(a.obj) {
-		meta.SetStatusCondition(status.Conditions, condition)
+type apply struct {
+	action
+	fieldManager string
+	force        bool
+}
+
+func (a *apply) Type() string {
+	return "Apply"
+}
+
+func (a *apply) Do(ctx context.Context, c client.Client, _ *runtime.Scheme) error {
+	log := logf.FromContext(ctx)
+	log.Info(fmt.Sprintf("Apply %s", liberator_scheme.TypeName(a.obj)))
+
+	// Server-side apply requires these to be unset, and they would be ignored anyway
+	a.obj.SetResourceVersion("")
+	a.obj.SetManagedFields(nil)
+
+	err := c.Patch(ctx, a.obj, client.Apply, client.FieldOwner(a.fieldManager))
+	if apierrors.IsConflict(err) {
+		// Another field manager owns some of the fields we want to set. Make the conflict visible, and only take
+		// ownership when asked to, since the other manager will likely just take the fields back.
+		if !a.force {
+			a.recorder.RecordEvent(a.owner, v1.EventTypeWarning, "ApplyConflict", "Conflicting field ownership on %s: %v", describeObj(a.obj), err)
+			return err
+		}
+		a.recorder.RecordEvent(a.owner, v1.EventTypeWarning, "ApplyConflict", "Conflicting field ownership on %s, forcing ownership: %v", describeObj(a.obj), err)
+		err = c.Patch(ctx, a.obj, client.Apply, client.FieldOwner(a.fieldManager), client.ForceOwnership)
 	}
+	if err != nil {
+		return err
+	}
+	a.recorder.RecordEvent(a.owner, v1.EventTypeNormal, "Applied", "Applied %s", describeObj(a.obj))
+
+	SetConditions(a.owner, a.conditionGetter(a.obj)...)
 
 	return nil
 }
 
-func CreateOrUpdate(obj client.Object, owner object.NaisObject, conditionGetter ConditionGetter, recorder events.Recorder) Action {
-	return &createOrUpdate{
+// Apply uses server-side apply with the given field manager, leaving fields owned by other managers untouched.
+// Fields we set that are owned by other managers make it fail with a conflict, unless force is set to take them over.
+func Apply(obj client.Object, owner object.NaisObject, fieldManager string, force bool, conditionGetter ConditionGetter, recorder events.Recorder) Action {
+	return &apply{
 		action: action{
 			obj:             obj,
 			owner:           owner,
 			conditionGetter: conditionGetter,
 			recorder:        recorder,
 		},
+		fieldManager: fieldManager,
+		force:        force,
 	}
 }
 
@@ -155,6 +263,10 @@ type deleteIfExists struct {
 	action
 }
 
+func (a *deleteIfExists) Type() string {
+	return "DeleteIfExists"
+}
+
 func (a *deleteIfExists) Do(ctx context.Context, c client.Client, _ *runtime.Scheme) error {
 	log := logf.FromContext(ctx)
 	log.Info(fmt.Sprintf("DeleteIfExists %s", liberator_scheme.TypeName(a.obj)))
@@ -166,20 +278,95 @@ func (a *deleteIfExists) Do(ctx context.Context, c client.Client, _ *runtime.Sch
 
 	a.recorder.RecordEvent(a.owner, v1.EventTypeNormal, "Deleted", "Deleted %s", describeObj(a.obj))
 
-	status := a.owner.GetStatus()
-	if status.Conditions == nil {
-		status.Conditions = new([]meta_v1.Condition)
+	SetConditions(a.owner, a.conditionGetter(a.obj)...)
+
+	return nil
+}
+
+func DeleteIfExists(obj client.Object, owner object.NaisObject, conditionGetter ConditionGetter, recorder events.Recorder) Action {
+	return &deleteIfExists{
+		action: action{
+			obj:             obj,
+			owner:           owner,
+			conditionGetter: conditionGetter,
+			recorder:        recorder,
+		},
 	}
+}
 
-	for _, condition := range a.conditionGetter(a.obj) {
-		meta.SetStatusCondition(status.Conditions, condition)
+type patch struct {
+	action
+}
+
+func (a *patch) Type() string {
+	return "Patch"
+}
+
+// Owned is false, since the patched object belongs to someone else
+func (a *patch) Owned() bool {
+	return false
+}
+
+func (a *patch) Do(ctx context.Context, c client.Client, scheme *runtime.Scheme) error {
+	log := logf.FromContext(ctx)
+	log.Info(fmt.Sprintf("Patch %s", liberator_scheme.TypeName(a.obj)))
+
+	// Merging with an empty object patches exactly the fields set in obj
+	empty, err := scheme.New(a.obj.GetObjectKind().GroupVersionKind())
+	if err != nil {
+		return fmt.Errorf("internal error: %w", err)
 	}
 
+	if err = c.Patch(ctx, a.obj, client.MergeFrom(empty.(client.Object))); err != nil {
+		return err
+	}
+	a.recorder.RecordEvent(a.owner, v1.EventTypeNormal, "Patched", "Patched %s", describeObj(a.obj))
+
+	SetConditions(a.owner, a.conditionGetter(a.obj)...)
+
 	return nil
 }
 
-func DeleteIfExists(obj client.Object, owner object.NaisObject, conditionGetter ConditionGetter, recorder events.Recorder) Action {
-	return &deleteIfExists{
+// Patch merges the fields set in obj into an existing object managed by someone else, leaving all other fields as they are.
+// It fails if the object does not exist.
+func Patch(obj client.Object, owner object.NaisObject, conditionGetter ConditionGetter, recorder events.Recorder) Action {
+	return &patch{
+		action: action{
+			obj:             obj,
+			owner:           owner,
+			conditionGetter: conditionGetter,
+			recorder:        recorder,
+		},
+	}
+}
+
+type observe struct {
+	action
+}
+
+func (o *observe) Type() string {
+	return "Observe"
+}
+
+func (o *observe) Do(ctx context.Context, c client.Client, scheme *runtime.Scheme) error {
+	existing, err := getExisting(ctx, c, scheme, o.obj)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		SetConditions(o.owner, o.conditionGetter(o.obj)...)
+		return nil
+	}
+
+	existing.GetObjectKind().SetGroupVersionKind(o.obj.GetObjectKind().GroupVersionKind())
+	SetConditions(o.owner, o.conditionGetter(existing)...)
+	return nil
+}
+
+// Observe reports conditions for an object managed by someone else, without ever changing it.
+// If the object does not exist, the condition getter is called with obj as given, without a resource version.
+func Observe(obj client.Object, owner object.NaisObject, conditionGetter ConditionGetter, recorder events.Recorder) Action {
+	return &observe{
 		action: action{
 			obj:             obj,
 			owner:           owner,
@@ -193,6 +380,10 @@ type noOp struct {
 	action
 }
 
+func (n *noOp) Type() string {
+	return "NoOp"
+}
+
 func (n *noOp) Do(_ context.Context, _ client.Client, _ *runtime.Scheme) error { return nil }
 
 func NoOp(obj client.Object, owner object.NaisObject, conditionGetter ConditionGetter, recorder events.Recorder) Action {
@@ -222,7 +413,32 @@ func copyMeta(dst, src runtime.Object) error {
 	dstacc.SetUID(srcacc.GetUID())
 	dstacc.SetSelfLink(srcacc.GetSelfLink())
 
-	return err
+	// Other controllers are free to add their own labels and annotations, which are not drift and must be kept.
+	// Those we set ourselves on a previous update, but no longer want, are removed.
+	previous, err := getManagedFields(srcacc)
+	if err != nil {
+		return err
+	}
+	dstacc.SetLabels(mergeMissing(dstacc.GetLabels(), srcacc.GetLabels(), previous.Labels))
+	dstacc.SetAnnotations(mergeMissing(dstacc.GetAnnotations(), srcacc.GetAnnotations(), previous.Annotations))
+
+	return nil
+}
+
+// mergeMissing adds the entries of src that are not in dst, except the keys in removed
+func mergeMissing(dst, src map[string]string, removed []string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for k, v := range src {
+		if _, ok := dst[k]; !ok && !slices.Contains(removed, k) {
+			dst[k] = v
+		}
+	}
+	return dst
 }
 
 func describeObj(obj client.Object) string {
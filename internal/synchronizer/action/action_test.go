@@ -0,0 +1,180 @@
+package action
+
+import (
+	"context"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/synchronizer/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func noConditions(client.Object) []meta_v1.Condition {
+	return nil
+}
+
+var _ = Describe("CreateOrUpdate", func() {
+	var (
+		ctx      context.Context
+		c        client.Client
+		owner    *data_nais_io_v1.Postgres
+		recorder events.Recorder
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		owner = &data_nais_io_v1.Postgres{}
+		recorder = events.NewRecorder(record.NewFakeRecorder(10))
+	})
+
+	It("should keep labels and annotations added by others when updating", func() {
+		existing := makeNetpol()
+		existing.Labels["other-controller/label"] = "kept"
+		existing.Annotations["other-controller/annotation"] = "kept"
+		existing.Annotations["nais.io/deploymentCorrelationID"] = "old"
+		existing.Spec.PodSelector.MatchLabels["cluster-name"] = "other"
+		Expect(c.Create(ctx, existing)).To(Succeed())
+
+		Expect(CreateOrUpdate(makeNetpol(), owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		updated := &networking_v1.NetworkPolicy{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(existing), updated)).To(Succeed())
+		Expect(updated.Spec.PodSelector.MatchLabels).To(HaveKeyWithValue("cluster-name", "test"))
+		Expect(updated.Labels).To(HaveKeyWithValue("other-controller/label", "kept"))
+		Expect(updated.Annotations).To(HaveKeyWithValue("other-controller/annotation", "kept"))
+		Expect(updated.Annotations).To(HaveKeyWithValue("nais.io/deploymentCorrelationID", "abc"))
+	})
+
+	It("should remove fields it set before, but no longer wants", func() {
+		desired := makeNetpol()
+		desired.Spec.Ingress = []networking_v1.NetworkPolicyIngressRule{{Ports: []networking_v1.NetworkPolicyPort{{}}}}
+		Expect(CreateOrUpdate(desired, owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		Expect(CreateOrUpdate(makeNetpol(), owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		updated := &networking_v1.NetworkPolicy{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(desired), updated)).To(Succeed())
+		Expect(updated.Spec.Ingress).To(BeEmpty())
+	})
+
+	It("should remove labels and annotations it set before, but no longer wants", func() {
+		desired := makeNetpol()
+		desired.Labels["removed"] = "label"
+		desired.Annotations["removed"] = "annotation"
+		Expect(CreateOrUpdate(desired, owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		existing := &networking_v1.NetworkPolicy{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(desired), existing)).To(Succeed())
+		existing.Labels["other-controller/label"] = "kept"
+		Expect(c.Update(ctx, existing)).To(Succeed())
+
+		Expect(CreateOrUpdate(makeNetpol(), owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		updated := &networking_v1.NetworkPolicy{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(desired), updated)).To(Succeed())
+		Expect(updated.Labels).NotTo(HaveKey("removed"))
+		Expect(updated.Annotations).NotTo(HaveKey("removed"))
+		Expect(updated.Labels).To(HaveKeyWithValue("other-controller/label", "kept"))
+		Expect(updated.Labels).To(HaveKeyWithValue("postgres.data.nais.io/name", "test"))
+	})
+})
+
+var _ = Describe("Apply", func() {
+	var (
+		ctx      context.Context
+		c        client.Client
+		owner    *data_nais_io_v1.Postgres
+		recorder events.Recorder
+		forced   bool
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		forced = false
+		// Applies conflict with another field manager, unless ownership is forced
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(_ context.Context, _ client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				Expect(patch.Type()).To(Equal(types.ApplyPatchType))
+				patchOpts := &client.PatchOptions{}
+				patchOpts.ApplyOptions(opts)
+				if patchOpts.Force == nil || !*patchOpts.Force {
+					return apierrors.NewConflict(schema.GroupResource{Group: "networking.k8s.io", Resource: "networkpolicies"}, obj.GetName(), nil)
+				}
+				forced = true
+				return nil
+			},
+		}).Build()
+		owner = &data_nais_io_v1.Postgres{}
+		recorder = events.NewRecorder(record.NewFakeRecorder(10))
+	})
+
+	It("should fail on conflicts by default", func() {
+		err := Apply(makeNetpol(), owner, "test", false, noConditions, recorder).Do(ctx, c, scheme.Scheme)
+		Expect(apierrors.IsConflict(err)).To(BeTrue())
+		Expect(forced).To(BeFalse())
+	})
+
+	It("should take ownership on conflicts when forced", func() {
+		Expect(Apply(makeNetpol(), owner, "test", true, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+		Expect(forced).To(BeTrue())
+	})
+})
+
+var _ = Describe("Patch", func() {
+	var (
+		ctx      context.Context
+		c        client.Client
+		owner    *data_nais_io_v1.Postgres
+		recorder events.Recorder
+	)
+
+	makeSecret := func(data map[string][]byte) *core_v1.Secret {
+		return &core_v1.Secret{
+			TypeMeta: meta_v1.TypeMeta{
+				Kind:       "Secret",
+				APIVersion: "v1",
+			},
+			ObjectMeta: meta_v1.ObjectMeta{
+				Name:      "credentials",
+				Namespace: "test",
+			},
+			Data: data,
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		owner = &data_nais_io_v1.Postgres{}
+		recorder = events.NewRecorder(record.NewFakeRecorder(10))
+	})
+
+	It("should only change the fields set", func() {
+		Expect(c.Create(ctx, makeSecret(map[string][]byte{"username": []byte("app"), "nextRotation": []byte("later")}))).To(Succeed())
+
+		Expect(Patch(makeSecret(map[string][]byte{"nextRotation": []byte("now")}), owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		patched := &core_v1.Secret{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(makeSecret(nil)), patched)).To(Succeed())
+		Expect(patched.Data).To(Equal(map[string][]byte{"username": []byte("app"), "nextRotation": []byte("now")}))
+	})
+
+	It("should fail for missing objects", func() {
+		Expect(Patch(makeSecret(map[string][]byte{"nextRotation": []byte("now")}), owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).NotTo(Succeed())
+
+		_, err := Patch(makeSecret(nil), owner, noConditions, recorder).Plan(ctx, c, scheme.Scheme)
+		Expect(err).To(HaveOccurred())
+	})
+})
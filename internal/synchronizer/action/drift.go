@@ -0,0 +1,230 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const maxDriftedFieldsInMessage = 10
+
+// FieldChange is a field that differs between the existing and the desired object, with both values
+type FieldChange struct {
+	Path string `json:"path"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, describeValue(c.Old), describeValue(c.New))
+}
+
+// redactedValue replaces the values of secret data, which must never end up in logs or conditions
+const redactedValue = "<redacted>"
+
+// driftedFields returns the paths of all fields set in the desired object where the existing object differs.
+func driftedFields(desired, existing runtime.Object) ([]string, error) {
+	changes, err := driftedChanges(desired, existing)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		fields = append(fields, change.Path)
+	}
+	return fields, nil
+}
+
+// ignoredFields are never drift, as they are set by the API server or compared separately
+var ignoredFields = []string{"apiVersion", "kind", "metadata", "status"}
+
+// driftedChanges returns all fields set in the desired object where the existing object differs, sorted by path.
+// Status and server-managed metadata are ignored. Like labels and annotations, other fields are only compared
+// when present in the desired object, since the API server fills in defaults and other controllers add their own.
+// What we set on the last update, as recorded in the managed fields annotation, is the exception, and is drift once
+// no longer desired.
+func driftedChanges(desired, existing runtime.Object) ([]FieldChange, error) {
+	desiredContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return nil, fmt.Errorf("converting desired object: %w", err)
+	}
+	existingContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(existing)
+	if err != nil {
+		return nil, fmt.Errorf("converting existing object: %w", err)
+	}
+
+	existingMeta, err := meta.Accessor(existing)
+	if err != nil {
+		return nil, fmt.Errorf("reading existing metadata: %w", err)
+	}
+	managed, err := getManagedFields(existingMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]FieldChange, 0)
+	for section, managedKeys := range map[string][]string{"labels": managed.Labels, "annotations": managed.Annotations} {
+		desiredMap := nestedMap(desiredContent, "metadata", section)
+		existingMap := nestedMap(existingContent, "metadata", section)
+		for key, value := range desiredMap {
+			// Changes to what we set are reported as the fields themselves. Objects last updated before it was recorded
+			// are updated to record it, or nothing we stop setting would be drift.
+			if key == managedFieldsAnnotation {
+				if _, ok := existingMap[key]; !ok {
+					changes = append(changes, FieldChange{Path: fmt.Sprintf("metadata.%s[%s]", section, key), New: value})
+				}
+				continue
+			}
+			if existingValue, ok := existingMap[key]; !ok || existingValue != value {
+				changes = append(changes, FieldChange{Path: fmt.Sprintf("metadata.%s[%s]", section, key), Old: existingValue, New: value})
+			}
+		}
+		// Keys we set before, but no longer want, are removed on update
+		for _, key := range managedKeys {
+			if _, ok := desiredMap[key]; !ok {
+				if existingValue, ok := existingMap[key]; ok {
+					changes = append(changes, FieldChange{Path: fmt.Sprintf("metadata.%s[%s]", section, key), Old: existingValue})
+				}
+			}
+		}
+	}
+
+	for _, ignored := range ignoredFields {
+		delete(desiredContent, ignored)
+		delete(existingContent, ignored)
+	}
+	changes = append(changes, compareValues("", desiredContent, existingContent)...)
+	changes = append(changes, removedFields(managed.Fields, desiredContent, existingContent)...)
+
+	if _, ok := desired.(*core_v1.Secret); ok {
+		for i := range changes {
+			if strings.HasPrefix(changes[i].Path, "data") || strings.HasPrefix(changes[i].Path, "stringData") {
+				changes[i].Old, changes[i].New = redactedValue, redactedValue
+			}
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b FieldChange) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return changes, nil
+}
+
+func compareValues(path string, desired, existing any) []FieldChange {
+	if isEmpty(desired) && isEmpty(existing) {
+		return nil
+	}
+	changed := []FieldChange{{Path: path, Old: existing, New: desired}}
+
+	// Lists are reported as a whole, but their elements are compared like objects, ignoring fields only set on the existing element
+	if desiredList, ok := desired.([]any); ok {
+		existingList, ok := existing.([]any)
+		if !ok || len(desiredList) != len(existingList) {
+			return changed
+		}
+		for i := range desiredList {
+			if len(compareValues(path, desiredList[i], existingList[i])) > 0 {
+				return changed
+			}
+		}
+		return nil
+	}
+
+	desiredMap, ok := desired.(map[string]any)
+	if !ok {
+		if equality.Semantic.DeepEqual(desired, existing) {
+			return nil
+		}
+		return changed
+	}
+
+	existingMap, ok := existing.(map[string]any)
+	if !ok {
+		return changed
+	}
+
+	// Fields only set on the existing object are defaulted by the API server or set by others, and are not drift
+	changes := make([]FieldChange, 0)
+	for key, desiredValue := range desiredMap {
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+		changes = append(changes, compareValues(childPath, desiredValue, existingMap[key])...)
+	}
+	return changes
+}
+
+// isEmpty treats nil, empty maps and empty slices as equal, since they serialize differently depending on omitempty
+func isEmpty(value any) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	default:
+		return false
+	}
+}
+
+func nestedMap(content map[string]any, fields ...string) map[string]any {
+	current := content
+	for _, field := range fields {
+		next, ok := current[field].(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+func driftCondition(obj client.Object, fields []string) meta_v1.Condition {
+	typePrefix := strings.ToLower(obj.GetObjectKind().GroupVersionKind().GroupKind().String())
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/Drifted", typePrefix),
+		Status:             meta_v1.ConditionFalse,
+		ObservedGeneration: obj.GetGeneration(),
+		Reason:             "InSync",
+		Message:            "No drift detected",
+	}
+	if len(fields) > 0 {
+		condition.Status = meta_v1.ConditionTrue
+		condition.Reason = "Drifted"
+		condition.Message = fmt.Sprintf("Drifted fields: %s", describeFields(fields))
+	}
+	return condition
+}
+
+// describeValue renders a field value compactly as JSON, with missing values as <none>
+func describeValue(value any) string {
+	if value == nil {
+		return "<none>"
+	}
+	if value == redactedValue {
+		return redactedValue
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+func describeFields(fields []string) string {
+	if len(fields) <= maxDriftedFieldsInMessage {
+		return strings.Join(fields, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(fields[:maxDriftedFieldsInMessage], ", "), len(fields)-maxDriftedFieldsInMessage)
+}
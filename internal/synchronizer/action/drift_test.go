@@ -0,0 +1,172 @@
+package action
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	acid_zalan_do_v1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func makeNetpol() *networking_v1.NetworkPolicy {
+	return &networking_v1.NetworkPolicy{
+		TypeMeta: meta_v1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:        "test",
+			Namespace:   "pg-test",
+			Labels:      map[string]string{"postgres.data.nais.io/name": "test"},
+			Annotations: map[string]string{"nais.io/deploymentCorrelationID": "abc"},
+		},
+		Spec: networking_v1.NetworkPolicySpec{
+			PodSelector: meta_v1.LabelSelector{
+				MatchLabels: map[string]string{"cluster-name": "test"},
+			},
+			PolicyTypes: []networking_v1.PolicyType{networking_v1.PolicyTypeIngress},
+		},
+	}
+}
+
+var _ = Describe("driftedFields", func() {
+	It("should report no drift for identical objects", func() {
+		fields, err := driftedFields(makeNetpol(), makeNetpol())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(BeEmpty())
+	})
+
+	It("should ignore server-managed metadata", func() {
+		existing := makeNetpol()
+		existing.ResourceVersion = "42"
+		existing.UID = "some-uid"
+		existing.Generation = 3
+		existing.CreationTimestamp = meta_v1.Now()
+		existing.ManagedFields = []meta_v1.ManagedFieldsEntry{{Manager: "kubectl"}}
+
+		fields, err := driftedFields(makeNetpol(), existing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(BeEmpty())
+	})
+
+	It("should ignore labels and annotations added by others", func() {
+		existing := makeNetpol()
+		existing.Labels["team"] = "other"
+		existing.Annotations["other-controller/owner"] = "someone"
+
+		fields, err := driftedFields(makeNetpol(), existing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(BeEmpty())
+	})
+
+	It("should report changed and missing labels and annotations", func() {
+		existing := makeNetpol()
+		existing.Labels["postgres.data.nais.io/name"] = "changed"
+		delete(existing.Annotations, "nais.io/deploymentCorrelationID")
+
+		fields, err := driftedFields(makeNetpol(), existing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(Equal([]string{
+			"metadata.annotations[nais.io/deploymentCorrelationID]",
+			"metadata.labels[postgres.data.nais.io/name]",
+		}))
+	})
+
+	It("should report changed spec fields by path", func() {
+		existing := makeNetpol()
+		existing.Spec.PodSelector.MatchLabels["cluster-name"] = "other"
+		existing.Spec.PolicyTypes = append(existing.Spec.PolicyTypes, networking_v1.PolicyTypeEgress)
+
+		fields, err := driftedFields(makeNetpol(), existing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(Equal([]string{
+			"spec.podSelector.matchLabels.cluster-name",
+			"spec.policyTypes",
+		}))
+	})
+
+	It("should ignore fields only set on the existing object", func() {
+		tcp := core_v1.ProtocolTCP
+		desired := makeNetpol()
+		desired.Spec.Ingress = []networking_v1.NetworkPolicyIngressRule{{Ports: []networking_v1.NetworkPolicyPort{{}}}}
+		existing := makeNetpol()
+		existing.Spec.Ingress = []networking_v1.NetworkPolicyIngressRule{{Ports: []networking_v1.NetworkPolicyPort{{Protocol: &tcp}}}}
+
+		fields, err := driftedFields(desired, existing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(BeEmpty())
+	})
+
+	It("should report fields set on the last update that are no longer desired", func() {
+		existing := &acid_zalan_do_v1.Postgresql{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "app", Namespace: "pg-team"},
+			Spec: acid_zalan_do_v1.PostgresSpec{
+				PreparedDatabases: map[string]acid_zalan_do_v1.PreparedDatabase{
+					"app":       {DefaultUsers: true},
+					"reporting": {},
+				},
+				EnableReplicaConnectionPooler: ptr.To(true),
+				Clone:                         &acid_zalan_do_v1.CloneDescription{ClusterName: "source"},
+			},
+		}
+		Expect(setManagedFields(existing)).To(Succeed())
+		desired := &acid_zalan_do_v1.Postgresql{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "app", Namespace: "pg-team"},
+			Spec: acid_zalan_do_v1.PostgresSpec{
+				PreparedDatabases: map[string]acid_zalan_do_v1.PreparedDatabase{
+					"app": {DefaultUsers: true},
+				},
+			},
+		}
+		Expect(setManagedFields(desired)).To(Succeed())
+
+		changes, err := driftedChanges(desired, existing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(
+			FieldChange{Path: "spec.clone.cluster", Old: "source"},
+			FieldChange{Path: "spec.enableReplicaConnectionPooler", Old: true},
+			FieldChange{Path: "spec.preparedDatabases.reporting", Old: map[string]any{}},
+		))
+	})
+
+	It("should report objects that do not record what was set on them", func() {
+		desired := makeNetpol()
+		Expect(setManagedFields(desired)).To(Succeed())
+
+		fields, err := driftedFields(desired, makeNetpol())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(Equal([]string{"metadata.annotations[nais.io/managed-fields]"}))
+	})
+
+	It("should treat nil and empty collections as equal", func() {
+		desired := makeNetpol()
+		desired.Spec.Ingress = []networking_v1.NetworkPolicyIngressRule{}
+
+		fields, err := driftedFields(desired, makeNetpol())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(BeEmpty())
+	})
+})
+
+var _ = Describe("driftCondition", func() {
+	It("should be false when nothing drifted", func() {
+		condition := driftCondition(makeNetpol(), nil)
+		Expect(condition.Type).To(Equal("networkpolicy.networking.k8s.io/Drifted"))
+		Expect(condition.Status).To(Equal(meta_v1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("InSync"))
+	})
+
+	It("should list drifted fields, truncating long lists", func() {
+		fields := make([]string, 0)
+		for _, f := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+			fields = append(fields, "spec."+f)
+		}
+		condition := driftCondition(makeNetpol(), fields)
+		Expect(condition.Status).To(Equal(meta_v1.ConditionTrue))
+		Expect(condition.Reason).To(Equal("Drifted"))
+		Expect(condition.Message).To(HavePrefix("Drifted fields: spec.a, spec.b"))
+		Expect(condition.Message).To(HaveSuffix("spec.j and 2 more"))
+	})
+})
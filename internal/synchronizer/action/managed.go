@@ -0,0 +1,114 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// managedFieldsAnnotation records what we set on an object on the last update. Fields only set on the existing object
+// are otherwise taken to be defaults or set by others, so without it a field we no longer set would never be drift.
+const managedFieldsAnnotation = "nais.io/managed-fields"
+
+type managedFields struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+	// Fields are the paths of the values set, each path as its segments since map keys may contain dots.
+	// Lists are values of their own, as they are replaced as a whole.
+	Fields [][]string `json:"fields,omitempty"`
+}
+
+// setManagedFields records the label and annotation keys, and the paths of the fields set in obj, in the managed
+// fields annotation
+func setManagedFields(obj client.Object) error {
+	annotations := obj.GetAnnotations()
+	delete(annotations, managedFieldsAnnotation)
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	for _, ignored := range ignoredFields {
+		delete(content, ignored)
+	}
+
+	managed := managedFields{
+		Labels:      slices.Sorted(maps.Keys(obj.GetLabels())),
+		Annotations: slices.Sorted(maps.Keys(annotations)),
+		Fields:      fieldPaths(nil, content),
+	}
+	data, err := json.Marshal(managed)
+	if err != nil {
+		return err
+	}
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[managedFieldsAnnotation] = string(data)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// getManagedFields returns what we set on obj on the last update. Objects last updated before this was recorded have
+// nothing recorded, and keep all their labels and annotations.
+func getManagedFields(obj meta_v1.Object) (managedFields, error) {
+	var managed managedFields
+	data, ok := obj.GetAnnotations()[managedFieldsAnnotation]
+	if !ok {
+		return managed, nil
+	}
+	if err := json.Unmarshal([]byte(data), &managed); err != nil {
+		return managed, fmt.Errorf("parsing %s annotation: %w", managedFieldsAnnotation, err)
+	}
+	return managed, nil
+}
+
+// fieldPaths returns the paths of all values set in content, sorted. Empty objects are values of their own, since
+// an empty entry in a map may mean something, like a database with default settings.
+func fieldPaths(path []string, content any) [][]string {
+	if content == nil {
+		return nil
+	}
+	object, ok := content.(map[string]any)
+	if !ok || len(object) == 0 {
+		return [][]string{path}
+	}
+	paths := make([][]string, 0, len(object))
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		paths = append(paths, fieldPaths(append(slices.Clip(path), key), object[key])...)
+	}
+	return paths
+}
+
+// lookupField returns the value at path in content, or nil if it is not set
+func lookupField(content map[string]any, path []string) any {
+	var current any = content
+	for _, key := range path {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = object[key]
+	}
+	return current
+}
+
+// removedFields returns the fields set on the last update that are no longer set in desired, but still on existing
+func removedFields(managed [][]string, desired, existing map[string]any) []FieldChange {
+	changes := make([]FieldChange, 0)
+	for _, path := range managed {
+		if lookupField(desired, path) != nil {
+			continue
+		}
+		if existingValue := lookupField(existing, path); existingValue != nil {
+			changes = append(changes, FieldChange{Path: strings.Join(path, "."), Old: existingValue})
+		}
+	}
+	return changes
+}
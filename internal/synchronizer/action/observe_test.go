@@ -0,0 +1,60 @@
+package action
+
+import (
+	"context"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Observe", func() {
+	var (
+		ctx   context.Context
+		c     client.Client
+		owner *data_nais_io_v1.Postgres
+	)
+
+	// existsGetter reports whether the observed object exists, and which labels it has
+	existsGetter := func(obj client.Object) []meta_v1.Condition {
+		status := meta_v1.ConditionFalse
+		if len(obj.GetResourceVersion()) > 0 {
+			status = meta_v1.ConditionTrue
+		}
+		return []meta_v1.Condition{{Type: "Exists", Status: status, Reason: "Observed", Message: obj.GetLabels()["observed"]}}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		owner = &data_nais_io_v1.Postgres{}
+	})
+
+	It("should report conditions of missing objects", func() {
+		Expect(Observe(makeNetpol(), owner, existsGetter, nil).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		condition := meta.FindStatusCondition(*owner.Status.Conditions, "Exists")
+		Expect(condition.Status).To(Equal(meta_v1.ConditionFalse))
+	})
+
+	It("should report conditions of existing objects without changing them", func() {
+		existing := makeNetpol()
+		existing.Labels = map[string]string{"observed": "yes"}
+		Expect(c.Create(ctx, existing)).To(Succeed())
+
+		Expect(Observe(makeNetpol(), owner, existsGetter, nil).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		condition := meta.FindStatusCondition(*owner.Status.Conditions, "Exists")
+		Expect(condition.Status).To(Equal(meta_v1.ConditionTrue))
+		Expect(condition.Message).To(Equal("yes"))
+
+		plan, err := Observe(makeNetpol(), owner, existsGetter, nil).Plan(ctx, c, scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Operation).To(Equal(OperationNone))
+	})
+})
@@ -0,0 +1,166 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+type Operation string
+
+const (
+	OperationNone   Operation = "None"
+	OperationCreate Operation = "Create"
+	OperationUpdate Operation = "Update"
+	OperationDelete Operation = "Delete"
+)
+
+// Plan describes what an action would do if performed
+type Plan struct {
+	Operation Operation     `json:"operation"`
+	Kind      string        `json:"kind"`
+	Namespace string        `json:"namespace"`
+	Name      string        `json:"name"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+func (p Plan) String() string {
+	s := fmt.Sprintf("%s %s %s/%s", p.Operation, p.Kind, p.Namespace, p.Name)
+	if len(p.Changes) > 0 {
+		changes := make([]string, 0, len(p.Changes))
+		for _, change := range p.Changes {
+			changes = append(changes, change.String())
+		}
+		s = fmt.Sprintf("%s: %s", s, describeFields(changes))
+	}
+	return s
+}
+
+func newPlan(operation Operation, obj client.Object, changes []FieldChange) Plan {
+	return Plan{
+		Operation: operation,
+		Kind:      obj.GetObjectKind().GroupVersionKind().Kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Changes:   changes,
+	}
+}
+
+// getExisting fetches the current version of obj, returning nil if it does not exist
+func getExisting(ctx context.Context, c client.Client, scheme *runtime.Scheme, obj client.Object) (client.Object, error) {
+	// Objects taken from lists have no type information
+	if obj.GetObjectKind().GroupVersionKind().Empty() {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			return nil, fmt.Errorf("internal error: %w", err)
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+	}
+
+	existing, err := scheme.New(obj.GetObjectKind().GroupVersionKind())
+	if err != nil {
+		return nil, fmt.Errorf("internal error: %w", err)
+	}
+
+	if err = c.Get(ctx, client.ObjectKeyFromObject(obj), existing.(client.Object)); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return existing.(client.Object), nil
+}
+
+func planCreateOrUpdate(ctx context.Context, c client.Client, scheme *runtime.Scheme, obj client.Object) (Plan, error) {
+	existing, err := getExisting(ctx, c, scheme, obj)
+	if err != nil {
+		return Plan{}, err
+	}
+	if existing == nil {
+		return newPlan(OperationCreate, obj, nil), nil
+	}
+
+	changes, err := driftedChanges(obj, existing)
+	if err != nil {
+		return Plan{}, fmt.Errorf("detecting drift: %w", err)
+	}
+	if len(changes) == 0 {
+		return newPlan(OperationNone, obj, nil), nil
+	}
+	return newPlan(OperationUpdate, obj, changes), nil
+}
+
+func (a *createIfNotExists) Plan(ctx context.Context, c client.Client, scheme *runtime.Scheme) (Plan, error) {
+	existing, err := getExisting(ctx, c, scheme, a.obj)
+	if err != nil {
+		return Plan{}, err
+	}
+	if existing == nil {
+		return newPlan(OperationCreate, a.obj, nil), nil
+	}
+	return newPlan(OperationNone, a.obj, nil), nil
+}
+
+func (a *createOrUpdate) Plan(ctx context.Context, c client.Client, scheme *runtime.Scheme) (Plan, error) {
+	if err := setManagedFields(a.obj); err != nil {
+		return Plan{}, fmt.Errorf("recording managed fields: %w", err)
+	}
+	return planCreateOrUpdate(ctx, c, scheme, a.obj)
+}
+
+func (a *apply) Plan(ctx context.Context, c client.Client, scheme *runtime.Scheme) (Plan, error) {
+	return planCreateOrUpdate(ctx, c, scheme, a.obj)
+}
+
+func (a *deleteIfExists) Plan(ctx context.Context, c client.Client, scheme *runtime.Scheme) (Plan, error) {
+	existing, err := getExisting(ctx, c, scheme, a.obj)
+	if err != nil {
+		return Plan{}, err
+	}
+	if existing == nil {
+		return newPlan(OperationNone, a.obj, nil), nil
+	}
+	return newPlan(OperationDelete, a.obj, nil), nil
+}
+
+func (a *patch) Plan(ctx context.Context, c client.Client, scheme *runtime.Scheme) (Plan, error) {
+	existing, err := getExisting(ctx, c, scheme, a.obj)
+	if err != nil {
+		return Plan{}, err
+	}
+	if existing == nil {
+		return Plan{}, fmt.Errorf("%s %s/%s to patch does not exist", a.obj.GetObjectKind().GroupVersionKind().Kind, a.obj.GetNamespace(), a.obj.GetName())
+	}
+
+	// Only the fields set are patched, which are exactly those compared
+	changes, err := driftedChanges(a.obj, existing)
+	if err != nil {
+		return Plan{}, fmt.Errorf("detecting drift: %w", err)
+	}
+	if len(changes) == 0 {
+		return newPlan(OperationNone, a.obj, nil), nil
+	}
+	return newPlan(OperationUpdate, a.obj, changes), nil
+}
+
+func (o *observe) Plan(_ context.Context, _ client.Client, _ *runtime.Scheme) (Plan, error) {
+	return newPlan(OperationNone, o.obj, nil), nil
+}
+
+func (n *noOp) Plan(_ context.Context, _ client.Client, _ *runtime.Scheme) (Plan, error) {
+	return newPlan(OperationNone, n.obj, nil), nil
+}
+
+// RenderPlans renders plans as a human-readable report, one action per line
+func RenderPlans(plans []Plan) string {
+	lines := make([]string, 0, len(plans))
+	for _, p := range plans {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,99 @@
+package action
+
+import (
+	"context"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/synchronizer/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Plan", func() {
+	var (
+		ctx      context.Context
+		c        client.Client
+		owner    *data_nais_io_v1.Postgres
+		recorder events.Recorder
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		owner = &data_nais_io_v1.Postgres{}
+		recorder = events.NewRecorder(nil)
+	})
+
+	It("should plan creation of missing objects", func() {
+		plan, err := CreateOrUpdate(makeNetpol(), owner, nil, nil).Plan(ctx, c, scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Operation).To(Equal(OperationCreate))
+		Expect(plan.String()).To(Equal("Create NetworkPolicy pg-test/test"))
+	})
+
+	It("should plan updates with the old and new values of drifted fields", func() {
+		existing := makeNetpol()
+		existing.Spec.PodSelector.MatchLabels["cluster-name"] = "other"
+		Expect(CreateOrUpdate(existing, owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		plan, err := CreateOrUpdate(makeNetpol(), owner, nil, nil).Plan(ctx, c, scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Operation).To(Equal(OperationUpdate))
+		Expect(plan.Changes).To(Equal([]FieldChange{{Path: "spec.podSelector.matchLabels.cluster-name", Old: "other", New: "test"}}))
+		Expect(plan.String()).To(Equal(`Update NetworkPolicy pg-test/test: spec.podSelector.matchLabels.cluster-name: "other" -> "test"`))
+	})
+
+	It("should not reveal secret data in plans", func() {
+		secret := func(password string) *core_v1.Secret {
+			return &core_v1.Secret{
+				TypeMeta:   meta_v1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+				ObjectMeta: meta_v1.ObjectMeta{Name: "credentials", Namespace: "test"},
+				Data:       map[string][]byte{"password": []byte(password)},
+			}
+		}
+		Expect(CreateOrUpdate(secret("old"), owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		plan, err := CreateOrUpdate(secret("new"), owner, nil, nil).Plan(ctx, c, scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Changes).To(Equal([]FieldChange{{Path: "data.password", Old: redactedValue, New: redactedValue}}))
+		Expect(plan.String()).NotTo(ContainSubstring("old"))
+	})
+
+	It("should plan patches with the fields set", func() {
+		Expect(c.Create(ctx, makeNetpol())).To(Succeed())
+
+		patched := makeNetpol()
+		patched.Spec = networking_v1.NetworkPolicySpec{}
+		patched.Labels = map[string]string{"rotated": "yes"}
+		patched.Annotations = nil
+		plan, err := Patch(patched, owner, nil, nil).Plan(ctx, c, scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Operation).To(Equal(OperationUpdate))
+		Expect(plan.Changes).To(Equal([]FieldChange{{Path: "metadata.labels[rotated]", New: "yes"}}))
+	})
+
+	It("should plan nothing for objects in sync", func() {
+		Expect(CreateOrUpdate(makeNetpol(), owner, noConditions, recorder).Do(ctx, c, scheme.Scheme)).To(Succeed())
+
+		plan, err := CreateOrUpdate(makeNetpol(), owner, nil, nil).Plan(ctx, c, scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Operation).To(Equal(OperationNone))
+	})
+
+	It("should only plan deletion of existing objects", func() {
+		plan, err := DeleteIfExists(makeNetpol(), owner, nil, nil).Plan(ctx, c, scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Operation).To(Equal(OperationNone))
+
+		Expect(c.Create(ctx, makeNetpol())).To(Succeed())
+		plan, err = DeleteIfExists(makeNetpol(), owner, nil, nil).Plan(ctx, c, scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Operation).To(Equal(OperationDelete))
+	})
+})
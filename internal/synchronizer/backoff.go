@@ -0,0 +1,158 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+)
+
+type errorClass string
+
+const (
+	errorClassConflict   errorClass = "Conflict"
+	errorClassTransient  errorClass = "Transient"
+	errorClassMissingCRD errorClass = "MissingCRD"
+	errorClassPermanent  errorClass = "Permanent"
+)
+
+// degraded returns true for errors that will not go away by retrying, and need someone to fix something
+func (c errorClass) degraded() bool {
+	return c == errorClassMissingCRD || c == errorClassPermanent
+}
+
+// terminal returns true for errors that retrying will not fix, which are instead retried when the object changes
+func (c errorClass) terminal() bool {
+	return c == errorClassPermanent
+}
+
+type backoffPolicy struct {
+	base time.Duration
+	max  time.Duration
+}
+
+// missingCRDBackoff is how missing CRDs are retried. Their installation does not trigger a reconcile, and they are
+// slow to appear, so they are retried on a delay of their own instead of by the rate limiter of the controller.
+var missingCRDBackoff = backoffPolicy{base: 30 * time.Second, max: 15 * time.Minute}
+
+// errorClassPriority orders the classes by how soon they are retried
+var errorClassPriority = []errorClass{errorClassConflict, errorClassTransient, errorClassMissingCRD, errorClassPermanent}
+
+// classifyError decides how a failed reconcile should be retried.
+// Several errors may be joined together, in which case the class retried the soonest wins,
+// since there is no point in waiting for the permanent errors when others may be resolved by a retry.
+func classifyError(err error) errorClass {
+	best := len(errorClassPriority) - 1
+	for _, leaf := range leafErrors(err) {
+		best = min(best, slices.Index(errorClassPriority, classifySingleError(leaf)))
+	}
+	return errorClassPriority[best]
+}
+
+// leafErrors splits joined errors into their parts, keeping the context of single wrapped errors
+func leafErrors(err error) []error {
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		leaves := make([]error, 0)
+		for _, inner := range e.Unwrap() {
+			leaves = append(leaves, leafErrors(inner)...)
+		}
+		return leaves
+	case interface{ Unwrap() error }:
+		if inner := e.Unwrap(); inner != nil {
+			if leaves := leafErrors(inner); len(leaves) > 1 {
+				return leaves
+			}
+		}
+	}
+	return []error{err}
+}
+
+func classifySingleError(err error) errorClass {
+	switch {
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		return errorClassConflict
+	case isTransient(err):
+		return errorClassTransient
+	case meta.IsNoMatchError(err), discovery.IsGroupDiscoveryFailedError(err), runtime.IsNotRegisteredError(err):
+		return errorClassMissingCRD
+	case apierrors.IsInvalid(err),
+		apierrors.IsBadRequest(err),
+		apierrors.IsForbidden(err),
+		apierrors.IsUnauthorized(err),
+		apierrors.IsMethodNotSupported(err),
+		apierrors.IsNotAcceptable(err),
+		apierrors.IsUnsupportedMediaType(err),
+		apierrors.IsRequestEntityTooLargeError(err),
+		errors.Is(err, errDependencyCycle),
+		errors.Is(err, reconciler.ErrInvalid):
+		return errorClassPermanent
+	default:
+		// Errors we know nothing about are retried, but never faster than transient errors
+		return errorClassTransient
+	}
+}
+
+func isTransient(err error) bool {
+	var netErr net.Error
+	return apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsUnexpectedServerError(err) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr)
+}
+
+// requeueBackoff tracks consecutive failures for each object, and computes when to retry
+type requeueBackoff struct {
+	lock     sync.Mutex
+	policy   backoffPolicy
+	failures map[types.NamespacedName]int
+	jitter   func() float64
+}
+
+func newRequeueBackoff(policy backoffPolicy) *requeueBackoff {
+	return &requeueBackoff{
+		policy:   policy,
+		failures: make(map[types.NamespacedName]int),
+		jitter:   rand.Float64,
+	}
+}
+
+// next registers a failure for the object, and returns how long to wait before retrying.
+// The delay doubles for each consecutive failure up to the cap of the policy, and is randomized
+// between half and all of that to avoid retrying many objects in lockstep.
+func (b *requeueBackoff) next(key types.NamespacedName) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	policy := b.policy
+	attempt := b.failures[key]
+	b.failures[key] = attempt + 1
+
+	delay := policy.base
+	for i := 0; i < attempt && delay < policy.max; i++ {
+		delay *= 2
+	}
+	delay = min(delay, policy.max)
+	return delay/2 + time.Duration(b.jitter()*float64(delay/2))
+}
+
+// reset forgets previous failures for the object
+func (b *requeueBackoff) reset(key types.NamespacedName) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.failures, key)
+}
@@ -0,0 +1,135 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/synchronizer/events"
+	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("classifyError", func() {
+	resource := schema.GroupResource{Group: "acid.zalan.do", Resource: "postgresqls"}
+
+	DescribeTable("should classify errors",
+		func(err error, expected errorClass) {
+			Expect(classifyError(err)).To(Equal(expected))
+			Expect(classifyError(fmt.Errorf("wrapped: %w", err))).To(Equal(expected))
+		},
+		Entry("conflict", apierrors.NewConflict(resource, "foo", errors.New("modified")), errorClassConflict),
+		Entry("already exists", apierrors.NewAlreadyExists(resource, "foo"), errorClassConflict),
+		Entry("too many requests", apierrors.NewTooManyRequests("slow down", 1), errorClassTransient),
+		Entry("server timeout", apierrors.NewServerTimeout(resource, "update", 1), errorClassTransient),
+		Entry("deadline exceeded", context.DeadlineExceeded, errorClassTransient),
+		Entry("unknown", errors.New("something"), errorClassTransient),
+		Entry("missing CRD", &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: "acid.zalan.do", Kind: "postgresql"}}, errorClassMissingCRD),
+		Entry("invalid", apierrors.NewInvalid(schema.GroupKind{Kind: "postgresql"}, "foo", field.ErrorList{field.Required(field.NewPath("spec"), "")}), errorClassPermanent),
+		Entry("forbidden", apierrors.NewForbidden(resource, "foo", errors.New("rbac")), errorClassPermanent),
+		Entry("dependency cycle", errDependencyCycle, errorClassPermanent),
+		Entry("invalid object", fmt.Errorf("%w: bad schedule", reconciler.ErrInvalid), errorClassPermanent),
+	)
+
+	It("should retry joined errors as soon as any of them allows", func() {
+		err := errors.Join(
+			apierrors.NewForbidden(resource, "foo", errors.New("rbac")),
+			apierrors.NewTooManyRequests("slow down", 1),
+		)
+		Expect(classifyError(err)).To(Equal(errorClassTransient))
+	})
+})
+
+var _ = Describe("requeueBackoff", func() {
+	key := types.NamespacedName{Namespace: "team", Name: "app"}
+
+	It("should double the delay for each failure up to the cap", func() {
+		b := newRequeueBackoff(missingCRDBackoff)
+		b.jitter = func() float64 { return 1 }
+
+		policy := missingCRDBackoff
+		Expect(b.next(key)).To(Equal(policy.base))
+		Expect(b.next(key)).To(Equal(2 * policy.base))
+		Expect(b.next(key)).To(Equal(4 * policy.base))
+		for range 100 {
+			b.next(key)
+		}
+		Expect(b.next(key)).To(Equal(policy.max))
+	})
+
+	It("should randomize the delay between half and all of it", func() {
+		b := newRequeueBackoff(missingCRDBackoff)
+		b.jitter = func() float64 { return 0 }
+		Expect(b.next(key)).To(Equal(missingCRDBackoff.base / 2))
+	})
+
+	It("should start over after a reset", func() {
+		b := newRequeueBackoff(missingCRDBackoff)
+		b.jitter = func() float64 { return 1 }
+		b.next(key)
+		b.next(key)
+		b.reset(key)
+		Expect(b.next(key)).To(Equal(missingCRDBackoff.base))
+	})
+})
+
+var _ = Describe("Reconcile errors", func() {
+	reconcileWithError := func(updateErr error) (ctrl.Result, error, *data_nais_io_v1.Postgres) {
+		owner := makeOwner(1)
+		scheme := newTestScheme()
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(owner).WithStatusSubresource(owner).Build()
+		s := NewSynchronizer(c, scheme, &testReconciler{updateErr: updateErr}, events.NewRecorder(record.NewFakeRecorder(100)))
+
+		result, err := s.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(owner)})
+
+		updated := &data_nais_io_v1.Postgres{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(owner), updated)).To(Succeed())
+		return result, err, updated
+	}
+
+	It("should not retry permanent errors, and report the resource as degraded", func() {
+		result, err, updated := reconcileWithError(apierrors.NewForbidden(schema.GroupResource{Resource: "postgresqls"}, "foo", errors.New("rbac")))
+
+		Expect(err).To(MatchError(reconcile.TerminalError(nil)))
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+		Expect(result).To(BeZero())
+
+		degraded := meta.FindStatusCondition(*updated.Status.Conditions, "test.nais.io/Degraded")
+		Expect(degraded).NotTo(BeNil())
+		Expect(degraded.Status).To(BeEquivalentTo("True"))
+		Expect(degraded.Reason).To(Equal(string(errorClassPermanent)))
+	})
+
+	It("should leave transient errors to the controller without reporting the resource as degraded", func() {
+		result, err, updated := reconcileWithError(apierrors.NewTooManyRequests("slow down", 1))
+
+		Expect(apierrors.IsTooManyRequests(err)).To(BeTrue())
+		Expect(err).NotTo(MatchError(reconcile.TerminalError(nil)))
+		Expect(result).To(BeZero())
+
+		degraded := meta.FindStatusCondition(*updated.Status.Conditions, "test.nais.io/Degraded")
+		Expect(degraded).NotTo(BeNil())
+		Expect(degraded.Status).To(BeEquivalentTo("False"))
+		Expect(degraded.Reason).To(Equal(string(errorClassTransient)))
+	})
+
+	It("should retry missing CRDs on a delay of their own", func() {
+		result, err, _ := reconcileWithError(&meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: "acid.zalan.do", Kind: "postgresql"}})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">=", missingCRDBackoff.base/2))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", missingCRDBackoff.base))
+	})
+})
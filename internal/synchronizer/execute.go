@@ -0,0 +1,199 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nais/pgrator/internal/synchronizer/action"
+	"github.com/nais/pgrator/internal/synchronizer/object"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+var (
+	errDependencyFailed = errors.New("dependency failed")
+	errDependencyCycle  = errors.New("dependency cycle detected")
+)
+
+// executeActions performs actions concurrently, with at most maxParallelActions running at the same time.
+// An action is only performed after all its dependencies have succeeded.
+// All errors are collected and returned joined together.
+func (s *Synchronizer[T, P]) executeActions(ctx context.Context, actions []action.Action) error {
+	if err := checkDependencyCycles(actions); err != nil {
+		return err
+	}
+
+	type result struct {
+		done chan struct{}
+		err  error
+	}
+	results := make(map[action.Action]*result, len(actions))
+	for _, a := range actions {
+		results[a] = &result{done: make(chan struct{})}
+	}
+
+	semaphore := make(chan struct{}, max(s.maxParallelActions, 1))
+	var wg sync.WaitGroup
+	for _, a := range actions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := results[a]
+			defer close(r.done)
+
+			kind := s.kindOf(a.GetObject())
+			for _, dependency := range a.Dependencies() {
+				// Dependencies that are not part of this run are considered satisfied
+				if dr, ok := results[dependency]; ok {
+					<-dr.done
+					if dr.err != nil {
+						r.err = fmt.Errorf("%s: %w", s.describeAction(a), errDependencyFailed)
+						actionsTotal.WithLabelValues(a.Type(), kind, outcomeDependencyFailed).Inc()
+						return
+					}
+				}
+			}
+
+			// The span only covers performing the action, the time spent waiting for a free slot is recorded on it
+			waitStart := time.Now()
+			semaphore <- struct{}{}
+			actionCtx, span := s.tracer.Start(ctx, "Action", trace.WithAttributes(
+				attribute.String("action", a.Type()),
+				attribute.String("kind", kind),
+				attribute.String("k8s.namespace.name", a.GetObject().GetNamespace()),
+				attribute.String("name", a.GetObject().GetName()),
+				attribute.Float64("wait_seconds", time.Since(waitStart).Seconds()),
+			))
+			err := a.Do(actionCtx, s.client, s.scheme)
+			endSpan(span, err)
+			<-semaphore
+
+			outcome := outcomeSuccess
+			if err != nil {
+				r.err = fmt.Errorf("%s: %w", s.describeAction(a), err)
+				outcome = outcomeFailure
+			}
+			actionsTotal.WithLabelValues(a.Type(), kind, outcome).Inc()
+		}()
+	}
+	wg.Wait()
+
+	errs := make([]error, 0)
+	for _, a := range actions {
+		errs = append(errs, results[a].err)
+	}
+	s.setActionConditions(actions, errs)
+	return errors.Join(errs...)
+}
+
+// setActionConditions records the outcome of actions as one condition per kind on their owner, with errs holding the
+// error of each action in the same order. Actions of the same kind would otherwise overwrite each other's condition.
+func (s *Synchronizer[T, P]) setActionConditions(actions []action.Action, errs []error) {
+	type outcome struct {
+		owner     object.NaisObject
+		succeeded []string
+		failures  []string
+		failed    bool
+	}
+	prefixes := make([]string, 0)
+	outcomes := make(map[string]*outcome)
+	for i, a := range actions {
+		prefix := s.typePrefix(a.GetObject())
+		o, ok := outcomes[prefix]
+		if !ok {
+			o = &outcome{owner: a.GetOwner()}
+			outcomes[prefix] = o
+			prefixes = append(prefixes, prefix)
+		}
+		// The errors are already prefixed with a description of their action
+		if err := errs[i]; err != nil {
+			o.failures = append(o.failures, err.Error())
+			o.failed = o.failed || !errors.Is(err, errDependencyFailed)
+		} else {
+			o.succeeded = append(o.succeeded, s.describeAction(a))
+		}
+	}
+
+	for _, prefix := range prefixes {
+		o := outcomes[prefix]
+		condition := meta_v1.Condition{
+			Type:               fmt.Sprintf("%s/ActionSucceeded", prefix),
+			Status:             meta_v1.ConditionTrue,
+			ObservedGeneration: o.owner.GetGeneration(),
+			Reason:             "Succeeded",
+			Message:            truncateMessage(fmt.Sprintf("%s succeeded", strings.Join(o.succeeded, ", "))),
+		}
+		if len(o.failures) > 0 {
+			condition.Status = meta_v1.ConditionFalse
+			condition.Reason = "DependencyFailed"
+			if o.failed {
+				condition.Reason = "Failed"
+			}
+			condition.Message = truncateMessage(strings.Join(o.failures, "; "))
+		}
+		action.SetConditions(o.owner, condition)
+	}
+}
+
+func (s *Synchronizer[T, P]) gvkOf(obj client.Object) schema.GroupVersionKind {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Empty() {
+		gvk, _ = apiutil.GVKForObject(obj, s.scheme)
+	}
+	return gvk
+}
+
+func (s *Synchronizer[T, P]) typePrefix(obj client.Object) string {
+	return strings.ToLower(s.gvkOf(obj).GroupKind().String())
+}
+
+func (s *Synchronizer[T, P]) kindOf(obj client.Object) string {
+	return s.gvkOf(obj).Kind
+}
+
+func (s *Synchronizer[T, P]) describeAction(a action.Action) string {
+	obj := a.GetObject()
+	return fmt.Sprintf("%s %s/%s", s.kindOf(obj), obj.GetNamespace(), obj.GetName())
+}
+
+// checkDependencyCycles returns an error if the dependencies between actions form a cycle, which would never complete
+func checkDependencyCycles(actions []action.Action) error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[action.Action]int, len(actions))
+
+	var visit func(a action.Action) error
+	visit = func(a action.Action) error {
+		switch state[a] {
+		case visiting:
+			return fmt.Errorf("%w involving %s/%s", errDependencyCycle, a.GetObject().GetNamespace(), a.GetObject().GetName())
+		case visited:
+			return nil
+		}
+		state[a] = visiting
+		for _, dependency := range a.Dependencies() {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		state[a] = visited
+		return nil
+	}
+
+	for _, a := range actions {
+		if err := visit(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/synchronizer/action"
+	"github.com/nais/pgrator/internal/synchronizer/object"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// testAction records when it is performed, and fails if err is set
+type testAction struct {
+	obj          client.Object
+	owner        object.NaisObject
+	dependencies []action.Action
+	err          error
+	delay        time.Duration
+
+	running    *atomic.Int32
+	maxRunning *atomic.Int32
+	log        *[]string
+	logLock    *sync.Mutex
+}
+
+func (a *testAction) Do(_ context.Context, _ client.Client, _ *runtime.Scheme) error {
+	running := a.running.Add(1)
+	for {
+		current := a.maxRunning.Load()
+		if running <= current || a.maxRunning.CompareAndSwap(current, running) {
+			break
+		}
+	}
+	time.Sleep(a.delay)
+	a.running.Add(-1)
+
+	a.logLock.Lock()
+	*a.log = append(*a.log, a.obj.GetName())
+	a.logLock.Unlock()
+	return a.err
+}
+
+func (a *testAction) Plan(_ context.Context, _ client.Client, _ *runtime.Scheme) (action.Plan, error) {
+	return action.Plan{}, nil
+}
+
+func (a *testAction) Type() string {
+	return "Test"
+}
+
+func (a *testAction) Owned() bool {
+	return true
+}
+
+func (a *testAction) GetObject() client.Object {
+	return a.obj
+}
+
+func (a *testAction) GetOwner() object.NaisObject {
+	return a.owner
+}
+
+func (a *testAction) DependsOn(dependencies ...action.Action) {
+	a.dependencies = append(a.dependencies, dependencies...)
+}
+
+func (a *testAction) Dependencies() []action.Action {
+	return a.dependencies
+}
+
+var _ = Describe("executeActions", func() {
+	var (
+		ctx        context.Context
+		s          *Synchronizer[*data_nais_io_v1.Postgres, struct{}]
+		owner      *data_nais_io_v1.Postgres
+		running    *atomic.Int32
+		maxRunning *atomic.Int32
+		log        *[]string
+		logLock    *sync.Mutex
+	)
+
+	newAction := func(name string, err error) *testAction {
+		return &testAction{
+			obj:        &networking_v1.NetworkPolicy{ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: "pg-team"}},
+			owner:      owner,
+			err:        err,
+			delay:      10 * time.Millisecond,
+			running:    running,
+			maxRunning: maxRunning,
+			log:        log,
+			logLock:    logLock,
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		s = newTestSynchronizer(0, false)
+		owner = makeOwner(1)
+		running = &atomic.Int32{}
+		maxRunning = &atomic.Int32{}
+		log = &[]string{}
+		logLock = &sync.Mutex{}
+	})
+
+	It("should perform actions after their dependencies", func() {
+		first := newAction("first", nil)
+		second := newAction("second", nil)
+		third := newAction("third", nil)
+		third.DependsOn(second)
+		second.DependsOn(first)
+
+		err := s.executeActions(ctx, []action.Action{third, second, first})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*log).To(Equal([]string{"first", "second", "third"}))
+		Expect(*owner.GetStatus().Conditions).To(ContainElement(And(
+			HaveField("Type", "networkpolicy.networking.k8s.io/ActionSucceeded"),
+			HaveField("Reason", "Succeeded"),
+		)))
+	})
+
+	It("should limit the number of concurrent actions", func() {
+		s.maxParallelActions = 2
+		actions := make([]action.Action, 0)
+		for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+			actions = append(actions, newAction(name, nil))
+		}
+
+		Expect(s.executeActions(ctx, actions)).To(Succeed())
+		Expect(*log).To(HaveLen(6))
+		Expect(maxRunning.Load()).To(BeNumerically("<=", 2))
+		Expect(maxRunning.Load()).To(BeNumerically(">", 1))
+	})
+
+	It("should perform independent actions and collect all errors", func() {
+		errA := errors.New("a failed")
+		errB := errors.New("b failed")
+		a := newAction("a", errA)
+		b := newAction("b", errB)
+		c := newAction("c", nil)
+		dependent := newAction("dependent", nil)
+		dependent.DependsOn(a)
+
+		err := s.executeActions(ctx, []action.Action{a, b, c, dependent})
+		Expect(err).To(MatchError(errA))
+		Expect(err).To(MatchError(errB))
+		Expect(err).To(MatchError(errDependencyFailed))
+		Expect(*log).To(ConsistOf("a", "b", "c"))
+		Expect(*owner.GetStatus().Conditions).To(ConsistOf(And(
+			HaveField("Type", "networkpolicy.networking.k8s.io/ActionSucceeded"),
+			HaveField("Status", meta_v1.ConditionFalse),
+			HaveField("Reason", "Failed"),
+			HaveField("Message", And(
+				ContainSubstring("pg-team/a: a failed"),
+				ContainSubstring("pg-team/b: b failed"),
+				ContainSubstring("pg-team/dependent: dependency failed"),
+			)),
+		)))
+	})
+
+	It("should report kinds where only dependencies failed", func() {
+		a := newAction("a", errors.New("a failed"))
+		dependent := newAction("dependent", nil)
+		dependent.obj = &core_v1.ConfigMap{ObjectMeta: meta_v1.ObjectMeta{Name: "dependent", Namespace: "pg-team"}}
+		dependent.DependsOn(a)
+
+		Expect(s.executeActions(ctx, []action.Action{a, dependent})).NotTo(Succeed())
+		Expect(*owner.GetStatus().Conditions).To(ContainElement(And(
+			HaveField("Type", "configmap/ActionSucceeded"),
+			HaveField("Status", meta_v1.ConditionFalse),
+			HaveField("Reason", "DependencyFailed"),
+		)))
+	})
+
+	It("should refuse dependency cycles", func() {
+		a := newAction("a", nil)
+		b := newAction("b", nil)
+		a.DependsOn(b)
+		b.DependsOn(a)
+
+		err := s.executeActions(ctx, []action.Action{a, b})
+		Expect(err).To(MatchError(ContainSubstring("dependency cycle")))
+		Expect(*log).To(BeEmpty())
+	})
+})
@@ -0,0 +1,133 @@
+package synchronizer
+
+import (
+	"context"
+	"time"
+
+	"github.com/nais/pgrator/internal/synchronizer/action"
+	"github.com/nais/pgrator/internal/synchronizer/object"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	outcomeSuccess          = "success"
+	outcomeFailure          = "failure"
+	outcomeDependencyFailed = "dependency_failed"
+)
+
+var (
+	phaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pgrator_reconcile_phase_duration_seconds",
+		Help:    "Time spent in each phase of a reconcile",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"phase"})
+
+	actionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pgrator_actions_total",
+		Help: "Actions performed, by action type, target kind and outcome",
+	}, []string{"action", "kind", "outcome"})
+
+	reconcileErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pgrator_reconcile_errors_total",
+		Help: "Failed reconciles, by the class of error deciding when to retry",
+	}, []string{"class"})
+
+	unreferencedDeletedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pgrator_unreferenced_resources_deleted_total",
+		Help: "Resources no longer referenced by their owner, deleted",
+	}, []string{"kind"})
+
+	unreferencedResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pgrator_unreferenced_resources",
+		Help: "Resources no longer referenced by their owner and not yet deleted, by namespace and name of the owner",
+	}, []string{"namespace", "name", "kind"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(phaseDuration, actionsTotal, reconcileErrorsTotal, unreferencedDeletedTotal, unreferencedResources)
+}
+
+// setUnreferenced replaces the number of unreferenced resources of owner with the resources found
+func setUnreferenced(owner client.Object, kinds []string) {
+	unreferencedResources.DeletePartialMatch(prometheus.Labels{"namespace": owner.GetNamespace(), "name": owner.GetName()})
+	for _, kind := range kinds {
+		unreferencedResources.WithLabelValues(owner.GetNamespace(), owner.GetName(), kind).Inc()
+	}
+}
+
+// unreferencedDeletion deletes a resource no longer referenced by its owner, counting it once it is actually deleted
+type unreferencedDeletion struct {
+	action.Action
+	kind string
+}
+
+func (u *unreferencedDeletion) Do(ctx context.Context, c client.Client, scheme *runtime.Scheme) error {
+	if err := u.Action.Do(ctx, c, scheme); err != nil {
+		return err
+	}
+	owner := u.GetOwner()
+	unreferencedDeletedTotal.WithLabelValues(u.kind).Inc()
+	unreferencedResources.WithLabelValues(owner.GetNamespace(), owner.GetName(), u.kind).Dec()
+	return nil
+}
+
+func observePhases(phases *reconcilePhases) {
+	for _, t := range phases.transitions {
+		phaseDuration.WithLabelValues(t.Phase).Observe(t.Duration.Seconds())
+	}
+}
+
+// phaseCollector reports the number of reconciled objects in each reconcile phase, as seen by the (cached) client
+type phaseCollector struct {
+	client  client.Reader
+	newList func() client.ObjectList
+	desc    *prometheus.Desc
+}
+
+func newPhaseCollector(c client.Reader, newList func() client.ObjectList) *phaseCollector {
+	return &phaseCollector{
+		client:  c,
+		newList: newList,
+		desc: prometheus.NewDesc(
+			"pgrator_resources",
+			"Number of reconciled resources in each reconcile phase",
+			[]string{"phase"},
+			nil,
+		),
+	}
+}
+
+func (c *phaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *phaseCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	list := c.newList()
+	if err := c.client.List(ctx, list); err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+
+	counts := make(map[string]int)
+	err := meta.EachListItem(list, func(obj runtime.Object) error {
+		if naisObject, ok := obj.(object.NaisObject); ok {
+			counts[naisObject.GetStatus().ReconcilePhase]++
+		}
+		return nil
+	})
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+
+	for phase, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), phase)
+	}
+}
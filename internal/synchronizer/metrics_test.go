@@ -0,0 +1,105 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/synchronizer/action"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	networking_v1 "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("metrics", func() {
+	It("should count actions by type, kind and outcome", func() {
+		s := newTestSynchronizer(0, false)
+		owner := makeOwner(1)
+		newAction := func(name string, err error) *testAction {
+			return &testAction{
+				obj:        &networking_v1.NetworkPolicy{ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: "pg-team"}},
+				owner:      owner,
+				err:        err,
+				running:    &atomic.Int32{},
+				maxRunning: &atomic.Int32{},
+				log:        &[]string{},
+				logLock:    &sync.Mutex{},
+			}
+		}
+		failing := newAction("failing", errors.New("failed"))
+		dependent := newAction("dependent", nil)
+		dependent.DependsOn(failing)
+
+		success := actionsTotal.WithLabelValues("Test", "NetworkPolicy", outcomeSuccess)
+		failure := actionsTotal.WithLabelValues("Test", "NetworkPolicy", outcomeFailure)
+		dependencyFailed := actionsTotal.WithLabelValues("Test", "NetworkPolicy", outcomeDependencyFailed)
+		successBefore := testutil.ToFloat64(success)
+		failureBefore := testutil.ToFloat64(failure)
+		dependencyFailedBefore := testutil.ToFloat64(dependencyFailed)
+
+		err := s.executeActions(context.Background(), []action.Action{newAction("ok", nil), failing, dependent})
+		Expect(err).To(HaveOccurred())
+
+		Expect(testutil.ToFloat64(success) - successBefore).To(Equal(1.0))
+		Expect(testutil.ToFloat64(failure) - failureBefore).To(Equal(1.0))
+		Expect(testutil.ToFloat64(dependencyFailed) - dependencyFailedBefore).To(Equal(1.0))
+	})
+
+	It("should count unreferenced resources until they are deleted", func() {
+		s := newTestSynchronizer(10, false)
+		owner := makeOwner(3)
+		pending := func() float64 {
+			return testutil.ToFloat64(unreferencedResources.WithLabelValues(owner.GetNamespace(), owner.GetName(), "NetworkPolicy"))
+		}
+		deleted := unreferencedDeletedTotal.WithLabelValues("NetworkPolicy")
+		deletedBefore := testutil.ToFloat64(deleted)
+
+		actions, err := s.DetectUnreferenced(context.Background(), owner, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending()).To(Equal(1.0))
+		Expect(testutil.ToFloat64(deleted) - deletedBefore).To(BeZero())
+
+		Expect(s.executeActions(context.Background(), actions)).To(Succeed())
+		Expect(pending()).To(BeZero())
+		Expect(testutil.ToFloat64(deleted) - deletedBefore).To(Equal(1.0))
+	})
+
+	It("should observe the duration of each phase", func() {
+		phases := newReconcilePhases()
+		phases.enter("MetricsTestPhase")
+		phases.finish()
+
+		before := testutil.CollectAndCount(phaseDuration)
+		observePhases(phases)
+		Expect(testutil.CollectAndCount(phaseDuration)).To(Equal(before + 1))
+	})
+
+	It("should count resources in each reconcile phase", func() {
+		objects := make([]client.Object, 0)
+		for i, phase := range []string{"Completed", "Completed", "PerformingActions", ""} {
+			owner := makeOwner(i)
+			owner.Status = &data_nais_io_v1.PostgresStatus{ReconcilePhase: phase}
+			objects = append(objects, owner)
+		}
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(objects...).Build()
+		collector := newPhaseCollector(c, func() client.ObjectList {
+			return &data_nais_io_v1.PostgresList{}
+		})
+
+		expected := `
+# HELP pgrator_resources Number of reconciled resources in each reconcile phase
+# TYPE pgrator_resources gauge
+pgrator_resources{phase=""} 1
+pgrator_resources{phase="Completed"} 2
+pgrator_resources{phase="PerformingActions"} 1
+`
+		Expect(testutil.CollectAndCompare(collector, strings.NewReader(expected))).To(Succeed())
+	})
+})
@@ -0,0 +1,36 @@
+package synchronizer
+
+import "go.opentelemetry.io/otel/trace"
+
+const defaultMaxParallelActions = 4
+
+type options struct {
+	planMode           bool
+	maxParallelActions int
+	tracerProvider     trace.TracerProvider
+}
+
+type Option func(*options)
+
+// WithPlanMode makes the synchronizer report what it would do instead of performing any actions
+func WithPlanMode(enabled bool) Option {
+	return func(o *options) {
+		o.planMode = enabled
+	}
+}
+
+// WithMaxParallelActions limits how many actions are performed concurrently
+func WithMaxParallelActions(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxParallelActions = n
+		}
+	}
+}
+
+// WithTracerProvider sets the provider used to trace reconciles, instead of the global provider
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = provider
+	}
+}
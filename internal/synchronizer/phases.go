@@ -0,0 +1,65 @@
+package synchronizer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type phaseTransition struct {
+	Phase    string
+	Start    time.Time
+	Duration time.Duration
+	ended    bool
+}
+
+// reconcilePhases collects the phases of a single reconcile in memory, so that they can be written to the status once.
+// Only the phases of the last reconcile are kept, each reconcile starts over with none.
+type reconcilePhases struct {
+	transitions []phaseTransition
+	now         func() time.Time
+}
+
+func newReconcilePhases() *reconcilePhases {
+	return &reconcilePhases{
+		now: time.Now,
+	}
+}
+
+// enter ends the current phase, if any, and starts a new one
+func (h *reconcilePhases) enter(phase string) {
+	h.finish()
+	h.transitions = append(h.transitions, phaseTransition{
+		Phase: phase,
+		Start: h.now(),
+	})
+}
+
+// finish ends the current phase
+func (h *reconcilePhases) finish() {
+	if len(h.transitions) == 0 {
+		return
+	}
+	last := &h.transitions[len(h.transitions)-1]
+	if !last.ended {
+		last.Duration = h.now().Sub(last.Start)
+		last.ended = true
+	}
+}
+
+// current returns the name of the current phase
+func (h *reconcilePhases) current() string {
+	if len(h.transitions) == 0 {
+		return ""
+	}
+	return h.transitions[len(h.transitions)-1].Phase
+}
+
+// String renders the phases as a timeline, one phase per line
+func (h *reconcilePhases) String() string {
+	lines := make([]string, 0, len(h.transitions))
+	for _, t := range h.transitions {
+		lines = append(lines, fmt.Sprintf("%s %s (%s)", t.Start.UTC().Format(time.RFC3339Nano), t.Phase, t.Duration.Round(time.Millisecond)))
+	}
+	return strings.Join(lines, "\n")
+}
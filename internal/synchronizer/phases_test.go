@@ -0,0 +1,48 @@
+package synchronizer
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("reconcilePhases", func() {
+	var (
+		h     *reconcilePhases
+		clock time.Time
+	)
+
+	BeforeEach(func() {
+		clock = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		h = newReconcilePhases()
+		h.now = func() time.Time {
+			return clock
+		}
+	})
+
+	It("should record phases with durations", func() {
+		h.enter("Preparing")
+		clock = clock.Add(20 * time.Millisecond)
+		h.enter("EvaluatingUpdate")
+		clock = clock.Add(5 * time.Millisecond)
+		h.finish()
+
+		Expect(h.current()).To(Equal("EvaluatingUpdate"))
+		Expect(h.String()).To(Equal(strings.Join([]string{
+			"2025-01-02T03:04:05Z Preparing (20ms)",
+			"2025-01-02T03:04:05.02Z EvaluatingUpdate (5ms)",
+		}, "\n")))
+	})
+
+	It("should not extend a finished phase", func() {
+		h.enter("Completed")
+		clock = clock.Add(time.Second)
+		h.finish()
+		clock = clock.Add(time.Second)
+		h.finish()
+
+		Expect(h.transitions[0].Duration).To(Equal(time.Second))
+	})
+})
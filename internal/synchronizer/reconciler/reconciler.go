@@ -2,12 +2,17 @@ package reconciler
 
 import (
 	"context"
+	"errors"
 
 	"github.com/nais/pgrator/internal/synchronizer/action"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// ErrInvalid marks errors caused by the reconciled object itself, which will not go away by retrying.
+// Wrap it to have the object reported as degraded instead of retried eagerly.
+var ErrInvalid = errors.New("invalid")
+
 type Reconciler[T client.Object, P any] interface {
 	// Name returns a string identifying this reconciler
 	// The name is used to create a suitable finalizer, and prefix annotations
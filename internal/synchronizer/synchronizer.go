@@ -2,6 +2,7 @@ package synchronizer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -11,6 +12,10 @@ import (
 	"github.com/nais/pgrator/internal/synchronizer/events"
 	"github.com/nais/pgrator/internal/synchronizer/object"
 	"github.com/nais/pgrator/internal/synchronizer/reconciler"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	core_v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -26,30 +31,52 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// clusterScopedNamespace is used in place of the namespace in owner annotations for cluster-scoped owners
+const clusterScopedNamespace = "_"
+
 type Synchronizer[T object.NaisObject, P any] struct {
 	client     client.Client
 	scheme     *runtime.Scheme
 	reconciler reconciler.Reconciler[T, P]
 	recorder   events.Recorder
+	tracer     trace.Tracer
+	backoff    *requeueBackoff
+	options
 
 	ownerAnnotationKey string
 	relevantListTypes  map[schema.GroupVersionKind]reflect.Type
+
+	// ownerIndexed is set when the owner annotation is indexed in the cache used by client
+	ownerIndexed bool
 }
 
-func NewSynchronizer[T object.NaisObject, P any](k8sClient client.Client, scheme *runtime.Scheme, r reconciler.Reconciler[T, P], recorder events.Recorder) *Synchronizer[T, P] {
-	return &Synchronizer[T, P]{
+func NewSynchronizer[T object.NaisObject, P any](k8sClient client.Client, scheme *runtime.Scheme, r reconciler.Reconciler[T, P], recorder events.Recorder, opts ...Option) *Synchronizer[T, P] {
+	s := &Synchronizer[T, P]{
 		client:     k8sClient,
 		scheme:     scheme,
 		reconciler: r,
 		recorder:   recorder,
+		backoff:    newRequeueBackoff(missingCRDBackoff),
+		options: options{
+			maxParallelActions: defaultMaxParallelActions,
+		},
 
 		ownerAnnotationKey: fmt.Sprintf("%s/owner", r.Name()),
 		relevantListTypes:  findRelevantListTypes(r, scheme),
 	}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	if s.tracerProvider == nil {
+		s.tracerProvider = otel.GetTracerProvider()
+	}
+	s.tracer = s.tracerProvider.Tracer(tracerName)
+	return s
 }
 
 func findRelevantListTypes[T object.NaisObject, P any](r reconciler.Reconciler[T, P], scheme *runtime.Scheme) map[schema.GroupVersionKind]reflect.Type {
@@ -76,54 +103,80 @@ func findRelevantListTypes[T object.NaisObject, P any](r reconciler.Reconciler[T
 	return listTypes
 }
 
-func (s *Synchronizer[T, P]) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (s *Synchronizer[T, P]) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	logger := logf.FromContext(ctx)
 
 	obj := s.reconciler.New()
-	err := s.client.Get(ctx, req.NamespacedName, obj)
+	err = s.client.Get(ctx, req.NamespacedName, obj)
 	if err != nil {
 		// we'll ignore not-found errors, since they can't be fixed by an immediate
 		// requeue (we'll need to wait for a new notification), and we can get them
 		// on deleted requests.
+		if apierrors.IsNotFound(err) {
+			s.backoff.reset(req.NamespacedName)
+			unreferencedResources.DeletePartialMatch(prometheus.Labels{"namespace": req.Namespace, "name": req.Name})
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	ctx, span := s.startReconcileSpan(ctx, obj)
+
 	status := obj.GetStatus()
 	status.ReconcileTime = ptr.To(meta_v1.NewTime(time.Now()))
 	status.ObservedGeneration = obj.GetGeneration()
 	status.CorrelationID = obj.GetCorrelationId()
 
-	updateStatus := func() error {
-		err = s.client.Status().Update(ctx, obj)
-		if err != nil {
-			logger.Error(err, "failed to update status")
-			return err
-		}
-		status = obj.GetStatus()
-		return nil
+	// The phases of this reconcile are only kept in memory, and written to the status once when it is done
+	phases := newReconcilePhases()
+	enterPhase := func(phase string) {
+		phases.enter(phase)
+		status.ReconcilePhase = phase
 	}
 
+	// Failures are returned to the controller, which retries them with its rate limiter, except for those retrying will
+	// not fix, which are terminal, and missing CRDs, which are retried on a delay of their own
 	defer func() {
-		if err := updateStatus(); err != nil {
-			logger.Error(err, "deferred update of status failed")
+		phases.finish()
+		observePhases(phases)
+		action.SetConditions(obj, s.reconcileCondition(obj, phases, err), s.degradedCondition(obj, err))
+		// The object is gone once the last finalizer is removed, so there is no status left to update
+		if statusErr := client.IgnoreNotFound(s.client.Status().Update(ctx, obj)); statusErr != nil {
+			logger.Error(statusErr, "deferred update of status failed")
+			if err == nil {
+				err = statusErr
+			}
+		}
+		span.SetAttributes(attribute.String("phase", phases.current()))
+		endSpan(span, err)
+
+		if err == nil {
+			s.backoff.reset(req.NamespacedName)
+			return
+		}
+		class := classifyError(err)
+		reconcileErrorsTotal.WithLabelValues(string(class)).Inc()
+		switch {
+		case class == errorClassMissingCRD:
+			result = ctrl.Result{RequeueAfter: s.backoff.next(req.NamespacedName)}
+			logger.Error(err, "Reconcile failed on a missing CRD, requeueing", "requeueAfter", result.RequeueAfter)
+			err = nil
+		case class.terminal():
+			result = ctrl.Result{}
+			err = reconcile.TerminalError(err)
+		default:
+			result = ctrl.Result{}
 		}
 	}()
 
 	var actions []action.Action
-	var result ctrl.Result
 	s.recorder.RecordEvent(obj, core_v1.EventTypeNormal, "Reconciling", "Reconciling %s/%s", obj.GetNamespace(), obj.GetName())
 
-	status.ReconcilePhase = "Preparing"
-	if err = updateStatus(); err != nil {
-		if apierrors.IsConflict(err) {
-			return ctrl.Result{RequeueAfter: 4 * time.Second}, nil
-		}
-		return ctrl.Result{}, err
-	}
-
+	enterPhase("Preparing")
 	s.recorder.RecordEvent(obj, core_v1.EventTypeNormal, "Preparing", "Preparing resources")
 
-	prep, result, err := s.reconciler.Prepare(ctx, s.client, obj)
+	prepareCtx, prepareSpan := s.tracer.Start(ctx, "Prepare")
+	prep, result, err := s.reconciler.Prepare(prepareCtx, s.client, obj)
+	endSpan(prepareSpan, err)
 	if err != nil {
 		logger.Error(err, "failed preparation stage")
 		s.recorder.RecordErrorEvent(obj, "Preparing", err)
@@ -136,15 +189,11 @@ func (s *Synchronizer[T, P]) Reconcile(ctx context.Context, req ctrl.Request) (c
 	finalizerFunc := controllerutil.AddFinalizer
 	if deletionTimestamp != nil {
 		if len(finalizers) > 0 && finalizers[0] == finalizer {
-			status.ReconcilePhase = "EvaluatingDeletion"
+			enterPhase("EvaluatingDeletion")
 			s.recorder.RecordEvent(obj, core_v1.EventTypeNormal, "EvaluatingDeletion", "Evaluating deletion of resources")
-			if err = updateStatus(); err != nil {
-				if apierrors.IsConflict(err) {
-					return ctrl.Result{RequeueAfter: 4 * time.Second}, nil
-				}
-				return ctrl.Result{}, err
-			}
+			_, deleteSpan := s.tracer.Start(ctx, "Delete")
 			actions, result, err = s.reconciler.Delete(obj)
+			endSpan(deleteSpan, err)
 			if err != nil {
 				logger.Error(err, "failed to calculate delete actions")
 				s.recorder.RecordErrorEvent(obj, "EvaluatingDeletion", err)
@@ -153,15 +202,11 @@ func (s *Synchronizer[T, P]) Reconcile(ctx context.Context, req ctrl.Request) (c
 			finalizerFunc = controllerutil.RemoveFinalizer
 		}
 	} else {
-		status.ReconcilePhase = "EvaluatingUpdate"
+		enterPhase("EvaluatingUpdate")
 		s.recorder.RecordEvent(obj, core_v1.EventTypeNormal, "EvaluatingUpdate", "Evaluating update of resources")
-		if err = updateStatus(); err != nil {
-			if apierrors.IsConflict(err) {
-				return ctrl.Result{RequeueAfter: 4 * time.Second}, nil
-			}
-			return ctrl.Result{}, err
-		}
+		_, updateSpan := s.tracer.Start(ctx, "Update")
 		actions, result, err = s.reconciler.Update(obj, prep)
+		endSpan(updateSpan, err)
 		if err != nil {
 			logger.Error(err, "failed to calculate update actions")
 			s.recorder.RecordErrorEvent(obj, "EvaluatingUpdate", err)
@@ -169,59 +214,109 @@ func (s *Synchronizer[T, P]) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 	}
 
-	status.ReconcilePhase = "DetectingUnreferenced"
+	enterPhase("DetectingUnreferenced")
 	s.recorder.RecordEvent(obj, core_v1.EventTypeNormal, "DetectingUnreferenced", "Detecting unreferenced resources")
-	if err = updateStatus(); err != nil {
-		if apierrors.IsConflict(err) {
-			return ctrl.Result{RequeueAfter: 4 * time.Second}, nil
-		}
-		return ctrl.Result{}, err
-	}
-
-	actions, err = s.DetectUnreferenced(ctx, obj, actions)
+	detectCtx, detectSpan := s.tracer.Start(ctx, "DetectUnreferenced")
+	actions, err = s.DetectUnreferenced(detectCtx, obj, actions)
+	endSpan(detectSpan, err)
 	if err != nil {
 		logger.Error(err, "unable to detect unreferenced resources")
 		s.recorder.RecordErrorEvent(obj, "DetectUnreferenced", err)
 		return ctrl.Result{}, err
 	}
 
-	status.ReconcilePhase = "PerformingActions"
+	enterPhase("PerformingActions")
 	s.recorder.RecordEvent(obj, core_v1.EventTypeNormal, "PerformingActions", "Performing %d actions", len(actions))
-	if err = updateStatus(); err != nil {
-		if apierrors.IsConflict(err) {
-			return ctrl.Result{RequeueAfter: 4 * time.Second}, nil
-		}
-		return ctrl.Result{}, err
-	}
-
-	result, err = s.PerformActions(ctx, actions)
+	// Keep any requeue asked for by the reconciler, e.g. to follow changes that are not watched
+	actionsResult, err := s.PerformActions(ctx, obj, actions)
 	if err != nil {
 		logger.Error(err, "failed to perform reconciliation")
 		s.recorder.RecordErrorEvent(obj, "PerformActions", err)
-		return result, err
+		return actionsResult, err
+	}
+	if result.IsZero() {
+		result = actionsResult
+	}
+
+	if s.planMode {
+		enterPhase("Planned")
+		return result, nil
 	}
 
 	if finalizerFunc(obj, finalizer) {
+		// Updating the object replaces the status with what is stored, so keep what we have collected so far
+		desiredStatus := status.DeepCopy()
 		err = s.client.Update(ctx, obj)
 		if err != nil {
 			logger.Error(err, "failed to update finalizer")
 			s.recorder.RecordErrorEvent(obj, "FinalizerUpdate", err)
 			return ctrl.Result{}, err
 		}
+		status = obj.GetStatus()
+		*status = *desiredStatus
 	}
 
-	status.ReconcilePhase = "Completed"
+	enterPhase("Completed")
 	s.recorder.RecordEvent(obj, core_v1.EventTypeNormal, "Completed", "Successfully synchronized %s/%s", obj.GetNamespace(), obj.GetName())
 	return result, nil
 }
 
-func (s *Synchronizer[T, P]) PerformActions(ctx context.Context, actions []action.Action) (ctrl.Result, error) {
-	var err error
+// reconcileCondition describes the outcome and timeline of the last reconcile
+func (s *Synchronizer[T, P]) reconcileCondition(obj T, phases *reconcilePhases, err error) meta_v1.Condition {
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/Reconciled", s.reconciler.Name()),
+		Status:             meta_v1.ConditionTrue,
+		ObservedGeneration: obj.GetGeneration(),
+		Reason:             phases.current(),
+		Message:            truncateMessage(phases.String()),
+	}
+	if err != nil {
+		condition.Status = meta_v1.ConditionFalse
+		condition.Reason = fmt.Sprintf("%sFailed", phases.current())
+	}
+	return condition
+}
+
+// degradedCondition tells whether the last reconcile failed in a way that needs someone to fix something before it can succeed
+func (s *Synchronizer[T, P]) degradedCondition(obj T, err error) meta_v1.Condition {
+	condition := meta_v1.Condition{
+		Type:               fmt.Sprintf("%s/Degraded", s.reconciler.Name()),
+		Status:             meta_v1.ConditionFalse,
+		ObservedGeneration: obj.GetGeneration(),
+		Reason:             "Reconciled",
+		Message:            "Reconciled without errors",
+	}
+	if err != nil {
+		class := classifyError(err)
+		condition.Reason = string(class)
+		condition.Message = truncateMessage(err.Error())
+		if class.degraded() {
+			condition.Status = meta_v1.ConditionTrue
+		}
+	}
+	return condition
+}
+
+func (s *Synchronizer[T, P]) PerformActions(ctx context.Context, owner T, actions []action.Action) (ctrl.Result, error) {
 	for _, a := range actions {
-		// TODO: s.addOwnerAnnotation(a)
-		// Must handle IAMPolicyMember before adding owner annotation here
-		err = a.Do(ctx, s.client, s.scheme)
-		if err != nil {
+		s.addOwnerAnnotation(a)
+	}
+
+	if s.planMode {
+		return s.planActions(ctx, owner, actions)
+	}
+
+	status := owner.GetStatus()
+	if status.Conditions != nil {
+		meta.RemoveStatusCondition(status.Conditions, s.planConditionType())
+	}
+
+	if err := s.executeActions(ctx, actions); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if owner.GetDeletionTimestamp() == nil {
+		if err := s.adoptShared(ctx, owner, actions); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
@@ -229,16 +324,138 @@ func (s *Synchronizer[T, P]) PerformActions(ctx context.Context, actions []actio
 	return ctrl.Result{}, nil
 }
 
-// TODO: Must handle IAMPolicyMember before adding owner annotation
-// func (s *Synchronizer[T, P]) addOwnerAnnotation(a action.Action) {
-// 	obj := a.GetObject()
-// 	annotations := obj.GetAnnotations()
-// 	if annotations == nil {
-// 		annotations = make(map[string]string)
-// 		obj.SetAnnotations(annotations)
-// 	}
-// 	annotations[s.ownerAnnotationKey] = client.ObjectKeyFromObject(a.GetOwner()).String()
-// }
+// planActions records what each action would do in the logs and as a condition on the owner, without changing anything
+func (s *Synchronizer[T, P]) planActions(ctx context.Context, owner T, actions []action.Action) (ctrl.Result, error) {
+	logger := logf.FromContext(ctx)
+
+	plans := make([]action.Plan, 0, len(actions))
+	changes := 0
+	for _, a := range actions {
+		plan, err := a.Plan(ctx, s.client, s.scheme)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("planning %s/%s: %w", a.GetObject().GetNamespace(), a.GetObject().GetName(), err)
+		}
+		logger.Info("Planned action", "operation", plan.Operation, "kind", plan.Kind, "namespace", plan.Namespace, "name", plan.Name, "changes", plan.Changes)
+		if plan.Operation != action.OperationNone {
+			changes++
+		}
+		plans = append(plans, plan)
+	}
+
+	condition := meta_v1.Condition{
+		Type:               s.planConditionType(),
+		Status:             meta_v1.ConditionFalse,
+		ObservedGeneration: owner.GetGeneration(),
+		Reason:             "NoChanges",
+		Message:            truncateMessage(action.RenderPlans(plans)),
+	}
+	if changes > 0 {
+		condition.Status = meta_v1.ConditionTrue
+		condition.Reason = "ChangesPending"
+	}
+
+	action.SetConditions(owner, condition)
+
+	s.recorder.RecordEvent(owner, core_v1.EventTypeNormal, "Planned", "Planned %d actions, %d with changes", len(plans), changes)
+	return ctrl.Result{}, nil
+}
+
+func (s *Synchronizer[T, P]) planConditionType() string {
+	return fmt.Sprintf("%s/Planned", s.reconciler.Name())
+}
+
+// truncateMessage keeps condition messages within the limit enforced by the API server
+func truncateMessage(message string) string {
+	const maxConditionMessageLength = 32768
+	if len(message) <= maxConditionMessageLength {
+		return message
+	}
+	return message[:maxConditionMessageLength-3] + "..."
+}
+
+// addOwnerAnnotation marks the object of an action as belonging to the owner of the action.
+// Objects shared between several owners (like the IAMPolicyMember for a namespace) are only stamped when created,
+// so the reconciler must keep referencing them in all its actions, also when deleting, to avoid them being unreferenced.
+// Once the owner that created them is gone, they are handed over to another owner by adoptShared.
+// Objects not owned by the action, like those only patched, are never stamped, so that they are never deleted as unreferenced.
+func (s *Synchronizer[T, P]) addOwnerAnnotation(a action.Action) {
+	if !a.Owned() {
+		return
+	}
+	obj := a.GetObject()
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[s.ownerAnnotationKey] = ownerAnnotationValue(a.GetOwner())
+	obj.SetAnnotations(annotations)
+}
+
+// adoptShared stamps owner on the objects it shares with others, when the owner they are stamped with is gone.
+// Events for shared objects are mapped to the owner in the annotation, which would otherwise be missing from then on.
+func (s *Synchronizer[T, P]) adoptShared(ctx context.Context, owner T, actions []action.Action) error {
+	annotationValue := ownerAnnotationValue(owner)
+	for _, a := range actions {
+		// Only objects that are created if they do not exist are shared, the others are stamped on every update
+		if !a.Owned() || a.Type() != "CreateIfNotExists" {
+			continue
+		}
+		newObj, err := s.scheme.New(s.gvkOf(a.GetObject()))
+		if err != nil {
+			return fmt.Errorf("internal error: %w", err)
+		}
+		existing := newObj.(client.Object)
+		if err := s.client.Get(ctx, client.ObjectKeyFromObject(a.GetObject()), existing); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		current, ok := existing.GetAnnotations()[s.ownerAnnotationKey]
+		if !ok || current == annotationValue {
+			continue
+		}
+		gone, err := s.ownerGone(ctx, current)
+		if err != nil {
+			return fmt.Errorf("looking up owner %s of %s: %w", current, s.describeAction(a), err)
+		}
+		if !gone {
+			continue
+		}
+
+		patch := client.MergeFrom(existing.DeepCopyObject().(client.Object))
+		annotations := existing.GetAnnotations()
+		annotations[s.ownerAnnotationKey] = annotationValue
+		existing.SetAnnotations(annotations)
+		if err := s.client.Patch(ctx, existing, patch); err != nil {
+			return fmt.Errorf("adopting %s: %w", s.describeAction(a), err)
+		}
+		logf.FromContext(ctx).Info("Adopted shared object from deleted owner", "kind", s.kindOf(existing), "namespace", existing.GetNamespace(), "name", existing.GetName(), "previousOwner", current)
+	}
+	return nil
+}
+
+// ownerGone returns true if the owner in an owner annotation no longer exists, or is being deleted
+func (s *Synchronizer[T, P]) ownerGone(ctx context.Context, value string) (bool, error) {
+	name, err := parseNamespacedName(value)
+	if err != nil {
+		return false, err
+	}
+	owner := s.reconciler.New()
+	if err := s.client.Get(ctx, name, owner); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return owner.GetDeletionTimestamp() != nil, nil
+}
+
+func ownerAnnotationValue(owner client.Object) string {
+	ns := owner.GetNamespace()
+	// cluster-scoped resources cannot have an empty namespace in the owner annotation
+	if ns == "" {
+		ns = clusterScopedNamespace
+	}
+	return types.NamespacedName{Namespace: ns, Name: owner.GetName()}.String()
+}
 
 // SetupWithManager sets up the controller with the Manager.
 func (s *Synchronizer[T, P]) SetupWithManager(mgr ctrl.Manager) error {
@@ -261,6 +478,28 @@ func (s *Synchronizer[T, P]) SetupWithManager(mgr ctrl.Manager) error {
 		builder = builder.Owns(t)
 	}
 
+	for _, t := range s.relevantTypes() {
+		if err := mgr.GetFieldIndexer().IndexField(context.Background(), t, s.ownerIndexField(), s.ownerIndexValue); err != nil {
+			return fmt.Errorf("unable to index owner annotation for %T: %w", t, err)
+		}
+	}
+	s.ownerIndexed = true
+
+	listGVK := s.gvkOf(s.reconciler.New())
+	listGVK.Kind += "List"
+	if _, err := s.scheme.New(listGVK); err != nil {
+		return fmt.Errorf("unable to find list type for %s: %w", listGVK.Kind, err)
+	}
+	collector := newPhaseCollector(mgr.GetClient(), func() client.ObjectList {
+		list, _ := s.scheme.New(listGVK)
+		return list.(client.ObjectList)
+	})
+	if err := metrics.Registry.Register(collector); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			return fmt.Errorf("unable to register metrics: %w", err)
+		}
+	}
+
 	for _, t := range s.reconciler.AdditionalTypes() {
 		builder = builder.Watches(t, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, object client.Object) []reconcile.Request {
 			if value, ok := object.GetAnnotations()[s.ownerAnnotationKey]; ok {
@@ -283,14 +522,36 @@ func (s *Synchronizer[T, P]) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(s)
 }
 
+func (s *Synchronizer[T, P]) relevantTypes() []client.Object {
+	relevantTypes := make([]client.Object, 0)
+	relevantTypes = append(relevantTypes, s.reconciler.OwnedTypes()...)
+	relevantTypes = append(relevantTypes, s.reconciler.AdditionalTypes()...)
+	return relevantTypes
+}
+
+func (s *Synchronizer[T, P]) ownerIndexField() string {
+	return fmt.Sprintf("metadata.annotations[%s]", s.ownerAnnotationKey)
+}
+
+func (s *Synchronizer[T, P]) ownerIndexValue(obj client.Object) []string {
+	if v, ok := obj.GetAnnotations()[s.ownerAnnotationKey]; ok {
+		return []string{v}
+	}
+	return nil
+}
+
 func (s *Synchronizer[T, P]) DetectUnreferenced(ctx context.Context, owner T, actions []action.Action) ([]action.Action, error) {
 	// List all resources of owned or additional types
 	// Filter unrelated resources (owner annotation / owner reference)
-	annotationValue := client.ObjectKeyFromObject(owner).String()
+	annotationValue := ownerAnnotationValue(owner)
+	var listOpts []client.ListOption
+	if s.ownerIndexed {
+		listOpts = append(listOpts, client.MatchingFields{s.ownerIndexField(): annotationValue})
+	}
 	allResources := make([]client.Object, 0)
 	for _, t := range s.relevantListTypes {
 		list := reflect.New(t).Interface().(client.ObjectList)
-		err := s.client.List(ctx, list)
+		err := s.client.List(ctx, list, listOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("unable to list %s: %w", t, err)
 		}
@@ -329,9 +590,14 @@ func (s *Synchronizer[T, P]) DetectUnreferenced(ctx context.Context, owner T, ac
 		}
 	}
 	// Add DeleteIfExists action for remainder
+	kinds := make([]string, 0, len(unreferenced))
 	for _, existing := range unreferenced {
-		actions = append(actions, action.DeleteIfExists(existing, owner, func(obj client.Object) []meta_v1.Condition { return nil }, s.recorder))
+		kind := s.kindOf(existing)
+		kinds = append(kinds, kind)
+		deleteAction := action.DeleteIfExists(existing, owner, func(obj client.Object) []meta_v1.Condition { return nil }, s.recorder)
+		actions = append(actions, &unreferencedDeletion{Action: deleteAction, kind: kind})
 	}
+	setUnreferenced(owner, kinds)
 
 	return actions, nil
 }
@@ -391,6 +657,9 @@ func parseNamespacedName(input string) (types.NamespacedName, error) {
 	if len(parts) != 2 {
 		return types.NamespacedName{}, fmt.Errorf("can not parse invalid NamespacedName, incorrect number of parts: %d", len(parts))
 	}
+	if parts[0] == clusterScopedNamespace {
+		parts[0] = ""
+	}
 	return types.NamespacedName{
 		Namespace: parts[0],
 		Name:      parts[1],
@@ -0,0 +1,266 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	liberator_scheme "github.com/nais/liberator/pkg/scheme"
+	"github.com/nais/pgrator/internal/synchronizer/action"
+	"github.com/nais/pgrator/internal/synchronizer/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testReconciler generates a single NetworkPolicy per owner, and fails updates with updateErr if set
+type testReconciler struct {
+	updateErr    error
+	updateResult ctrl.Result
+}
+
+func (r *testReconciler) Name() string {
+	return "test.nais.io"
+}
+
+func (r *testReconciler) New() *data_nais_io_v1.Postgres {
+	return &data_nais_io_v1.Postgres{}
+}
+
+func (r *testReconciler) OwnedTypes() []client.Object {
+	return nil
+}
+
+func (r *testReconciler) AdditionalTypes() []client.Object {
+	return []client.Object{&networking_v1.NetworkPolicy{}}
+}
+
+func (r *testReconciler) Prepare(_ context.Context, _ client.Reader, _ *data_nais_io_v1.Postgres) (struct{}, ctrl.Result, error) {
+	return struct{}{}, ctrl.Result{}, nil
+}
+
+func (r *testReconciler) Update(_ *data_nais_io_v1.Postgres, _ struct{}) ([]action.Action, ctrl.Result, error) {
+	return nil, r.updateResult, r.updateErr
+}
+
+func (r *testReconciler) Delete(_ *data_nais_io_v1.Postgres) ([]action.Action, ctrl.Result, error) {
+	return nil, ctrl.Result{}, nil
+}
+
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	_, err := liberator_scheme.AddAll(scheme)
+	utilruntime.Must(err)
+	return scheme
+}
+
+func makeOwner(i int) *data_nais_io_v1.Postgres {
+	return &data_nais_io_v1.Postgres{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      fmt.Sprintf("app-%d", i),
+			Namespace: fmt.Sprintf("team-%d", i),
+		},
+	}
+}
+
+// cacheClient serves List from a client-go indexer, the same way the informer cache of the manager does
+type cacheClient struct {
+	client.Client
+	indexer toolscache.Indexer
+}
+
+func (c *cacheClient) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	var items []any
+	var err error
+	if listOpts.FieldSelector != nil {
+		requirements := listOpts.FieldSelector.Requirements()
+		if len(requirements) != 1 {
+			return fmt.Errorf("unsupported field selector: %s", listOpts.FieldSelector)
+		}
+		items, err = c.indexer.ByIndex("field:"+requirements[0].Field, requirements[0].Value)
+	} else {
+		items = c.indexer.List()
+	}
+	if err != nil {
+		return err
+	}
+
+	objects := make([]runtime.Object, 0, len(items))
+	for _, item := range items {
+		objects = append(objects, item.(runtime.Object).DeepCopyObject())
+	}
+	return meta.SetList(list, objects)
+}
+
+// newTestSynchronizer creates a synchronizer with a cache containing one owned NetworkPolicy for each of n owners
+func newTestSynchronizer(n int, indexed bool) *Synchronizer[*data_nais_io_v1.Postgres, struct{}] {
+	scheme := newTestScheme()
+	r := &testReconciler{}
+	s := NewSynchronizer(nil, scheme, r, events.NewRecorder(record.NewFakeRecorder(100)))
+
+	indexer := toolscache.NewIndexer(toolscache.MetaNamespaceKeyFunc, toolscache.Indexers{
+		"field:" + s.ownerIndexField(): func(obj any) ([]string, error) {
+			return s.ownerIndexValue(obj.(client.Object)), nil
+		},
+	})
+	for i := 0; i < n; i++ {
+		owner := makeOwner(i)
+		err := indexer.Add(&networking_v1.NetworkPolicy{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Name:      owner.GetName(),
+				Namespace: fmt.Sprintf("pg-%s", owner.GetNamespace()),
+				Annotations: map[string]string{
+					s.ownerAnnotationKey: ownerAnnotationValue(owner),
+				},
+			},
+		})
+		utilruntime.Must(err)
+	}
+	s.client = &cacheClient{
+		Client:  fake.NewClientBuilder().WithScheme(scheme).Build(),
+		indexer: indexer,
+	}
+	s.ownerIndexed = indexed
+	return s
+}
+
+var _ = Describe("DetectUnreferenced", func() {
+	ctx := context.Background()
+
+	for _, indexed := range []bool{false, true} {
+		It(fmt.Sprintf("should only find resources of the given owner (indexed=%t)", indexed), func() {
+			s := newTestSynchronizer(10, indexed)
+			owner := makeOwner(3)
+
+			actions, err := s.DetectUnreferenced(ctx, owner, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actions).To(HaveLen(1))
+			Expect(actions[0].GetObject().GetName()).To(Equal("app-3"))
+			Expect(actions[0].GetObject().GetNamespace()).To(Equal("pg-team-3"))
+		})
+
+		It(fmt.Sprintf("should keep resources referenced by actions (indexed=%t)", indexed), func() {
+			s := newTestSynchronizer(10, indexed)
+			owner := makeOwner(3)
+			referenced := &networking_v1.NetworkPolicy{ObjectMeta: meta_v1.ObjectMeta{Name: "app-3", Namespace: "pg-team-3"}}
+
+			actions, err := s.DetectUnreferenced(ctx, owner, []action.Action{action.NoOp(referenced, owner, nil, nil)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actions).To(HaveLen(1))
+		})
+	}
+})
+
+var _ = Describe("addOwnerAnnotation", func() {
+	It("should only mark objects of the owner, not those patched for others", func() {
+		s := newTestSynchronizer(0, false)
+		owner := makeOwner(1)
+		owned := &networking_v1.NetworkPolicy{ObjectMeta: meta_v1.ObjectMeta{Name: "app-1", Namespace: "pg-team-1"}}
+		patched := &core_v1.Secret{ObjectMeta: meta_v1.ObjectMeta{Name: "credentials", Namespace: "team-1"}}
+
+		s.addOwnerAnnotation(action.CreateOrUpdate(owned, owner, nil, nil))
+		s.addOwnerAnnotation(action.Patch(patched, owner, nil, nil))
+		Expect(owned.GetAnnotations()).To(HaveKeyWithValue(s.ownerAnnotationKey, "team-1/app-1"))
+		Expect(patched.GetAnnotations()).NotTo(HaveKey(s.ownerAnnotationKey))
+	})
+})
+
+var _ = Describe("adoptShared", func() {
+	ctx := context.Background()
+
+	// performShared creates a NetworkPolicy shared by the owners through owner, after it was created by creator
+	performShared := func(owner, creator *data_nais_io_v1.Postgres, others ...client.Object) *networking_v1.NetworkPolicy {
+		scheme := newTestScheme()
+		s := NewSynchronizer(nil, scheme, &testReconciler{}, events.NewRecorder(record.NewFakeRecorder(100)))
+		shared := func() *networking_v1.NetworkPolicy {
+			return &networking_v1.NetworkPolicy{
+				TypeMeta:   meta_v1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+				ObjectMeta: meta_v1.ObjectMeta{Name: "shared", Namespace: "pg-team"},
+			}
+		}
+		existing := shared()
+		existing.Annotations = map[string]string{s.ownerAnnotationKey: ownerAnnotationValue(creator)}
+		s.client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(others, owner, existing)...).Build()
+
+		noConditions := func(client.Object) []meta_v1.Condition { return nil }
+		_, err := s.PerformActions(ctx, owner, []action.Action{action.CreateIfNotExists(shared(), owner, noConditions, s.recorder)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(s.client.Get(ctx, client.ObjectKeyFromObject(existing), existing)).To(Succeed())
+		return existing
+	}
+
+	It("should take over shared objects from an owner that is gone", func() {
+		shared := performShared(makeOwner(2), makeOwner(1))
+		Expect(shared.GetAnnotations()).To(HaveKeyWithValue("test.nais.io/owner", "team-2/app-2"))
+	})
+
+	It("should take over shared objects from an owner being deleted", func() {
+		creator := makeOwner(1)
+		creator.Finalizers = []string{"test.nais.io"}
+		creator.DeletionTimestamp = ptr.To(meta_v1.Now())
+		shared := performShared(makeOwner(2), creator, creator)
+		Expect(shared.GetAnnotations()).To(HaveKeyWithValue("test.nais.io/owner", "team-2/app-2"))
+	})
+
+	It("should leave shared objects with an owner that still exists", func() {
+		shared := performShared(makeOwner(2), makeOwner(1), makeOwner(1))
+		Expect(shared.GetAnnotations()).To(HaveKeyWithValue("test.nais.io/owner", "team-1/app-1"))
+	})
+})
+
+var _ = Describe("Reconcile", func() {
+	It("should requeue when asked to by the reconciler", func() {
+		owner := makeOwner(1)
+		scheme := newTestScheme()
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(owner).WithStatusSubresource(owner).Build()
+		r := &testReconciler{updateResult: ctrl.Result{RequeueAfter: time.Minute}}
+		s := NewSynchronizer(c, scheme, r, events.NewRecorder(record.NewFakeRecorder(100)))
+
+		result, err := s.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(owner)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Minute))
+	})
+})
+
+func benchmarkDetectUnreferenced(b *testing.B, n int, indexed bool) {
+	s := newTestSynchronizer(n, indexed)
+	owner := makeOwner(n / 2)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.DetectUnreferenced(ctx, owner, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDetectUnreferenced(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("list/%d", n), func(b *testing.B) {
+			benchmarkDetectUnreferenced(b, n, false)
+		})
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			benchmarkDetectUnreferenced(b, n, true)
+		})
+	}
+}
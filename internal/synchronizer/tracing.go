@@ -0,0 +1,39 @@
+package synchronizer
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/nais/pgrator/internal/synchronizer"
+
+	// traceParentAnnotation holds a W3C traceparent, letting the reconcile join the trace of whoever deployed the object
+	traceParentAnnotation = "nais.io/traceparent"
+)
+
+// startReconcileSpan starts the root span of a reconcile, as a child of the trace in the traceparent annotation if present
+func (s *Synchronizer[T, P]) startReconcileSpan(ctx context.Context, obj T) (context.Context, trace.Span) {
+	if traceParent, ok := obj.GetAnnotations()[traceParentAnnotation]; ok {
+		ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+	}
+	return s.tracer.Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("correlation_id", obj.GetCorrelationId()),
+		attribute.String("k8s.namespace.name", obj.GetNamespace()),
+		attribute.String("nais.resource.name", obj.GetName()),
+		attribute.Int64("nais.resource.generation", obj.GetGeneration()),
+	))
+}
+
+// endSpan records the outcome of the traced operation and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,137 @@
+package synchronizer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	nais_io_v1 "github.com/nais/liberator/pkg/apis/nais.io/v1"
+	"github.com/nais/pgrator/internal/synchronizer/action"
+	"github.com/nais/pgrator/internal/synchronizer/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	networking_v1 "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("tracing", func() {
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+
+	var (
+		recorder *tracetest.SpanRecorder
+		owner    *data_nais_io_v1.Postgres
+		s        *Synchronizer[*data_nais_io_v1.Postgres, struct{}]
+	)
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		owner = makeOwner(1)
+		owner.Annotations = map[string]string{
+			nais_io_v1.DeploymentCorrelationIDAnnotation: "correlation-id",
+			traceParentAnnotation:                        "00-" + traceID + "-" + parentSpanID + "-01",
+		}
+
+		scheme := newTestScheme()
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(owner).WithStatusSubresource(owner).Build()
+		s = NewSynchronizer(c, scheme, &testReconciler{}, events.NewRecorder(record.NewFakeRecorder(100)),
+			WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+		)
+	})
+
+	spanNames := func() []string {
+		names := make([]string, 0)
+		for _, span := range recorder.Ended() {
+			names = append(names, span.Name())
+		}
+		return names
+	}
+
+	It("should trace a reconcile as a child of the traceparent annotation", func() {
+		_, err := s.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(owner)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(spanNames()).To(Equal([]string{"Prepare", "Update", "DetectUnreferenced", "Reconcile"}))
+
+		spans := recorder.Ended()
+		root := spans[len(spans)-1]
+		Expect(root.SpanContext().TraceID().String()).To(Equal(traceID))
+		Expect(root.Parent().SpanID().String()).To(Equal(parentSpanID))
+		Expect(root.Attributes()).To(ContainElement(attribute.String("correlation_id", "correlation-id")))
+		Expect(root.Attributes()).To(ContainElement(attribute.String("phase", "Completed")))
+
+		for _, span := range spans[:len(spans)-1] {
+			Expect(span.Parent().SpanID()).To(Equal(root.SpanContext().SpanID()))
+		}
+	})
+
+	It("should trace each action", func() {
+		newAction := func(name string) *testAction {
+			return &testAction{
+				obj:        &networking_v1.NetworkPolicy{ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: "pg-team"}},
+				owner:      owner,
+				running:    &atomic.Int32{},
+				maxRunning: &atomic.Int32{},
+				log:        &[]string{},
+				logLock:    &sync.Mutex{},
+			}
+		}
+
+		err := s.executeActions(context.Background(), []action.Action{newAction("a"), newAction("b")})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(spanNames()).To(ConsistOf("Action", "Action"))
+		for _, span := range recorder.Ended() {
+			Expect(span.Attributes()).To(ContainElements(
+				attribute.String("action", "Test"),
+				attribute.String("kind", "NetworkPolicy"),
+			))
+		}
+	})
+
+	It("should not count the wait for a free slot as part of an action", func() {
+		s.maxParallelActions = 1
+		newAction := func(name string) *testAction {
+			return &testAction{
+				obj:        &networking_v1.NetworkPolicy{ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: "pg-team"}},
+				owner:      owner,
+				delay:      50 * time.Millisecond,
+				running:    &atomic.Int32{},
+				maxRunning: &atomic.Int32{},
+				log:        &[]string{},
+				logLock:    &sync.Mutex{},
+			}
+		}
+
+		err := s.executeActions(context.Background(), []action.Action{newAction("a"), newAction("b")})
+		Expect(err).NotTo(HaveOccurred())
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		first, second := spans[0], spans[1]
+		Expect(second.StartTime()).NotTo(BeTemporally("<", first.EndTime()))
+
+		waited := func(span sdktrace.ReadOnlySpan) float64 {
+			for _, attr := range span.Attributes() {
+				if attr.Key == "wait_seconds" {
+					return attr.Value.AsFloat64()
+				}
+			}
+			Fail("span has no wait_seconds attribute")
+			return 0
+		}
+		Expect(waited(first)).To(BeNumerically("<", 0.05))
+		Expect(waited(second)).To(BeNumerically(">=", 0.04))
+	})
+})
@@ -0,0 +1,113 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/controller/resourcecreator"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupPostgresWebhookWithManager registers the webhook for Postgres in the manager
+func SetupPostgresWebhookWithManager(mgr ctrl.Manager, cfg *config.Config) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&data_nais_io_v1.Postgres{}).
+		WithDefaulter(&PostgresCustomDefaulter{Config: cfg}).
+		WithValidator(&PostgresCustomValidator{Config: cfg}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-data-nais-io-v1-postgres,mutating=true,failurePolicy=fail,sideEffects=None,groups=data.nais.io,resources=postgres,verbs=create;update,versions=v1,name=mpostgres-v1.kb.io,admissionReviewVersions=v1
+
+// PostgresCustomDefaulter fills in the defaults used for the cluster, so that users see what they get
+type PostgresCustomDefaulter struct {
+	Config *config.Config
+}
+
+var _ webhook.CustomDefaulter = &PostgresCustomDefaulter{}
+
+func (d *PostgresCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	postgres, ok := obj.(*data_nais_io_v1.Postgres)
+	if !ok {
+		return fmt.Errorf("expected a Postgres object but got %T", obj)
+	}
+
+	// Nothing is changed while the finalizer is removed
+	if postgres.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	resourcecreator.SetDefaults(postgres, d.Config)
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-data-nais-io-v1-postgres,mutating=false,failurePolicy=fail,sideEffects=None,groups=data.nais.io,resources=postgres,verbs=create;update,versions=v1,name=vpostgres-v1.kb.io,admissionReviewVersions=v1
+
+// PostgresCustomValidator rejects Postgres resources that would fail when reconciled, with errors for each field
+type PostgresCustomValidator struct {
+	Config *config.Config
+}
+
+var _ webhook.CustomValidator = &PostgresCustomValidator{}
+
+func (v *PostgresCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	postgres, ok := obj.(*data_nais_io_v1.Postgres)
+	if !ok {
+		return nil, fmt.Errorf("expected a Postgres object but got %T", obj)
+	}
+
+	return nil, invalid(postgres, resourcecreator.ValidatePostgres(postgres, v.Config))
+}
+
+func (v *PostgresCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*data_nais_io_v1.Postgres)
+	if !ok {
+		return nil, fmt.Errorf("expected a Postgres object for the old object but got %T", oldObj)
+	}
+	postgres, ok := newObj.(*data_nais_io_v1.Postgres)
+	if !ok {
+		return nil, fmt.Errorf("expected a Postgres object for the new object but got %T", newObj)
+	}
+
+	// Removing the finalizer must never be held back
+	if postgres.GetDeletionTimestamp() != nil {
+		return nil, nil
+	}
+
+	// Problems already present are let through, so that resources created before they were rejected can still be changed
+	errs := newErrors(resourcecreator.ValidatePostgres(postgres, v.Config), resourcecreator.ValidatePostgres(old, v.Config))
+	errs = append(errs, resourcecreator.ValidatePostgresUpdate(old, postgres)...)
+	return nil, invalid(postgres, errs)
+}
+
+func (v *PostgresCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// newErrors returns the errors not already in existing
+func newErrors(errs field.ErrorList, existing field.ErrorList) field.ErrorList {
+	var result field.ErrorList
+	for _, err := range errs {
+		found := slices.ContainsFunc(existing, func(e *field.Error) bool {
+			return e.Type == err.Type && e.Field == err.Field && fmt.Sprint(e.BadValue) == fmt.Sprint(err.BadValue)
+		})
+		if !found {
+			result = append(result, err)
+		}
+	}
+	return result
+}
+
+func invalid(postgres *data_nais_io_v1.Postgres, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(data_nais_io_v1.GroupVersion.WithKind("Postgres").GroupKind(), postgres.GetName(), errs)
+}
@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"context"
+
+	data_nais_io_v1 "github.com/nais/liberator/pkg/apis/data.nais.io/v1"
+	"github.com/nais/pgrator/internal/config"
+	"github.com/nais/pgrator/internal/controller/resourcecreator"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Postgres defaulting webhook", func() {
+	ctx := context.Background()
+	defaulter := &PostgresCustomDefaulter{Config: &config.Config{}}
+
+	It("should fill in defaults", func() {
+		postgres := &data_nais_io_v1.Postgres{}
+		Expect(defaulter.Default(ctx, postgres)).To(Succeed())
+		Expect(postgres.Spec.Database).NotTo(BeNil())
+		Expect(postgres.Spec.Database.Collation).To(Equal("en_US"))
+		Expect(postgres.GetAnnotations()).To(HaveKeyWithValue(resourcecreator.EffectiveAnnotationPrefix+"instances", "2"))
+	})
+
+	It("should leave resources being deleted alone", func() {
+		postgres := &data_nais_io_v1.Postgres{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &metav1.Time{}}}
+		Expect(defaulter.Default(ctx, postgres)).To(Succeed())
+		Expect(postgres.Spec.Database).To(BeNil())
+	})
+})
+
+var _ = Describe("Postgres validating webhook", func() {
+	ctx := context.Background()
+	validator := &PostgresCustomValidator{Config: &config.Config{
+		SupportedMajorVersions: []string{"16", "17"},
+	}}
+
+	postgres := func(majorVersion string, extensions ...string) *data_nais_io_v1.Postgres {
+		p := &data_nais_io_v1.Postgres{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "app",
+				Namespace: "team",
+			},
+		}
+		p.Spec.Cluster.MajorVersion = majorVersion
+		if len(extensions) > 0 {
+			p.Spec.Database = &data_nais_io_v1.PostgresDatabase{}
+			for _, extension := range extensions {
+				p.Spec.Database.Extensions = append(p.Spec.Database.Extensions, data_nais_io_v1.PostgresExtension{Name: extension})
+			}
+		}
+		return p
+	}
+
+	It("should reject invalid resources with field errors", func() {
+		_, err := validator.ValidateCreate(ctx, postgres("15", "pg_magic"))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+
+		status := err.(*apierrors.StatusError).Status()
+		Expect(status.Details.Causes).To(ConsistOf(
+			HaveField("Field", "spec.cluster.majorVersion"),
+			HaveField("Field", "spec.database.extensions[0].name"),
+		))
+
+		_, err = validator.ValidateCreate(ctx, postgres("17", "pg_trgm"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should only reject problems introduced by an update", func() {
+		old := postgres("17", "pg_magic")
+		_, err := validator.ValidateUpdate(ctx, old, postgres("17", "pg_magic", "pg_trgm"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = validator.ValidateUpdate(ctx, old, postgres("17", "pg_magic", "pg_wizardry"))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("should reject downgrades", func() {
+		_, err := validator.ValidateUpdate(ctx, postgres("17"), postgres("16"))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("should never hold back deletion", func() {
+		deleted := postgres("16")
+		deleted.DeletionTimestamp = &metav1.Time{}
+		_, err := validator.ValidateUpdate(ctx, postgres("17"), deleted)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})